@@ -0,0 +1,143 @@
+// Package alerts evaluates per-namespace thresholds over recent runs and
+// fires alerts when a namespace breaches them.
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// AlertRule fires when a namespace's runs within Window exceed MaxErrorCount
+// total errors or MaxFailedRuns failed runs. A zero maximum disables that
+// check. Namespace "*" matches every namespace.
+type AlertRule struct {
+	Namespace     string
+	MaxErrorCount int
+	MaxFailedRuns int
+	Window        time.Duration
+}
+
+// Alert describes a rule breach
+type Alert struct {
+	Namespace     string    `json:"namespace"`
+	ErrorCount    int       `json:"error_count"`
+	FailedRuns    int       `json:"failed_runs"`
+	MaxErrorCount int       `json:"max_error_count"`
+	MaxFailedRuns int       `json:"max_failed_runs"`
+	Window        string    `json:"window"`
+	FiredAt       time.Time `json:"fired_at"`
+}
+
+// ParseRules parses rules from JSON such as
+//
+//	[{"namespace": "prod", "max_error_count": 20, "max_failed_runs": 3, "window": "1h"}]
+func ParseRules(data string) ([]AlertRule, error) {
+	var raw []struct {
+		Namespace     string `json:"namespace"`
+		MaxErrorCount int    `json:"max_error_count"`
+		MaxFailedRuns int    `json:"max_failed_runs"`
+		Window        string `json:"window"`
+	}
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		return nil, err
+	}
+
+	rules := make([]AlertRule, 0, len(raw))
+	for i, r := range raw {
+		window, err := time.ParseDuration(r.Window)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("rule %d: invalid window %q", i, r.Window)
+		}
+		if r.Namespace == "" {
+			return nil, fmt.Errorf("rule %d: namespace is required", i)
+		}
+		rules = append(rules, AlertRule{r.Namespace, r.MaxErrorCount, r.MaxFailedRuns, window})
+	}
+	return rules, nil
+}
+
+// CountsFunc returns the total errors and failed runs of namespace's runs
+// started since since
+type CountsFunc func(namespace string, since time.Time) (errorCount, failedRuns int, err error)
+
+// NotifyFunc delivers a fired alert
+type NotifyFunc func(Alert) error
+
+// Engine evaluates rules and fires alerts. A breach fires once when it
+// starts, then at most once per rule window while it persists.
+type Engine struct {
+	rules  []AlertRule
+	counts CountsFunc
+	notify NotifyFunc
+
+	mu     sync.Mutex
+	firing map[firingKey]time.Time // breached rules and when they last fired
+}
+
+type firingKey struct {
+	rule      int
+	namespace string
+}
+
+func New(rules []AlertRule, counts CountsFunc, notify NotifyFunc) *Engine {
+	return &Engine{
+		rules:  rules,
+		counts: counts,
+		notify: notify,
+		firing: make(map[firingKey]time.Time),
+	}
+}
+
+// Evaluate checks every rule matching namespace, firing alerts for breaches
+func (e *Engine) Evaluate(namespace string) {
+	now := time.Now()
+	for i, rule := range e.rules {
+		if rule.Namespace != "*" && rule.Namespace != namespace {
+			continue
+		}
+
+		errorCount, failedRuns, err := e.counts(namespace, now.Add(-rule.Window))
+		if err != nil {
+			slog.Warn("alert rule evaluation failed", "namespace", namespace, "error", err)
+			continue
+		}
+
+		breached := (rule.MaxErrorCount > 0 && errorCount > rule.MaxErrorCount) ||
+			(rule.MaxFailedRuns > 0 && failedRuns > rule.MaxFailedRuns)
+		if !e.shouldFire(firingKey{i, namespace}, breached, now, rule.Window) {
+			continue
+		}
+
+		alert := Alert{
+			Namespace:     namespace,
+			ErrorCount:    errorCount,
+			FailedRuns:    failedRuns,
+			MaxErrorCount: rule.MaxErrorCount,
+			MaxFailedRuns: rule.MaxFailedRuns,
+			Window:        rule.Window.String(),
+			FiredAt:       now,
+		}
+		if err := e.notify(alert); err != nil {
+			slog.Warn("alert notification failed", "namespace", namespace, "error", err)
+		}
+	}
+}
+
+// shouldFire records the breach state for key and reports whether to fire
+func (e *Engine) shouldFire(key firingKey, breached bool, now time.Time, window time.Duration) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !breached {
+		delete(e.firing, key)
+		return false
+	}
+	if last, ok := e.firing[key]; ok && now.Sub(last) < window {
+		return false
+	}
+	e.firing[key] = now
+	return true
+}
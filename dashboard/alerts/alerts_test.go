@@ -0,0 +1,104 @@
+package alerts
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(`[
+		{"namespace": "prod", "max_error_count": 20, "max_failed_runs": 3, "window": "1h"},
+		{"namespace": "*", "max_failed_runs": 10, "window": "24h"}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AlertRule{{"prod", 20, 3, time.Hour}, {"*", 0, 10, 24 * time.Hour}}
+	if len(rules) != len(want) || rules[0] != want[0] || rules[1] != want[1] {
+		t.Errorf("rules = %+v, want %+v", rules, want)
+	}
+
+	for _, invalid := range []string{
+		`{"namespace": "prod"}`,
+		`[{"namespace": "prod", "window": "hourly"}]`,
+		`[{"namespace": "prod", "window": "-1h"}]`,
+		`[{"window": "1h"}]`,
+	} {
+		if _, err := ParseRules(invalid); err == nil {
+			t.Errorf("ParseRules(%s) succeeded, want an error", invalid)
+		}
+	}
+}
+
+// counts is a CountsFunc serving fixed per-namespace counts
+type counts map[string][2]int
+
+func (c counts) get(namespace string, since time.Time) (int, int, error) {
+	n, ok := c[namespace]
+	if !ok {
+		return 0, 0, errors.New("unknown namespace")
+	}
+	return n[0], n[1], nil
+}
+
+func TestEngine(t *testing.T) {
+	c := counts{"prod": {25, 0}, "dev": {0, 1}}
+	var fired []Alert
+	e := New([]AlertRule{{"prod", 20, 0, time.Hour}, {"*", 0, 1, time.Hour}}, c.get, func(a Alert) error {
+		fired = append(fired, a)
+		return nil
+	})
+
+	e.Evaluate("prod")
+	if len(fired) != 1 || fired[0].Namespace != "prod" || fired[0].ErrorCount != 25 || fired[0].Window != "1h0m0s" {
+		t.Fatalf("first evaluation fired %+v, want one prod error alert", fired)
+	}
+
+	e.Evaluate("prod")
+	if len(fired) != 1 {
+		t.Errorf("ongoing breach fired again within its window: %+v", fired)
+	}
+
+	c["prod"] = [2]int{5, 0}
+	e.Evaluate("prod")
+	c["prod"] = [2]int{30, 0}
+	e.Evaluate("prod")
+	if len(fired) != 2 {
+		t.Errorf("fired %d alerts, want a new one after the breach cleared and came back", len(fired))
+	}
+
+	e.Evaluate("dev")
+	if len(fired) != 2 {
+		t.Errorf("dev at the failed-run limit fired %+v, want no alert", fired[2:])
+	}
+	c["dev"] = [2]int{0, 2}
+	e.Evaluate("dev")
+	if len(fired) != 3 || fired[2].Namespace != "dev" || fired[2].FailedRuns != 2 {
+		t.Errorf("dev over the failed-run limit fired %+v, want one dev alert", fired[2:])
+	}
+
+	e.Evaluate("missing")
+	if len(fired) != 3 {
+		t.Errorf("a counts error fired %+v, want no alert", fired[3:])
+	}
+}
+
+func TestShouldFireRepeatsAfterWindow(t *testing.T) {
+	e := New(nil, nil, nil)
+	key := firingKey{0, "prod"}
+	start := time.Now()
+	for _, step := range []struct {
+		at   time.Duration
+		want bool
+	}{
+		{0, true},
+		{30 * time.Minute, false},
+		{time.Hour, true},
+		{90 * time.Minute, false},
+	} {
+		if got := e.shouldFire(key, true, start.Add(step.at), time.Hour); got != step.want {
+			t.Errorf("shouldFire at +%v = %v, want %v", step.at, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// basicAuthUsers are the credentials from BASIC_AUTH_USERS, in htpasswd
+// format: user:$2y$... bcrypt (htpasswd -B, recommended), user:{SHA}...
+// (htpasswd -s, unsalted SHA-1, accepted for existing files) or
+// user:password (htpasswd -p). MD5 ($apr1$) entries are not supported.
+type basicAuthUsers struct {
+	hashes map[string]string
+	dummy  string // checked for unknown users so timing doesn't reveal them
+}
+
+// shaPrefix marks htpasswd's salt-less SHA-1 scheme
+const shaPrefix = "{SHA}"
+
+// isBcrypt reports whether hash is a bcrypt hash, in any of the prefixes
+// htpasswd and other tools write
+func isBcrypt(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBasicAuthUsers parses comma- or newline-separated htpasswd entries
+func parseBasicAuthUsers(value string) (*basicAuthUsers, error) {
+	users := &basicAuthUsers{hashes: map[string]string{}, dummy: shaPrefix}
+	dummyCost := 0
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		user, hash, ok := strings.Cut(entry, ":")
+		if !ok || user == "" || hash == "" {
+			return nil, fmt.Errorf("invalid entry %q: want user:hash", entry)
+		}
+		if strings.HasPrefix(hash, "$") {
+			if !isBcrypt(hash) {
+				return nil, fmt.Errorf("user %q: only bcrypt, {SHA} and plain htpasswd entries are supported", user)
+			}
+			cost, err := bcrypt.Cost([]byte(hash))
+			if err != nil {
+				return nil, fmt.Errorf("user %q: %w", user, err)
+			}
+			dummyCost = max(dummyCost, cost)
+		}
+		users.hashes[user] = hash
+	}
+
+	// Unknown users cost as much as the slowest known one
+	if dummyCost > 0 {
+		password := make([]byte, 16)
+		rand.Read(password)
+		dummy, err := bcrypt.GenerateFromPassword(password, dummyCost)
+		if err != nil {
+			return nil, err
+		}
+		users.dummy = string(dummy)
+	}
+	return users, nil
+}
+
+// enabled reports whether any users are configured
+func (u *basicAuthUsers) enabled() bool {
+	return u != nil && len(u.hashes) > 0
+}
+
+// valid reports whether user and password match an entry. Unknown users
+// are compared against a dummy entry so timing doesn't reveal them.
+func (u *basicAuthUsers) valid(user, password string) bool {
+	hash, known := u.hashes[user]
+	if !known {
+		hash = u.dummy
+	}
+
+	var match bool
+	switch {
+	case isBcrypt(hash):
+		match = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, shaPrefix):
+		sum := sha1.Sum([]byte(password))
+		given := shaPrefix + base64.StdEncoding.EncodeToString(sum[:])
+		match = subtle.ConstantTimeCompare([]byte(given), []byte(hash)) == 1
+	default:
+		match = subtle.ConstantTimeCompare([]byte(password), []byte(hash)) == 1
+	}
+	return known && match
+}
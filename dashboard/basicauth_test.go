@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// shaPassword is htpasswd -s output for the password "password"
+const shaPassword = "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="
+
+// bcryptPassword hashes "password" the way htpasswd -B writes it
+func bcryptPassword(t *testing.T) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "$2y$" + strings.TrimPrefix(string(hash), "$2a$")
+}
+
+// mustParseBasicAuthUsers is parseBasicAuthUsers failing the test on error
+func mustParseBasicAuthUsers(t *testing.T, value string) *basicAuthUsers {
+	t.Helper()
+	users, err := parseBasicAuthUsers(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return users
+}
+
+func TestParseBasicAuthUsers(t *testing.T) {
+	bcryptHash := bcryptPassword(t)
+	users := mustParseBasicAuthUsers(t, "alice:"+shaPassword+",\n bob:plain ,\n carol:"+bcryptHash)
+	if len(users.hashes) != 3 || users.hashes["alice"] != shaPassword || users.hashes["bob"] != "plain" || users.hashes["carol"] != bcryptHash {
+		t.Errorf("users = %v", users.hashes)
+	}
+	if !isBcrypt(users.dummy) {
+		t.Errorf("dummy = %q, want a bcrypt hash alongside bcrypt entries", users.dummy)
+	}
+
+	for _, value := range []string{
+		"alice",
+		":" + shaPassword,
+		"alice:",
+		"alice:$2y$05$tooshort",
+		"alice:$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/",
+	} {
+		if _, err := parseBasicAuthUsers(value); err == nil {
+			t.Errorf("parseBasicAuthUsers(%q) succeeded", value)
+		}
+	}
+}
+
+func TestBasicAuthValid(t *testing.T) {
+	users := mustParseBasicAuthUsers(t, "alice:"+shaPassword+",bob:plain,carol:"+bcryptPassword(t))
+	tests := []struct {
+		user, password string
+		want           bool
+	}{
+		{"alice", "password", true},
+		{"alice", "Password", false},
+		{"alice", shaPassword, false},
+		{"bob", "plain", true},
+		{"bob", "plain ", false},
+		{"carol", "password", true},
+		{"carol", "Password", false},
+		{"dave", "password", false},
+		{"dave", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := users.valid(tt.user, tt.password); got != tt.want {
+			t.Errorf("valid(%q, %q) = %v, want %v", tt.user, tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestSessionMiddlewareBasicAuth(t *testing.T) {
+	defer func(users *basicAuthUsers) { basicAuth = users }(basicAuth)
+	basicAuth = mustParseBasicAuthUsers(t, "alice:"+shaPassword)
+	handler := SessionMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name           string
+		user, password string
+		cookie         bool
+		want           int
+	}{
+		{"valid credentials", "alice", "password", false, http.StatusOK},
+		{"wrong password", "alice", "wrong", false, http.StatusUnauthorized},
+		{"unknown user", "mallory", "password", false, http.StatusUnauthorized},
+		{"no credentials", "", "", false, http.StatusUnauthorized},
+		{"session cookie", "", "", true, http.StatusOK},
+		{"wrong password with a cookie", "alice", "wrong", true, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.user != "" {
+			r.SetBasicAuth(tt.user, tt.password)
+		}
+		if tt.cookie {
+			r.AddCookie(&http.Cookie{Name: "next-auth.session-token", Value: "token"})
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: code = %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if w.Code == http.StatusUnauthorized && !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Basic ") {
+			t.Errorf("%s: WWW-Authenticate = %q, want a Basic challenge", tt.name, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	basicAuth = nil
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth("alice", "password")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusFound {
+		t.Errorf("without BASIC_AUTH_USERS: code = %d, want the Platform login redirect", w.Code)
+	}
+}
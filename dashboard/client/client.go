@@ -0,0 +1,167 @@
+// Package client is a Go client for the dashboard's JSON API.
+//
+//	c := client.New("https://dashboard.example.com", os.Getenv("DASHBOARD_TOKEN"))
+//	runs, err := c.ListRuns(ctx, client.RunListOptions{Namespace: "prod", Limit: 20})
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kubeden/clopus-watcher/dashboard/db"
+)
+
+// Client calls the dashboard API at BaseURL. When Token is set it is sent as
+// a bearer token.
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func New(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// APIError is a non-2xx API response
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("dashboard API: %d %s", e.StatusCode, e.Message)
+}
+
+// RunListOptions filters ListRuns. Zero values are left to the server's
+// defaults.
+type RunListOptions struct {
+	Namespace string
+	Status    string
+	From      time.Time
+	To        time.Time
+	Sort      string
+	Limit     int
+	Offset    int
+}
+
+// ListRuns returns runs matching opts, newest first unless opts.Sort is set
+func (c *Client) ListRuns(ctx context.Context, opts RunListOptions) ([]db.Run, error) {
+	q := url.Values{}
+	setParam(q, "ns", opts.Namespace)
+	setParam(q, "status", opts.Status)
+	setParam(q, "sort", opts.Sort)
+	if !opts.From.IsZero() {
+		q.Set("from", opts.From.Format(time.RFC3339))
+	}
+	if !opts.To.IsZero() {
+		q.Set("to", opts.To.Format(time.RFC3339))
+	}
+	setIntParam(q, "limit", opts.Limit)
+	setIntParam(q, "offset", opts.Offset)
+
+	var runs []db.Run
+	err := c.get(ctx, "/api/runs", q, &runs)
+	return runs, err
+}
+
+// GetRun returns a run by id. A missing run is an *APIError with
+// StatusCode 404.
+func (c *Client) GetRun(ctx context.Context, id int) (*db.Run, error) {
+	var result struct {
+		Run *db.Run `json:"run"`
+	}
+	err := c.get(ctx, "/api/run", url.Values{"id": {strconv.Itoa(id)}}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.Run, nil
+}
+
+// FixListOptions filters ListFixes. Zero values are left to the server's
+// defaults.
+type FixListOptions struct {
+	Namespace string
+	Status    string
+	Sort      string
+	Limit     int
+	Offset    int
+}
+
+// ListFixes returns fixes matching opts, newest first unless opts.Sort is set
+func (c *Client) ListFixes(ctx context.Context, opts FixListOptions) ([]db.Fix, error) {
+	q := url.Values{}
+	setParam(q, "ns", opts.Namespace)
+	setParam(q, "status", opts.Status)
+	setParam(q, "sort", opts.Sort)
+	setIntParam(q, "limit", opts.Limit)
+	setIntParam(q, "offset", opts.Offset)
+
+	var fixes []db.Fix
+	err := c.get(ctx, "/api/fixes", q, &fixes)
+	return fixes, err
+}
+
+// GetStats returns fix totals by outcome
+func (c *Client) GetStats(ctx context.Context) (*db.Stats, error) {
+	var stats db.Stats
+	if err := c.get(ctx, "/api/stats", nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, q url.Values, out interface{}) error {
+	u := c.BaseURL + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var body struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		if body.Error == "" {
+			body.Error = http.StatusText(resp.StatusCode)
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: body.Error}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func setParam(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
+
+func setIntParam(q url.Values, key string, value int) {
+	if value > 0 {
+		q.Set(key, strconv.Itoa(value))
+	}
+}
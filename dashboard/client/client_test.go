@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestServer serves handler and returns a Client for it with token
+func newTestServer(t *testing.T, token string, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return New(server.URL+"/", token)
+}
+
+func TestListRuns(t *testing.T) {
+	var gotPath, gotQuery, gotAuth string
+	c := newTestServer(t, "secret", func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery, gotAuth = r.URL.Path, r.URL.RawQuery, r.Header.Get("Authorization")
+		w.Write([]byte(`[{"ID": 7, "Namespace": "prod", "Status": "ok"}]`))
+	})
+
+	runs, err := c.ListRuns(context.Background(), RunListOptions{
+		Namespace: "prod",
+		From:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Limit:     20,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].ID != 7 || runs[0].Namespace != "prod" {
+		t.Errorf("runs = %+v", runs)
+	}
+	if gotPath != "/api/runs" || gotQuery != "from=2024-01-02T03%3A04%3A05Z&limit=20&ns=prod" {
+		t.Errorf("request = %s?%s", gotPath, gotQuery)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("Authorization = %q, want the bearer token", gotAuth)
+	}
+}
+
+func TestGetRun(t *testing.T) {
+	c := newTestServer(t, "", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("Authorization sent without a token")
+		}
+		if r.URL.Query().Get("id") != "7" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "run not found: 8"}`))
+			return
+		}
+		w.Write([]byte(`{"run": {"ID": 7}, "fixes": []}`))
+	})
+
+	run, err := c.GetRun(context.Background(), 7)
+	if err != nil || run.ID != 7 {
+		t.Fatalf("GetRun(7) = %+v, %v", run, err)
+	}
+
+	_, err = c.GetRun(context.Background(), 8)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "run not found: 8" {
+		t.Errorf("GetRun(8): err = %v, want a 404 APIError", err)
+	}
+}
+
+func TestAPIErrorWithoutBody(t *testing.T) {
+	c := newTestServer(t, "", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	_, err := c.GetStats(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "Bad Gateway" {
+		t.Errorf("err = %v, want an APIError with the status text", err)
+	}
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Artifact is a file attached to a run. Data is only loaded by
+// GetRunArtifact.
+type Artifact struct {
+	ID          int       `json:"id"`
+	RunID       int       `json:"run_id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	Data        []byte    `json:"-"`
+}
+
+// AddRunArtifact attaches a file to a run, returning the new artifact's id
+func (db *DB) AddRunArtifact(runID int, name, contentType string, data []byte) (int64, error) {
+	var id int64
+	err := db.pool().QueryRow(`
+		INSERT INTO clopus_watcher_artifacts (run_id, name, content_type, size, data)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, runID, name, contentType, len(data), data).Scan(&id)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+		return 0, fmt.Errorf("%w: %d", ErrRunNotFound, runID)
+	}
+	return id, err
+}
+
+// GetRunArtifact returns an artifact including its data
+func (db *DB) GetRunArtifact(id int) (*Artifact, error) {
+	var a Artifact
+	err := db.retry(func() error {
+		return db.pool().QueryRow(`
+			SELECT id, run_id, name, content_type, size, created_at, data
+			FROM clopus_watcher_artifacts WHERE id = $1
+		`, id).Scan(&a.ID, &a.RunID, &a.Name, &a.ContentType, &a.Size, &a.CreatedAt, &a.Data)
+	})
+	if err != nil {
+		return nil, notFound(err, ErrArtifactNotFound, id)
+	}
+	return &a, nil
+}
+
+// ListRunArtifacts returns a run's artifacts without their data, oldest first
+func (db *DB) ListRunArtifacts(runID int) ([]Artifact, error) {
+	var artifacts []Artifact
+	err := db.retry(func() error {
+		artifacts = nil
+		rows, err := db.pool().Query(`
+			SELECT id, run_id, name, content_type, size, created_at
+			FROM clopus_watcher_artifacts WHERE run_id = $1
+			ORDER BY id
+		`, runID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var a Artifact
+			if err := rows.Scan(&a.ID, &a.RunID, &a.Name, &a.ContentType, &a.Size, &a.CreatedAt); err != nil {
+				return err
+			}
+			artifacts = append(artifacts, a)
+		}
+		return rows.Err()
+	})
+	return artifacts, err
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultNamespacesCacheTTL = 10 * time.Second
+
+// namespacesCache holds the last GetNamespaces result for a short TTL
+type namespacesCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	stats    []NamespaceStats
+	loadedAt time.Time
+	valid    bool
+	// gen counts invalidations, so a load that started before one doesn't
+	// cache its stale result after it
+	gen uint64
+}
+
+// SetNamespacesCacheTTL sets how long GetNamespaces results are reused.
+// Zero disables caching.
+func (db *DB) SetNamespacesCacheTTL(ttl time.Duration) {
+	db.nsCache.mu.Lock()
+	defer db.nsCache.mu.Unlock()
+	db.nsCache.ttl = ttl
+	db.nsCache.valid = false
+	db.nsCache.gen++
+}
+
+// get returns the cached result, or on a miss the generation to pass to set
+// once the caller has loaded a fresh one
+func (c *namespacesCache) get() ([]NamespaceStats, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.valid || time.Since(c.loadedAt) > c.ttl {
+		return nil, c.gen, false
+	}
+	return append([]NamespaceStats(nil), c.stats...), c.gen, true
+}
+
+// set caches stats loaded at generation gen, unless the cache was
+// invalidated since
+func (c *namespacesCache) set(stats []NamespaceStats, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl <= 0 || gen != c.gen {
+		return
+	}
+	c.stats = append([]NamespaceStats(nil), stats...)
+	c.loadedAt = time.Now()
+	c.valid = true
+}
+
+// invalidate drops the cached result so the next read sees new runs
+func (c *namespacesCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.valid = false
+	c.gen++
+}
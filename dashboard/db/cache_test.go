@@ -0,0 +1,54 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNamespacesCache(t *testing.T) {
+	c := namespacesCache{ttl: time.Minute}
+	if _, _, ok := c.get(); ok {
+		t.Fatal("empty cache hit")
+	}
+
+	_, gen, _ := c.get()
+	c.set([]NamespaceStats{{Namespace: "default"}}, gen)
+	stats, _, ok := c.get()
+	if !ok || len(stats) != 1 || stats[0].Namespace != "default" {
+		t.Fatalf("get = %v, %v, want the cached stats", stats, ok)
+	}
+
+	c.invalidate()
+	if _, _, ok := c.get(); ok {
+		t.Error("hit after invalidate")
+	}
+}
+
+// TestNamespacesCacheInvalidatedDuringLoad covers a load that starts before
+// a write invalidates the cache and finishes after: its result is stale and
+// must not be cached
+func TestNamespacesCacheInvalidatedDuringLoad(t *testing.T) {
+	c := namespacesCache{ttl: time.Minute}
+
+	_, gen, _ := c.get()
+	c.invalidate()
+	c.set([]NamespaceStats{{Namespace: "stale"}}, gen)
+	if stats, _, ok := c.get(); ok {
+		t.Errorf("cached %v loaded before the invalidation", stats)
+	}
+
+	_, gen, _ = c.get()
+	c.set([]NamespaceStats{{Namespace: "fresh"}}, gen)
+	if _, _, ok := c.get(); !ok {
+		t.Error("load after the invalidation was not cached")
+	}
+}
+
+func TestNamespacesCacheDisabled(t *testing.T) {
+	c := namespacesCache{}
+	_, gen, _ := c.get()
+	c.set([]NamespaceStats{{Namespace: "default"}}, gen)
+	if _, _, ok := c.get(); ok {
+		t.Error("hit with a zero TTL")
+	}
+}
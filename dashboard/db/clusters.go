@@ -0,0 +1,62 @@
+package db
+
+import (
+	"regexp"
+	"sort"
+)
+
+// ErrorCluster is a group of fix error messages that differ only in ids and
+// numbers
+type ErrorCluster struct {
+	Pattern string `json:"pattern"`
+	Count   int    `json:"count"`
+}
+
+var (
+	uuidPattern   = regexp.MustCompile(`(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+	digitsPattern = regexp.MustCompile(`[0-9]+`)
+)
+
+// normalizeErrorMessage replaces UUIDs and digit runs with placeholders
+func normalizeErrorMessage(msg string) string {
+	msg = uuidPattern.ReplaceAllString(msg, "<uuid>")
+	return digitsPattern.ReplaceAllString(msg, "<n>")
+}
+
+// GetErrorMessageClusters groups fix error messages by their normalized
+// pattern, most frequent first. An empty namespace means all namespaces.
+func (db *DB) GetErrorMessageClusters(namespace string, limit int) ([]ErrorCluster, error) {
+	args := db.newArgs()
+	query := `SELECT error_message, COUNT(*) FROM clopus_watcher_fixes WHERE error_message <> ''`
+	if namespace != "" {
+		query += ` AND namespace = ` + args.add(namespace)
+	}
+	query += ` GROUP BY error_message`
+
+	// Identical messages are grouped by the database; near duplicates are
+	// merged here, since normalizing needs the same rules on every driver
+	counts := make(map[string]int)
+	if err := db.countGrouped(query, counts, args.values...); err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]int)
+	for msg, n := range counts {
+		merged[normalizeErrorMessage(msg)] += n
+	}
+
+	clusters := make([]ErrorCluster, 0, len(merged))
+	for pattern, n := range merged {
+		clusters = append(clusters, ErrorCluster{Pattern: pattern, Count: n})
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Count != clusters[j].Count {
+			return clusters[i].Count > clusters[j].Count
+		}
+		return clusters[i].Pattern < clusters[j].Pattern
+	})
+	if limit > 0 && len(clusters) > limit {
+		clusters = clusters[:limit]
+	}
+	return clusters, nil
+}
@@ -0,0 +1,18 @@
+package db
+
+import "testing"
+
+func TestNormalizeErrorMessage(t *testing.T) {
+	tests := map[string]string{
+		"back-off 5m0s restarting failed container":                     "back-off <n>m<n>s restarting failed container",
+		"pod 3f2b8c1e-9d4a-4e6b-8f00-1234567890ab OOMKilled":            "pod <uuid> OOMKilled",
+		"pod 3F2B8C1E-9D4A-4E6B-8F00-1234567890AB exited with code 137": "pod <uuid> exited with code <n>",
+		"connection refused": "connection refused",
+		"dial tcp 10.0.0.12:5432: connect: connection refused": "dial tcp <n>.<n>.<n>.<n>:<n>: connect: connection refused",
+	}
+	for in, want := range tests {
+		if got := normalizeErrorMessage(in); got != want {
+			t.Errorf("normalizeErrorMessage(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Supported database drivers. Postgres is the default; sqlite is meant for
+// local development and only covers the core run and fix queries, not the
+// analytics that rely on Postgres functions.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// sqliteDriverName is the name the query-rewriting sqlite wrapper is
+// registered under, see sqlite.go
+const sqliteDriverName = "clopus-sqlite"
+
+// ParseDriver picks the driver for dsn. An explicit driver wins, otherwise a
+// "sqlite:" prefix selects sqlite. The returned dsn has that prefix removed.
+func ParseDriver(driverName, dsn string) (string, string) {
+	if strings.HasPrefix(dsn, "sqlite:") {
+		return DriverSQLite, strings.TrimPrefix(dsn, "sqlite:")
+	}
+	if driverName == DriverSQLite {
+		return DriverSQLite, dsn
+	}
+	return DriverPostgres, dsn
+}
+
+// openPool opens a connection pool for driverName. A positive slowQuery
+// wraps the driver to log queries slower than it.
+func openPool(driverName, dsn string, slowQuery time.Duration) (*sql.DB, error) {
+	conn, err := openDriverPool(driverName, dsn)
+	if err != nil || slowQuery <= 0 {
+		return conn, err
+	}
+	return wrapSlowQueries(conn, dsn, slowQuery), nil
+}
+
+func openDriverPool(driverName, dsn string) (*sql.DB, error) {
+	if driverName != DriverSQLite {
+		return sql.Open("postgres", dsn)
+	}
+	for _, name := range sql.Drivers() {
+		if name == sqliteDriverName {
+			return sql.Open(sqliteDriverName, dsn)
+		}
+	}
+	return nil, fmt.Errorf("sqlite support is not compiled in, build with -tags sqlite")
+}
+
+// sqliteDriver wraps a sqlite driver so queries written for Postgres run
+// unchanged. Only Prepare is exposed on its connections, so database/sql
+// routes every query and exec through the rewrite.
+type sqliteDriver struct {
+	driver.Driver
+}
+
+func (d sqliteDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	// Writers on other connections wait for the lock instead of failing
+	// straight away with SQLITE_BUSY
+	stmt, err := conn.Prepare(`PRAGMA busy_timeout = 5000`)
+	if err == nil {
+		_, err = stmt.Exec(nil)
+		stmt.Close()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return sqliteConn{conn}, nil
+}
+
+type sqliteConn struct {
+	driver.Conn
+}
+
+func (c sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebindSQLite(query))
+}
+
+var (
+	pgPlaceholder = regexp.MustCompile(`\$(\d+)`)
+	pgCast        = regexp.MustCompile(`::[a-z]+`)
+	sqliteRewrite = strings.NewReplacer("NOW()", "CURRENT_TIMESTAMP", "ILIKE", "LIKE", "pg_column_size(", "length(")
+)
+
+// rebindSQLite translates Postgres syntax used by this package to sqlite:
+// $n placeholders become ?n, NOW() becomes CURRENT_TIMESTAMP, ILIKE becomes
+// LIKE (case-insensitive for ASCII in sqlite), pg_column_size becomes length
+// and ::type casts are dropped.
+func rebindSQLite(query string) string {
+	query = pgPlaceholder.ReplaceAllString(query, "?$1")
+	query = pgCast.ReplaceAllString(query, "")
+	return sqliteRewrite.Replace(query)
+}
+
+// initSQLiteSchema creates the tables in a sqlite database. Set by sqlite.go
+// when sqlite support is compiled in.
+var initSQLiteSchema = func(conn *sql.DB) error { return nil }
+
+// queryArgs collects the arguments of a dynamically built query and emits
+// placeholders in the active driver's syntax
+type queryArgs struct {
+	driver string
+	values []interface{}
+}
+
+func (db *DB) newArgs() *queryArgs {
+	return &queryArgs{driver: db.driver}
+}
+
+// add appends v and returns its placeholder: $n for Postgres, ? for sqlite
+func (a *queryArgs) add(v interface{}) string {
+	a.values = append(a.values, v)
+	if a.driver == DriverSQLite {
+		return "?"
+	}
+	return fmt.Sprintf("$%d", len(a.values))
+}
+
+// list appends each of values and returns a parenthesised placeholder list
+// for IN; values must not be empty
+func (a *queryArgs) list(values []string) string {
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		placeholders[i] = a.add(v)
+	}
+	return "(" + strings.Join(placeholders, ", ") + ")"
+}
+
+// sqliteTimeFormats are the text forms sqlite timestamps take: the driver's
+// own for bound time.Time values, then CURRENT_TIMESTAMP's
+var sqliteTimeFormats = []string{"2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05", time.RFC3339Nano}
+
+// nullTime is sql.NullTime that also accepts sqlite's text timestamps.
+// sqlite only converts columns declared as timestamps, so aggregates such as
+// MAX(started_at) arrive as strings.
+type nullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+func (t *nullTime) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		t.Time, t.Valid = time.Time{}, false
+		return nil
+	case time.Time:
+		t.Time, t.Valid = v, true
+		return nil
+	case []byte:
+		src = string(v)
+	}
+
+	s, ok := src.(string)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into a timestamp", src)
+	}
+	for _, layout := range sqliteTimeFormats {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			t.Time, t.Valid = parsed, true
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot parse timestamp %q", s)
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryArgs(t *testing.T) {
+	tests := []struct {
+		driver string
+		want   string
+	}{
+		{DriverPostgres, "ns = $1 AND status IN ($2, $3)"},
+		{DriverSQLite, "ns = ? AND status IN (?, ?)"},
+	}
+	for _, tt := range tests {
+		args := &queryArgs{driver: tt.driver}
+		got := "ns = " + args.add("default") + " AND status IN " + args.list([]string{"ok", "fixed"})
+		if got != tt.want {
+			t.Errorf("%s: query = %q, want %q", tt.driver, got, tt.want)
+		}
+		if len(args.values) != 3 || args.values[0] != "default" || args.values[2] != "fixed" {
+			t.Errorf("%s: values = %v", tt.driver, args.values)
+		}
+	}
+}
+
+func TestRebindSQLite(t *testing.T) {
+	tests := map[string]string{
+		`SELECT * FROM t WHERE a = $1 AND b = $12`:          `SELECT * FROM t WHERE a = ?1 AND b = ?12`,
+		`UPDATE t SET at = NOW() WHERE id = $1`:             `UPDATE t SET at = CURRENT_TIMESTAMP WHERE id = ?1`,
+		`SELECT name FROM t WHERE name ILIKE $1`:            `SELECT name FROM t WHERE name LIKE ?1`,
+		`SELECT COUNT(*)::int, AVG(x)::float FROM t`:        `SELECT COUNT(*), AVG(x) FROM t`,
+		`SELECT SUM(pg_column_size(log)) FROM t`:            `SELECT SUM(length(log)) FROM t`,
+		`SELECT id FROM t WHERE status = 'running' LIMIT 1`: `SELECT id FROM t WHERE status = 'running' LIMIT 1`,
+	}
+	for in, want := range tests {
+		if got := rebindSQLite(in); got != want {
+			t.Errorf("rebindSQLite(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNullTimeScan(t *testing.T) {
+	want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, src := range []interface{}{
+		want,
+		"2024-01-02 03:04:05",
+		"2024-01-02 03:04:05+00:00",
+		[]byte("2024-01-02T03:04:05Z"),
+	} {
+		var got nullTime
+		if err := got.Scan(src); err != nil || !got.Valid || !got.Time.Equal(want) {
+			t.Errorf("Scan(%v) = %v, %v; want %v", src, got, err, want)
+		}
+	}
+
+	var got nullTime
+	if err := got.Scan(nil); err != nil || got.Valid {
+		t.Errorf("Scan(nil) = %v, %v; want invalid", got, err)
+	}
+	for _, src := range []interface{}{"yesterday", int64(1)} {
+		if err := got.Scan(src); err == nil {
+			t.Errorf("Scan(%v) succeeded, want an error", src)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors for lookups by id. Check with errors.Is; the returned
+// errors wrap these with the id that was not found.
+var (
+	ErrRunNotFound       = errors.New("run not found")
+	ErrFixNotFound       = errors.New("fix not found")
+	ErrArtifactNotFound  = errors.New("artifact not found")
+	ErrNamespaceNotFound = errors.New("namespace not found")
+)
+
+// ErrRunNotRunning is returned when completing a run that already finished
+var ErrRunNotRunning = errors.New("run is not running")
+
+// ErrInvalidMode is returned for a watcher mode not in Modes
+var ErrInvalidMode = errors.New("invalid mode")
+
+// ErrInvalidFixStatus is returned for a fix status not in FixStatuses
+var ErrInvalidFixStatus = errors.New("invalid fix status")
+
+// ErrInvalidRunUpdate is returned by UpdateRun for fields it can't set
+var ErrInvalidRunUpdate = errors.New("invalid run update")
+
+// ErrInvalidDays is returned for a day window outside what a query allows
+var ErrInvalidDays = errors.New("invalid days")
+
+// notFound maps sql.ErrNoRows to the given sentinel, leaving other errors as is
+func notFound(err error, sentinel error, id interface{}) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %v", sentinel, id)
+	}
+	return err
+}
@@ -0,0 +1,22 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestNotFound(t *testing.T) {
+	err := notFound(sql.ErrNoRows, ErrRunNotFound, 42)
+	if !errors.Is(err, ErrRunNotFound) || err.Error() != "run not found: 42" {
+		t.Errorf("notFound(ErrNoRows) = %v, want ErrRunNotFound for 42", err)
+	}
+
+	other := errors.New("connection reset")
+	if err := notFound(other, ErrRunNotFound, 42); err != other {
+		t.Errorf("notFound(other) = %v, want the error unchanged", err)
+	}
+	if err := notFound(nil, ErrRunNotFound, 42); err != nil {
+		t.Errorf("notFound(nil) = %v, want nil", err)
+	}
+}
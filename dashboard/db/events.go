@@ -0,0 +1,73 @@
+package db
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// RunEvent is a status a run entered, for the run timeline
+type RunEvent struct {
+	ID        int       `json:"id"`
+	RunID     int       `json:"run_id"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RecordRunEvent records that a run entered status. The insert isn't
+// idempotent, so unlike reads it is never retried: a retry after a commit
+// whose acknowledgement was lost would duplicate the timeline entry.
+func (db *DB) RecordRunEvent(runID int, status string) error {
+	_, err := db.pool().Exec(`
+		INSERT INTO clopus_watcher_run_events (run_id, status) VALUES ($1, $2)
+	`, runID, status)
+	return err
+}
+
+// recordRunEvent is RecordRunEvent for callers that already changed the run:
+// a missing timeline entry shouldn't fail the change, so errors are logged
+func (db *DB) recordRunEvent(runID int64, status string) {
+	if err := db.RecordRunEvent(int(runID), status); err != nil {
+		slog.Warn("failed to record run event", "run_id", runID, "status", status, "error", err)
+	}
+}
+
+// GetRunEvents returns a run's status changes, oldest first. A run without
+// events (e.g. imported) gets none; a missing run is ErrRunNotFound.
+func (db *DB) GetRunEvents(runID int) ([]RunEvent, error) {
+	var events []RunEvent
+	err := db.retry(func() error {
+		events = nil
+		rows, err := db.pool().Query(`
+			SELECT id, run_id, status, created_at
+			FROM clopus_watcher_run_events WHERE run_id = $1
+			ORDER BY created_at, id
+		`, runID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var e RunEvent
+			if err := rows.Scan(&e.ID, &e.RunID, &e.Status, &e.CreatedAt); err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+		return rows.Err()
+	})
+	if err != nil || len(events) > 0 {
+		return events, err
+	}
+
+	var exists bool
+	err = db.pool().QueryRow(`SELECT EXISTS(SELECT 1 FROM clopus_watcher_runs WHERE id = $1 AND deleted_at IS NULL)`, runID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %d", ErrRunNotFound, runID)
+	}
+	return events, nil
+}
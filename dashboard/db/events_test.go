@@ -0,0 +1,54 @@
+//go:build sqlite
+
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGetRunEvents(t *testing.T) {
+	db := openTestDB(t)
+	id := addRun(t, db, "default")
+	if err := db.UpdateRun(id, map[string]interface{}{"status": "failed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateRun(id, map[string]interface{}{"status": "fixed"}); !errors.Is(err, ErrRunNotRunning) {
+		t.Fatalf("reopening: err = %v, want ErrRunNotRunning", err)
+	}
+	if err := db.UpdateRun(id, map[string]interface{}{"report": "no status change"}); err != nil {
+		t.Fatal(err)
+	}
+	retry, err := db.RetryRun(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := db.GetRunEvents(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []string
+	for _, e := range events {
+		if e.RunID != int(id) || e.CreatedAt.IsZero() {
+			t.Errorf("event = %+v", e)
+		}
+		statuses = append(statuses, e.Status)
+	}
+	if got := strings.Join(statuses, ","); got != "running,failed" {
+		t.Errorf("timeline = %s, want running,failed", got)
+	}
+
+	events, err = db.GetRunEvents(int(retry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Status != "running" {
+		t.Errorf("retry timeline = %+v, want one running event", events)
+	}
+
+	if _, err := db.GetRunEvents(int(retry) + 1); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("GetRunEvents(missing): err = %v, want ErrRunNotFound", err)
+	}
+}
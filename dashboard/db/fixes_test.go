@@ -0,0 +1,324 @@
+//go:build sqlite
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// addFix records a fix against runID, failing the test on error
+func addFix(t *testing.T, db *DB, runID int64, namespace, pod, status string) int64 {
+	t.Helper()
+	id, _, err := db.CreateFix(Fix{RunID: int(runID), Namespace: namespace, PodName: pod, ErrorType: "CrashLoopBackOff", Status: status})
+	if err != nil {
+		t.Fatalf("CreateFix: %v", err)
+	}
+	return id
+}
+
+// addRun starts a run in namespace, failing the test on error
+func addRun(t *testing.T, db *DB, namespace string) int64 {
+	t.Helper()
+	id, err := db.CreateRun(namespace, ModeAutonomous)
+	if err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+	return id
+}
+
+func TestGetTopPods(t *testing.T) {
+	db := openTestDB(t)
+	run := addRun(t, db, "default")
+	other := addRun(t, db, "other")
+	for _, status := range []string{"success", "failed", "failed"} {
+		addFix(t, db, run, "default", "api", status)
+	}
+	addFix(t, db, run, "default", "web", "success")
+	for i := 0; i < 5; i++ {
+		addFix(t, db, other, "other", "worker", "success")
+	}
+
+	pods, err := db.GetTopPods("default", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PodFixCount{{"api", 3, 2}, {"web", 1, 0}}
+	if len(pods) != len(want) || pods[0] != want[0] || pods[1] != want[1] {
+		t.Errorf("GetTopPods(default) = %+v, want %+v", pods, want)
+	}
+
+	pods, err = db.GetTopPods("", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods) != 1 || pods[0].PodName != "worker" {
+		t.Errorf("GetTopPods(all, 1) = %+v, want worker only", pods)
+	}
+}
+
+func TestGetFixesByPod(t *testing.T) {
+	db := openTestDB(t)
+	run := addRun(t, db, "default")
+	for _, pod := range []string{"api-7d9f-abc", "api-7d9f-def", "api-worker-1", "web-1", "api_x"} {
+		addFix(t, db, run, "default", pod, "success")
+	}
+
+	tests := []struct {
+		pod    string
+		prefix bool
+		limit  int
+		want   int
+	}{
+		{"api-7d9f-abc", false, 10, 1},
+		{"api-7d9f", false, 10, 0},
+		{"api-7d9f", true, 10, 2},
+		{"api-", true, 10, 3},
+		{"api-", true, 2, 2},
+		{"api_", true, 10, 1},
+		{"web-1", true, 10, 1},
+	}
+	for _, tt := range tests {
+		fixes, err := db.GetFixesByPod(tt.pod, tt.prefix, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fixes) != tt.want {
+			t.Errorf("GetFixesByPod(%q, prefix %v) returned %d fixes, want %d", tt.pod, tt.prefix, len(fixes), tt.want)
+		}
+	}
+}
+
+func TestGetFixCount(t *testing.T) {
+	db := openTestDB(t)
+	run := addRun(t, db, "default")
+	for _, status := range []string{"success", "success", "failed"} {
+		addFix(t, db, run, "default", "api", status)
+	}
+	addFix(t, db, addRun(t, db, "other"), "other", "api", "success")
+
+	for _, tt := range []struct {
+		filter FixFilter
+		want   int
+	}{
+		{FixFilter{}, 4},
+		{FixFilter{Namespace: "default"}, 3},
+		{FixFilter{Namespace: "default", Status: "success", Limit: 1, Offset: 1}, 2},
+	} {
+		n, err := db.GetFixCount(tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != tt.want {
+			t.Errorf("GetFixCount(%+v) = %d, want %d", tt.filter, n, tt.want)
+		}
+	}
+}
+
+func TestGetErrorMessageClusters(t *testing.T) {
+	db := openTestDB(t)
+	run := addRun(t, db, "default")
+	for _, fix := range []struct{ namespace, msg string }{
+		{"default", "exit code 137"},
+		{"default", "exit code 137"},
+		{"default", "exit code 1"},
+		{"default", "image pull failed"},
+		{"default", ""},
+		{"other", "exit code 2"},
+	} {
+		_, _, err := db.CreateFix(Fix{RunID: int(run), Namespace: fix.namespace, PodName: "api", ErrorType: "CrashLoopBackOff", ErrorMessage: fix.msg})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clusters, err := db.GetErrorMessageClusters("default", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ErrorCluster{{"exit code <n>", 3}, {"image pull failed", 1}}
+	if len(clusters) != len(want) || clusters[0] != want[0] || clusters[1] != want[1] {
+		t.Errorf("clusters = %+v, want %+v", clusters, want)
+	}
+
+	clusters, err = db.GetErrorMessageClusters("", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 1 || clusters[0] != (ErrorCluster{"exit code <n>", 4}) {
+		t.Errorf("all namespaces, limit 1 = %+v", clusters)
+	}
+}
+
+func TestCreateFixDedup(t *testing.T) {
+	db := openTestDB(t)
+	db.SetFixDedupWindow(time.Hour)
+	run := addRun(t, db, "default")
+	fix := Fix{RunID: int(run), Namespace: "default", PodName: "api", ErrorType: "OOMKilled", FixApplied: "raised memory limit"}
+
+	first, deduped, err := db.CreateFix(fix)
+	if err != nil || deduped {
+		t.Fatalf("first CreateFix = %d, deduped %v, %v", first, deduped, err)
+	}
+	if id, deduped, err := db.CreateFix(fix); err != nil || !deduped || id != 0 {
+		t.Errorf("identical CreateFix = %d, deduped %v, %v; want deduped", id, deduped, err)
+	}
+
+	for name, other := range map[string]Fix{
+		"other pod":  {RunID: fix.RunID, Namespace: "default", PodName: "web", ErrorType: fix.ErrorType, FixApplied: fix.FixApplied},
+		"other fix":  {RunID: fix.RunID, Namespace: "default", PodName: fix.PodName, ErrorType: fix.ErrorType, FixApplied: "restarted"},
+		"other run":  {RunID: int(addRun(t, db, "default")), Namespace: "default", PodName: fix.PodName, ErrorType: fix.ErrorType, FixApplied: fix.FixApplied},
+		"other type": {RunID: fix.RunID, Namespace: "default", PodName: fix.PodName, ErrorType: "CrashLoopBackOff", FixApplied: fix.FixApplied},
+	} {
+		if _, deduped, err := db.CreateFix(other); err != nil || deduped {
+			t.Errorf("%s: deduped %v, %v; want inserted", name, deduped, err)
+		}
+	}
+
+	db.SetFixDedupWindow(0)
+	if _, deduped, err := db.CreateFix(fix); err != nil || deduped {
+		t.Errorf("without a window: deduped %v, %v; want inserted", deduped, err)
+	}
+}
+
+// TestCreateFixDedupConcurrent races identical fixes: exactly one of them
+// may be inserted
+func TestCreateFixDedupConcurrent(t *testing.T) {
+	db := openTestDB(t)
+	db.SetFixDedupWindow(time.Hour)
+	fix := Fix{RunID: int(addRun(t, db, "default")), Namespace: "default", PodName: "api", ErrorType: "OOMKilled"}
+
+	const n = 8
+	var wg sync.WaitGroup
+	var inserted atomic.Int32
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, deduped, err := db.CreateFix(fix)
+			if err != nil {
+				t.Errorf("CreateFix: %v", err)
+				return
+			}
+			if !deduped {
+				inserted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	fixes, err := db.GetFixesByRun(fix.RunID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted.Load() != 1 || len(fixes) != 1 {
+		t.Errorf("%d inserts reported, %d fixes stored; want 1", inserted.Load(), len(fixes))
+	}
+}
+
+// TestUpdateFixStatusBatch covers the paths that don't reach the Postgres
+// ANY query: validation and the empty id list
+func TestUpdateFixStatusBatch(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.UpdateFixStatusBatch([]int{1}, "done"); !errors.Is(err, ErrInvalidFixStatus) {
+		t.Errorf("unknown status: err = %v, want ErrInvalidFixStatus", err)
+	}
+	n, err := db.UpdateFixStatusBatch(nil, "success")
+	if err != nil || n != 0 {
+		t.Errorf("empty ids = %d, %v; want 0, nil", n, err)
+	}
+}
+
+func TestGetRecentFixes(t *testing.T) {
+	db := openTestDB(t)
+	runID := addRun(t, db, "default")
+	recent := addFix(t, db, runID, "default", "api", "success")
+	other := addFix(t, db, addRun(t, db, "prod"), "prod", "worker", "pending")
+	old := addFix(t, db, runID, "default", "web", "failed")
+	if _, err := db.pool().Exec(`UPDATE clopus_watcher_fixes SET timestamp = $1 WHERE id = $2`, time.Now().Add(-2*time.Hour), old); err != nil {
+		t.Fatal(err)
+	}
+
+	fixes, err := db.GetRecentFixes(time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[int]bool{}
+	for _, f := range fixes {
+		ids[f.ID] = true
+	}
+	if len(fixes) != 2 || !ids[int(recent)] || !ids[int(other)] {
+		t.Errorf("recent fixes = %+v, want %d and %d across namespaces", fixes, recent, other)
+	}
+
+	if fixes, err = db.GetRecentFixes(3*time.Hour, 1); err != nil || len(fixes) != 1 {
+		t.Errorf("limit 1: %d fixes, %v", len(fixes), err)
+	}
+}
+
+func TestGetFixesByRunPaged(t *testing.T) {
+	db := openTestDB(t)
+	runID := addRun(t, db, "default")
+	var ids []int
+	for i := 0; i < 5; i++ {
+		ids = append(ids, int(addFix(t, db, runID, "default", "api", "success")))
+	}
+	addFix(t, db, addRun(t, db, "default"), "default", "api", "success")
+
+	tests := []struct {
+		limit, offset int
+		want          []int
+	}{
+		{2, 0, []int{ids[4], ids[3]}},
+		{2, 2, []int{ids[2], ids[1]}},
+		{2, 4, []int{ids[0]}},
+		{2, 6, nil},
+	}
+	for _, tt := range tests {
+		fixes, err := db.GetFixesByRunPaged(int(runID), tt.limit, tt.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for _, f := range fixes {
+			got = append(got, f.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("limit %d offset %d = %v, want %v", tt.limit, tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestGetStatsWindow(t *testing.T) {
+	db := openTestDB(t)
+	runID := addRun(t, db, "default")
+	addFix(t, db, runID, "default", "api", "success")
+	addFix(t, db, runID, "default", "web", "pending")
+	old := addFix(t, db, runID, "default", "worker", "failed")
+	if _, err := db.pool().Exec(`UPDATE clopus_watcher_fixes SET timestamp = $1 WHERE id = $2`, time.Now().Add(-48*time.Hour), old); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := db.GetStatsStruct()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *all != (Stats{Total: 3, Success: 1, Failed: 1, Pending: 1}) {
+		t.Errorf("all-time stats = %+v", all)
+	}
+	day, err := db.GetStatsWindow(24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *day != (Stats{Total: 2, Success: 1, Pending: 1}) {
+		t.Errorf("last day stats = %+v, want the old failed fix left out", day)
+	}
+	week, err := db.GetStatsWindow(7 * 24 * time.Hour)
+	if err != nil || *week != *all {
+		t.Errorf("last week stats = %+v, %v; want the all-time totals", week, err)
+	}
+}
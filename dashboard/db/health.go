@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// healthState records the outcome of the most recent health check
+type healthState struct {
+	mu      sync.RWMutex
+	healthy bool
+	err     error
+}
+
+func (h *healthState) set(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.healthy = err == nil
+	h.err = err
+}
+
+// pool returns the current connection pool
+func (db *DB) pool() *sql.DB {
+	db.connMu.RLock()
+	defer db.connMu.RUnlock()
+	return db.conn
+}
+
+// Healthy reports whether the last health check succeeded, with its error
+// when it did not
+func (db *DB) Healthy() (bool, error) {
+	db.health.mu.RLock()
+	defer db.health.mu.RUnlock()
+	return db.health.healthy, db.health.err
+}
+
+// StartHealthLoop pings the database, and the replica when one is set,
+// every interval until ctx is cancelled. When a ping fails the pool is
+// recreated, since after a Postgres restart the pooled connections can stay
+// stale until the process restarts.
+func (db *DB) StartHealthLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			db.checkHealth(ctx, interval)
+			db.checkReplicaHealth(ctx, interval)
+		}
+	}
+}
+
+func (db *DB) checkHealth(ctx context.Context, timeout time.Duration) {
+	pingCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := db.Ping(pingCtx)
+	if err == nil {
+		db.health.set(nil)
+		return
+	}
+
+	slog.Warn("database ping failed, reconnecting", "error", err)
+	if rerr := db.reconnect(pingCtx, db.dsn, &db.conn); rerr != nil {
+		slog.Error("database reconnect failed", "error", rerr)
+		db.health.set(rerr)
+		return
+	}
+	slog.Info("database reconnected")
+	db.health.set(nil)
+}
+
+// checkReplicaHealth is checkHealth for the replica. Its failures are only
+// logged: readiness follows the primary.
+func (db *DB) checkReplicaHealth(ctx context.Context, timeout time.Duration) {
+	replica := db.replicaPool()
+	if replica == nil {
+		return
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := replica.PingContext(pingCtx)
+	if err == nil {
+		return
+	}
+
+	slog.Warn("replica ping failed, reconnecting", "error", err)
+	if rerr := db.reconnect(pingCtx, db.replicaDSN, &db.replica); rerr != nil {
+		slog.Error("replica reconnect failed", "error", rerr)
+		return
+	}
+	slog.Info("replica reconnected")
+}
+
+// reconnect opens a fresh pool for dsn and swaps it into pool, db.conn or
+// db.replica, once it answers a ping
+func (db *DB) reconnect(ctx context.Context, dsn string, pool **sql.DB) error {
+	conn, err := openPool(db.driver, dsn, db.slowQuery)
+	if err != nil {
+		return err
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// Statements were prepared on the old pool. Drop them in the same
+	// critical section as the swap, so prepared() can't hand out one bound
+	// to the old pool; stmtMu is taken before connMu, as prepared() does.
+	db.stmtMu.Lock()
+	db.connMu.Lock()
+	old := *pool
+	*pool = conn
+	db.connMu.Unlock()
+	stmts := db.stmts
+	db.stmts = nil
+	db.stmtMu.Unlock()
+
+	for _, stmt := range stmts {
+		stmt.Close()
+	}
+	old.Close()
+	return nil
+}
@@ -0,0 +1,64 @@
+//go:build sqlite
+
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCheckHealthReconnects fails the primary's pings, first while the
+// database is unreachable and then once it is back
+func TestCheckHealthReconnects(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	if _, err := db.prepared(`SELECT COUNT(*) FROM clopus_watcher_runs`, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unreachable: the ping fails and so does the reconnect
+	dsn := db.dsn
+	db.dsn = filepath.Join(t.TempDir(), "missing", "test.db")
+	db.pool().Close()
+	db.checkHealth(ctx, time.Second)
+	if ok, err := db.Healthy(); ok || err == nil {
+		t.Fatalf("Healthy = %v, %v after a failed reconnect, want false with an error", ok, err)
+	}
+
+	// Back: the next check swaps in a fresh pool
+	db.dsn = dsn
+	db.checkHealth(ctx, time.Second)
+	if ok, err := db.Healthy(); !ok {
+		t.Fatalf("Healthy = %v, %v after recovery", ok, err)
+	}
+	if db.stmts != nil {
+		t.Error("statements prepared on the old pool were kept")
+	}
+	if _, err := db.CreateRun("default", ModeReport); err != nil {
+		t.Errorf("CreateRun after reconnect: %v", err)
+	}
+}
+
+func TestCheckReplicaHealthReconnects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(DriverSQLite, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.SetReplica(path); err != nil {
+		t.Fatal(err)
+	}
+
+	old := db.replicaPool()
+	old.Close()
+	db.checkReplicaHealth(context.Background(), time.Second)
+	if db.replicaPool() == old {
+		t.Fatal("replica pool was not replaced")
+	}
+	if _, err := db.GetRuns("", 10); err != nil {
+		t.Errorf("GetRuns on the new replica: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+//go:build sqlite
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeResult writes a watcher result file for run id in dir
+func writeResult(t testing.TB, dir string, id int, namespace string) {
+	t.Helper()
+	data := fmt.Sprintf(`{"id": %d, "started_at": "2024-01-02T03:04:05Z", "ended_at": "2024-01-02T03:05:05Z",
+		"namespace": %q, "mode": "autonomous", "status": "ok", "pod_count": 3}`, id, namespace)
+	if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("run_%d.json", id)), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportJSONResults(t *testing.T) {
+	db := openTestDB(t)
+	dir := t.TempDir()
+	for id := 1; id <= 3; id++ {
+		writeResult(t, dir, id, "default")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "run_bad.json"), []byte("{\n  \"id\": \"x\"\n}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := db.ImportJSONResults(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Files != 4 || res.Imported != 3 || res.Skipped != 0 || len(res.Errors) != 1 {
+		t.Fatalf("first import = %+v", res)
+	}
+	var ie *ImportError
+	if !errors.As(res.Errors[0], &ie) || ie.Line != 2 || ie.Field != "id" {
+		t.Errorf("invalid file error = %v, want line 2, field id", res.Errors[0])
+	}
+
+	res, err = db.ImportJSONResults(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Imported != 0 || res.Skipped != 3 {
+		t.Errorf("second import = %+v, want every run skipped", res)
+	}
+}
+
+// TestImportJSONResultsNotifies checks only runs that ended after the
+// import cursor reach OnRunComplete, not the backfilled history
+func TestImportJSONResultsNotifies(t *testing.T) {
+	db := openTestDB(t)
+	var completed []int
+	db.OnRunComplete(func(run Run) { completed = append(completed, run.ID) })
+
+	dir := t.TempDir()
+	writeResult(t, dir, 1, "default")
+	ended := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+	data := fmt.Sprintf(`{"id": 2, "started_at": %q, "ended_at": %q, "namespace": "default", "mode": "autonomous", "status": "failed"}`, ended, ended)
+	if err := os.WriteFile(filepath.Join(dir, "run_2.json"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err := db.ImportJSONResults(dir); err != nil || res.Imported != 2 {
+		t.Fatalf("import = %+v, %v", res, err)
+	}
+	if len(completed) != 1 || completed[0] != 2 {
+		t.Errorf("OnRunComplete calls for runs %v, want only the new run 2", completed)
+	}
+}
+
+func TestImportJSONResultsGlob(t *testing.T) {
+	db := openTestDB(t)
+	dir := t.TempDir()
+	writeResult(t, dir, 1, "default")
+	for id := 2; id <= 3; id++ {
+		data := fmt.Sprintf(`{"id": %d, "started_at": "2024-01-02T03:04:05Z", "namespace": "default", "mode": "report", "status": "ok"}`, id)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("scan-%d.result.json", id)), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.SetResultsGlob("scan-*.result.json"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := db.ImportJSONResults(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Files != 2 || res.Imported != 2 {
+		t.Errorf("import with custom glob = %+v, want only the 2 scan files", res)
+	}
+	if _, err := db.GetRun(1); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("run_1.json imported with a custom glob: err = %v", err)
+	}
+}
+
+// TestImportJSONResultsBatchFailure checks that one run the database rejects
+// fails only its own file, not the rest of its batch
+func TestImportJSONResultsBatchFailure(t *testing.T) {
+	db := openTestDB(t)
+	_, err := db.pool().Exec(`
+		CREATE TRIGGER reject_bad BEFORE INSERT ON clopus_watcher_runs
+		WHEN NEW.namespace = 'bad'
+		BEGIN SELECT RAISE(ABORT, 'bad namespace'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for id := 1; id <= 5; id++ {
+		namespace := "default"
+		if id == 3 {
+			namespace = "bad"
+		}
+		writeResult(t, dir, id, namespace)
+	}
+
+	res, err := db.ImportJSONResults(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Imported != 4 || len(res.Errors) != 1 {
+		t.Fatalf("import = %+v, want 4 imported and 1 error", res)
+	}
+	var ie *ImportError
+	if !errors.As(res.Errors[0], &ie) || filepath.Base(ie.File) != "run_3.json" {
+		t.Errorf("error = %v, want one for run_3.json", res.Errors[0])
+	}
+}
+
+// TestImportJSONResultsRenumber imports two watchers' results whose run ids
+// collide: kept ids skip the second watcher's run, renumbering imports both
+func TestImportJSONResultsRenumber(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	writeResult(t, first, 1, "default")
+	writeResult(t, second, 1, "prod")
+
+	for _, renumber := range []bool{false, true} {
+		db := openTestDB(t)
+		db.SetImportRenumber(renumber)
+		if res, err := db.ImportJSONResults(first); err != nil || res.Imported != 1 {
+			t.Fatalf("renumber %v: first import = %+v, %v", renumber, res, err)
+		}
+		res, err := db.ImportJSONResults(second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := ImportResult{Files: 1, Skipped: 1}
+		if renumber {
+			want = ImportResult{Files: 1, Imported: 1}
+		}
+		if res.Files != want.Files || res.Imported != want.Imported || res.Skipped != want.Skipped {
+			t.Errorf("renumber %v: second import = %+v, want %+v", renumber, res, want)
+		}
+		if !renumber {
+			continue
+		}
+
+		var runs, ids int
+		err = db.pool().QueryRow(`SELECT COUNT(*), COUNT(DISTINCT id) FROM clopus_watcher_runs WHERE external_id = 1`).Scan(&runs, &ids)
+		if err != nil || runs != 2 || ids != 2 {
+			t.Errorf("runs with external_id 1 = %d under %d ids, %v; want 2 distinct", runs, ids, err)
+		}
+		if res, err := db.ImportJSONResults(second); err != nil || res.Imported != 0 || res.Skipped != 1 {
+			t.Errorf("re-import = %+v, %v; want the run skipped", res, err)
+		}
+	}
+}
+
+// TestImportJSONResultsRenumberMissingStart checks that a renumbered file
+// without started_at is imported once, not again on every pass
+func TestImportJSONResultsRenumberMissingStart(t *testing.T) {
+	db := openTestDB(t)
+	db.SetImportRenumber(true)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "run_1.json")
+	if err := os.WriteFile(file, []byte(`{"id": 1, "namespace": "default", "mode": "report", "status": "ok"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(file, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	for pass, want := range []int{1, 0} {
+		res, err := db.ImportJSONResults(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Imported != want || len(res.Errors) != 0 {
+			t.Fatalf("pass %d: import = %+v, want %d imported", pass+1, res, want)
+		}
+	}
+
+	runs, err := db.GetRuns("default", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || !runs[0].StartedAtTime.Equal(modified) {
+		t.Errorf("runs = %+v, want one run started at the file's mtime", runs)
+	}
+}
+
+func BenchmarkImportJSONResults(b *testing.B) {
+	dir := b.TempDir()
+	for id := 1; id <= 1000; id++ {
+		writeResult(b, dir, id, "default")
+	}
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		db := openTestDB(b)
+		b.StartTimer()
+		res, err := db.ImportJSONResults(dir)
+		if err != nil || res.Imported != 1000 {
+			b.Fatalf("import = %+v, %v", res, err)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// hotIndexes cover the columns the dashboard filters and sorts on most
+var hotIndexes = []struct{ name, table, columns string }{
+	{"clopus_watcher_runs_namespace_started_at_idx", "clopus_watcher_runs", "namespace, started_at"},
+	{"clopus_watcher_fixes_run_id_idx", "clopus_watcher_fixes", "run_id"},
+	{"clopus_watcher_fixes_namespace_timestamp_idx", "clopus_watcher_fixes", "namespace, timestamp"},
+	{"clopus_watcher_fixes_timestamp_idx", "clopus_watcher_fixes", "timestamp"},
+}
+
+// EnsureIndexes creates any missing hot-column indexes. Tables created
+// before these indexes existed (or by hand) may lack them, which makes
+// namespace and per-run queries slow once the tables grow.
+func EnsureIndexes(conn *sql.DB) error {
+	for _, idx := range hotIndexes {
+		_, err := conn.Exec(fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (%s)`, idx.name, idx.table, idx.columns))
+		if err != nil {
+			return fmt.Errorf("create index %s: %w", idx.name, err)
+		}
+	}
+	return nil
+}
+
+// EnsureIndexes creates any missing hot-column indexes on the database
+func (db *DB) EnsureIndexes() error {
+	return EnsureIndexes(db.pool())
+}
@@ -0,0 +1,44 @@
+package db
+
+import "database/sql"
+
+// GetRunLineage returns every run in id's retry chain: its ancestors through
+// parent_run_id and all of their retries, oldest first. UNION drops rows it
+// has already seen, so a corrupt parent cycle ends the walk instead of
+// looping forever.
+func (db *DB) GetRunLineage(id int) ([]Run, error) {
+	var runs []Run
+	err := db.retry(func() error {
+		rows, err := db.pool().Query(`
+			WITH RECURSIVE ancestors(id, parent_run_id) AS (
+				SELECT id, parent_run_id FROM clopus_watcher_runs WHERE id = $1
+				UNION
+				SELECT r.id, r.parent_run_id
+				FROM clopus_watcher_runs r
+				JOIN ancestors a ON r.id = a.parent_run_id
+			), chain(id) AS (
+				SELECT id FROM ancestors
+				UNION
+				SELECT r.id
+				FROM clopus_watcher_runs r
+				JOIN chain c ON r.parent_run_id = c.id
+			)
+			SELECT `+runColumns+`
+			FROM clopus_watcher_runs
+			WHERE id IN (SELECT id FROM chain) AND deleted_at IS NULL
+			ORDER BY started_at, id
+		`, id)
+		if err != nil {
+			return err
+		}
+		runs, err = scanRuns(rows)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, notFound(sql.ErrNoRows, ErrRunNotFound, id)
+	}
+	return runs, nil
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// RunMigrations applies the embedded migrations in filename order, recording
+// each in schema_migrations. Already applied migrations are skipped, so it is
+// safe to run on every startup, including from several replicas at once.
+func RunMigrations(conn *sql.DB) error {
+	_, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    TEXT PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	// fs.ReadDir returns entries sorted by filename
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		if err := applyMigration(conn, entry.Name()); err != nil {
+			return fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// applyMigration runs one migration in a transaction unless it is already
+// recorded. The table lock serialises concurrent runners.
+func applyMigration(conn *sql.DB, name string) error {
+	script, err := migrationsFS.ReadFile("migrations/" + name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`LOCK TABLE schema_migrations IN EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+	var applied bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, name).Scan(&applied)
+	if err != nil || applied {
+		return err
+	}
+
+	if _, err := tx.Exec(string(script)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Migrate brings the schema up to date. sqlite databases are created from
+// their own schema when opened, so this only applies to Postgres.
+func (db *DB) Migrate() error {
+	if db.driver == DriverSQLite {
+		return nil
+	}
+	return RunMigrations(db.pool())
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"testing"
+)
+
+var (
+	migrationName = regexp.MustCompile(`^(\d{4})_[a-z0-9_]+\.sql$`)
+	schemaChange  = regexp.MustCompile(`(?i)\b(CREATE (UNIQUE )?(TABLE|INDEX)|ADD COLUMN)\b(\s+IF NOT EXISTS)?`)
+)
+
+// TestMigrationFiles checks the embedded migrations are numbered 0001, 0002,
+// ... with no gaps or duplicates, and that every schema change is guarded so
+// a migration recorded as failed half way can be re-run
+func TestMigrationFiles(t *testing.T) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for i, entry := range entries {
+		m := migrationName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			t.Errorf("%s: want a NNNN_name.sql file name", entry.Name())
+			continue
+		}
+		if want := fmt.Sprintf("%04d", i+1); m[1] != want {
+			t.Errorf("%s: version %s, want %s", entry.Name(), m[1], want)
+		}
+
+		script, err := migrationsFS.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, change := range schemaChange.FindAllStringSubmatch(string(script), -1) {
+			if change[4] == "" {
+				t.Errorf("%s: %q without IF NOT EXISTS", entry.Name(), change[1])
+			}
+		}
+	}
+}
@@ -0,0 +1,29 @@
+-- Base schema for the dashboard tables.
+-- Runs are written by the watcher (or imported from its JSON results),
+-- fixes are recorded per pod while a run is in progress.
+
+CREATE TABLE IF NOT EXISTS clopus_watcher_runs (
+    id          BIGSERIAL PRIMARY KEY,
+    started_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ended_at    TIMESTAMPTZ,
+    namespace   TEXT NOT NULL,
+    mode        TEXT NOT NULL,
+    status      TEXT NOT NULL,
+    pod_count   INTEGER NOT NULL DEFAULT 0,
+    error_count INTEGER NOT NULL DEFAULT 0,
+    fix_count   INTEGER NOT NULL DEFAULT 0,
+    report      TEXT,
+    log         TEXT
+);
+
+CREATE TABLE IF NOT EXISTS clopus_watcher_fixes (
+    id            BIGSERIAL PRIMARY KEY,
+    run_id        BIGINT REFERENCES clopus_watcher_runs(id) ON DELETE CASCADE,
+    timestamp     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    namespace     TEXT NOT NULL,
+    pod_name      TEXT NOT NULL,
+    error_type    TEXT NOT NULL,
+    error_message TEXT,
+    fix_applied   TEXT,
+    status        TEXT NOT NULL DEFAULT 'pending'
+);
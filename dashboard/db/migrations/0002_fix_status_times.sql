@@ -0,0 +1,5 @@
+-- Track when a fix entered analysis and when it was resolved so the
+-- dashboard can compute mean-time-to-fix. Populated by UpdateFixStatus.
+
+ALTER TABLE clopus_watcher_fixes ADD COLUMN IF NOT EXISTS analyzing_at TIMESTAMPTZ;
+ALTER TABLE clopus_watcher_fixes ADD COLUMN IF NOT EXISTS resolved_at TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+-- Soft-deleted runs keep their data but are hidden from reads by default.
+
+ALTER TABLE clopus_watcher_runs ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
@@ -0,0 +1,4 @@
+-- Structured run reports (findings, pods, remediation, ...). The plain text
+-- report column is kept for older runs and watchers.
+
+ALTER TABLE clopus_watcher_runs ADD COLUMN IF NOT EXISTS report_json JSONB;
@@ -0,0 +1,13 @@
+-- Files attached to a run by the watcher (diffs, kubectl output, ...).
+
+CREATE TABLE IF NOT EXISTS clopus_watcher_artifacts (
+    id           BIGSERIAL PRIMARY KEY,
+    run_id       BIGINT NOT NULL REFERENCES clopus_watcher_runs(id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size         INTEGER NOT NULL,
+    data         BYTEA NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS clopus_watcher_artifacts_run_id_idx ON clopus_watcher_artifacts (run_id);
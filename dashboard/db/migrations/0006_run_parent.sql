@@ -0,0 +1,5 @@
+-- Retried runs point at the run they retry.
+
+ALTER TABLE clopus_watcher_runs ADD COLUMN IF NOT EXISTS parent_run_id BIGINT REFERENCES clopus_watcher_runs(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS clopus_watcher_runs_parent_run_id_idx ON clopus_watcher_runs (parent_run_id);
@@ -0,0 +1,10 @@
+-- Status changes of each run, for the run timeline.
+
+CREATE TABLE IF NOT EXISTS clopus_watcher_run_events (
+    id         BIGSERIAL PRIMARY KEY,
+    run_id     BIGINT NOT NULL REFERENCES clopus_watcher_runs(id) ON DELETE CASCADE,
+    status     TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS clopus_watcher_run_events_run_id_idx ON clopus_watcher_run_events (run_id, created_at);
@@ -0,0 +1,6 @@
+-- Namespaces hidden from the namespace list; their runs are kept.
+
+CREATE TABLE IF NOT EXISTS clopus_watcher_archived_namespaces (
+    namespace   TEXT PRIMARY KEY,
+    archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
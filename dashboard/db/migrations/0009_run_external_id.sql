@@ -0,0 +1,6 @@
+-- Runs imported with renumbering get a new id and keep the watcher's id here.
+
+ALTER TABLE clopus_watcher_runs ADD COLUMN IF NOT EXISTS external_id BIGINT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS clopus_watcher_runs_external_id_idx
+    ON clopus_watcher_runs (external_id, namespace, started_at) WHERE external_id IS NOT NULL;
@@ -0,0 +1,28 @@
+package db
+
+import "fmt"
+
+// Mode is the watcher mode a run was started in. It is stored as text.
+type Mode string
+
+// Watcher modes, matching WATCHER_MODE in the watcher image. The watcher
+// only special-cases "report"; "watcher" is the name older docs used for it.
+const (
+	ModeAutonomous Mode = "autonomous" // find and fix issues
+	ModeReport     Mode = "report"     // report issues only
+	ModeWatcher    Mode = "watcher"
+)
+
+// Modes lists the valid modes
+var Modes = []Mode{ModeAutonomous, ModeReport, ModeWatcher}
+
+// ParseMode validates s as a Mode, returning ErrInvalidMode for anything
+// else so a typo can't create a bogus mode
+func ParseMode(s string) (Mode, error) {
+	for _, m := range Modes {
+		if Mode(s) == m {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidMode, s)
+}
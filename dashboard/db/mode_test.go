@@ -0,0 +1,19 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	for _, m := range Modes {
+		if got, err := ParseMode(string(m)); got != m || err != nil {
+			t.Errorf("ParseMode(%q) = %q, %v", m, got, err)
+		}
+	}
+	for _, s := range []string{"", "fix", "scan", "Autonomous", "report "} {
+		if got, err := ParseMode(s); got != "" || !errors.Is(err, ErrInvalidMode) {
+			t.Errorf("ParseMode(%q) = %q, %v; want ErrInvalidMode", s, got, err)
+		}
+	}
+}
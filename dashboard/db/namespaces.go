@@ -0,0 +1,210 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ErrEmptyNamespace guards bulk operations from matching every namespace
+var ErrEmptyNamespace = errors.New("namespace must not be empty")
+
+// GetNamespaceStatsBatch returns stats for each requested namespace in a
+// single grouped query, in the order requested. Namespaces without runs get
+// zero counts, matching GetNamespaceStats.
+func (db *DB) GetNamespaceStatsBatch(names []string) ([]NamespaceStats, error) {
+	var found map[string]NamespaceStats
+	err := db.retry(func() error {
+		rows, err := db.readPool().Query(`
+			SELECT
+				namespace,
+				COUNT(*) as run_count,
+				SUM(CASE WHEN status = 'ok' THEN 1 ELSE 0 END) as ok_count,
+				SUM(CASE WHEN status = 'fixed' THEN 1 ELSE 0 END) as fixed_count,
+				SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) as failed_count,
+				SUM(CASE WHEN status = 'issues_found' THEN 1 ELSE 0 END) as issues_found_count
+			FROM clopus_watcher_runs
+			WHERE namespace = ANY($1) AND deleted_at IS NULL
+			GROUP BY namespace
+		`, pq.Array(names))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		found = make(map[string]NamespaceStats, len(names))
+		for rows.Next() {
+			var s NamespaceStats
+			err := rows.Scan(&s.Namespace, &s.RunCount, &s.OkCount, &s.FixedCount, &s.FailedCount, &s.IssuesFoundCount)
+			if err != nil {
+				return err
+			}
+			found[s.Namespace] = s
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]NamespaceStats, 0, len(names))
+	for _, name := range names {
+		s, ok := found[name]
+		if !ok {
+			s = NamespaceStats{Namespace: name}
+		}
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
+
+// maxTrendDays bounds GetNamespaceRunTrends, which allocates days counters
+// per namespace; handlers cap ?days= lower than this
+const maxTrendDays = 366
+
+// GetNamespaceRunTrends returns daily run counts for the last days days
+// (oldest first) for each requested namespace, zero-filled, in one query
+func (db *DB) GetNamespaceRunTrends(names []string, days int) (map[string][]int, error) {
+	if days < 1 || days > maxTrendDays {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidDays, days)
+	}
+	var trends map[string][]int
+	err := db.retry(func() error {
+		rows, err := db.readPool().Query(`
+			SELECT namespace, CURRENT_DATE - started_at::date as age, COUNT(*)
+			FROM clopus_watcher_runs
+			WHERE namespace = ANY($1) AND started_at >= CURRENT_DATE - ($2::int - 1) AND deleted_at IS NULL
+			GROUP BY namespace, age
+		`, pq.Array(names), days)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		trends = make(map[string][]int, len(names))
+		for _, name := range names {
+			trends[name] = make([]int, days)
+		}
+		for rows.Next() {
+			var namespace string
+			var age, count int
+			if err := rows.Scan(&namespace, &age, &count); err != nil {
+				return err
+			}
+			if age >= 0 && age < days {
+				trends[namespace][days-1-age] = count
+			}
+		}
+		return rows.Err()
+	})
+	return trends, err
+}
+
+// GetNamespaceSparklines returns GetNamespaceRunTrends for every namespace
+// that isn't archived, for the trend sparklines on the namespace list
+func (db *DB) GetNamespaceSparklines(days int) (map[string][]int, error) {
+	namespaces, err := db.ListNamespaces(false)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(namespaces))
+	for i, ns := range namespaces {
+		names[i] = ns.Namespace
+	}
+	return db.GetNamespaceRunTrends(names, days)
+}
+
+// DeleteRunsByNamespace permanently deletes every run in namespace and the
+// fixes recorded against them, returning the number of runs deleted
+func (db *DB) DeleteRunsByNamespace(namespace string) (int64, error) {
+	if namespace == "" {
+		return 0, ErrEmptyNamespace
+	}
+
+	tx, err := db.pool().Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM clopus_watcher_fixes
+		WHERE run_id IN (SELECT id FROM clopus_watcher_runs WHERE namespace = $1)
+	`, namespace)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(`DELETE FROM clopus_watcher_runs WHERE namespace = $1`, namespace)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	db.nsCache.invalidate()
+	return deleted, nil
+}
+
+// maxNamespaceSearch caps SearchNamespaces results
+const maxNamespaceSearch = 50
+
+// SearchNamespaces returns namespaces starting with prefix (case-insensitive)
+// in alphabetical order. An empty prefix returns the namespaces with the most
+// runs instead.
+func (db *DB) SearchNamespaces(prefix string, limit int) ([]string, error) {
+	if limit <= 0 || limit > maxNamespaceSearch {
+		limit = maxNamespaceSearch
+	}
+
+	var query string
+	var args []interface{}
+	if prefix == "" {
+		query = `
+			SELECT namespace FROM clopus_watcher_runs
+			WHERE deleted_at IS NULL
+			GROUP BY namespace
+			ORDER BY COUNT(*) DESC, namespace
+			LIMIT $1
+		`
+		args = []interface{}{limit}
+	} else {
+		query = `
+			SELECT DISTINCT namespace FROM clopus_watcher_runs
+			WHERE namespace ILIKE $1 ESCAPE '\' AND deleted_at IS NULL
+			ORDER BY namespace
+			LIMIT $2
+		`
+		args = []interface{}{likeEscaper.Replace(prefix) + "%", limit}
+	}
+
+	var names []string
+	err := db.retry(func() error {
+		names = nil
+		rows, err := db.readPool().Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			names = append(names, name)
+		}
+		return rows.Err()
+	})
+	return names, err
+}
+
+// likeEscaper escapes LIKE wildcards so user input matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
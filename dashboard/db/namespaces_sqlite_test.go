@@ -0,0 +1,176 @@
+//go:build sqlite
+
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestListNamespaces(t *testing.T) {
+	db := openTestDB(t)
+	for _, run := range []struct{ namespace, status string }{
+		{"default", "ok"}, {"default", "fixed"}, {"default", "failed"}, {"other", "issues_found"},
+	} {
+		id := addRun(t, db, run.namespace)
+		if err := db.CompleteRun(id, run.status, 0, 0, 0, "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := db.ListNamespaces(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []NamespaceStats{
+		{Namespace: "default", RunCount: 3, OkCount: 1, FixedCount: 1, FailedCount: 1},
+		{Namespace: "other", RunCount: 1, IssuesFoundCount: 1},
+	}
+	if len(stats) != len(want) || stats[0] != want[0] || stats[1] != want[1] {
+		t.Errorf("ListNamespaces = %+v, want %+v", stats, want)
+	}
+	if n := stats[0].NeedsAttention(); n != 1 {
+		t.Errorf("default NeedsAttention = %d, want 1", n)
+	}
+
+	single, err := db.GetNamespaceStats("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *single != want[0] {
+		t.Errorf("GetNamespaceStats = %+v, want %+v", single, want[0])
+	}
+}
+
+func TestDeleteRunsByNamespace(t *testing.T) {
+	db := openTestDB(t)
+	for i := 0; i < 3; i++ {
+		addFix(t, db, addRun(t, db, "doomed"), "doomed", "api", "success")
+	}
+	keep := addRun(t, db, "kept")
+	addFix(t, db, keep, "kept", "web", "success")
+
+	if _, err := db.DeleteRunsByNamespace(""); !errors.Is(err, ErrEmptyNamespace) {
+		t.Errorf("empty namespace: err = %v, want ErrEmptyNamespace", err)
+	}
+
+	n, err := db.DeleteRunsByNamespace("doomed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("deleted %d runs, want 3", n)
+	}
+
+	stats, err := db.GetStatsStruct()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 1 {
+		t.Errorf("%d fixes left, want only the kept namespace's", stats.Total)
+	}
+	if _, err := db.GetRun(int(keep)); err != nil {
+		t.Errorf("kept run: %v", err)
+	}
+}
+
+func TestSearchNamespaces(t *testing.T) {
+	db := openTestDB(t)
+	for _, namespace := range []string{"kube-system", "kube-public", "Kube-dns", "default", "default", "default", "100%_done"} {
+		addRun(t, db, namespace)
+	}
+
+	tests := []struct {
+		prefix string
+		limit  int
+		want   []string
+	}{
+		{"kube", 0, []string{"Kube-dns", "kube-public", "kube-system"}},
+		{"KUBE-S", 0, []string{"kube-system"}},
+		{"kube", 1, []string{"Kube-dns"}},
+		{"100%", 0, []string{"100%_done"}},
+		{"1_", 0, nil},
+		{"", 1, []string{"default"}},
+	}
+	for _, tt := range tests {
+		got, err := db.SearchNamespaces(tt.prefix, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("SearchNamespaces(%q, %d) = %v, want %v", tt.prefix, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestGetNamespaceStatsIssuesFound(t *testing.T) {
+	db := openTestDB(t)
+	for _, status := range []string{"issues_found", "issues_found", "failed"} {
+		if err := db.CompleteRun(addRun(t, db, "default"), status, 0, 0, 0, "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := db.GetNamespaceStats("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.FailedCount != 1 || s.IssuesFoundCount != 2 {
+		t.Errorf("stats = %+v, want 1 failed and 2 issues_found runs counted apart", s)
+	}
+
+	empty, err := db.GetNamespaceStats("missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *empty != (NamespaceStats{Namespace: "missing"}) {
+		t.Errorf("stats for a namespace without runs = %+v, want zeros", empty)
+	}
+}
+
+func TestArchiveNamespace(t *testing.T) {
+	db := openTestDB(t)
+	addRun(t, db, "kept")
+	addRun(t, db, "old")
+
+	names := func(includeArchived bool) string {
+		t.Helper()
+		stats, err := db.ListNamespaces(includeArchived)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, s := range stats {
+			name := s.Namespace
+			if s.Archived {
+				name += "(archived)"
+			}
+			names = append(names, name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	// Prime the cache so archiving has to invalidate it
+	if got := names(false); got != "kept,old" {
+		t.Fatalf("namespaces = %s", got)
+	}
+	for i := 0; i < 2; i++ {
+		if err := db.ArchiveNamespace("old"); err != nil {
+			t.Fatalf("ArchiveNamespace #%d: %v", i+1, err)
+		}
+	}
+	if got := names(false); got != "kept" {
+		t.Errorf("after archiving: namespaces = %s, want kept", got)
+	}
+	if got := names(true); got != "kept,old(archived)" {
+		t.Errorf("including archived: namespaces = %s", got)
+	}
+
+	if err := db.UnarchiveNamespace("old"); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(false); got != "kept,old" {
+		t.Errorf("after unarchiving: namespaces = %s, want kept,old", got)
+	}
+}
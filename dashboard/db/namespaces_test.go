@@ -0,0 +1,32 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestGetNamespaceRunTrendsDays checks the bound on days, which sizes the
+// per-namespace slices, is enforced before querying
+func TestGetNamespaceRunTrendsDays(t *testing.T) {
+	db := &DB{}
+	for _, days := range []int{0, -1, maxTrendDays + 1, 1 << 31} {
+		if _, err := db.GetNamespaceRunTrends([]string{"default"}, days); !errors.Is(err, ErrInvalidDays) {
+			t.Errorf("days %d: err = %v, want ErrInvalidDays", days, err)
+		}
+	}
+}
+
+func TestNeedsAttention(t *testing.T) {
+	s := NamespaceStats{RunCount: 10, OkCount: 4, FixedCount: 2, FailedCount: 3, IssuesFoundCount: 1}
+	if n := s.NeedsAttention(); n != 4 {
+		t.Errorf("NeedsAttention = %d, want failed plus issues_found runs", n)
+	}
+}
+
+func TestNamespaceStatsFromCounts(t *testing.T) {
+	counts := map[string]int{"running": 1, "ok": 4, "fixed": 2, "failed": 3, "issues_found": 1}
+	want := NamespaceStats{Namespace: "default", RunCount: 11, OkCount: 4, FixedCount: 2, FailedCount: 3, IssuesFoundCount: 1}
+	if got := NamespaceStatsFromCounts("default", counts); got != want {
+		t.Errorf("NamespaceStatsFromCounts = %+v, want %+v", got, want)
+	}
+}
@@ -1,20 +1,28 @@
 package db
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type Run struct {
 	ID         int
-	StartedAt  string
-	EndedAt    string
+	StartedAt  string // RFC3339
+	EndedAt    string // RFC3339, empty while running
 	Namespace  string
 	Mode       string
 	Status     string // ok, fixed, failed, running
@@ -22,19 +30,32 @@ type Run struct {
 	ErrorCount int
 	FixCount   int
 	Report     string
+	ReportJSON json.RawMessage // structured report, nil for plain text reports
 	Log        string
+	LogSize    int // length of the log in bytes, only set by GetRunMeta
+	// ParentRunID is the run this one retries, 0 for first attempts
+	ParentRunID int
+	// FixCountActual is the number of fixes recorded against the run, which
+	// can drift from the reported FixCount. Only set when requested through
+	// RunFilter.WithFixCounts.
+	FixCountActual int
+
+	StartedAtTime time.Time
+	EndedAtTime   time.Time // zero while running
 }
 
 type Fix struct {
 	ID           int
 	RunID        int
-	Timestamp    string
+	Timestamp    string // RFC3339
 	Namespace    string
 	PodName      string
 	ErrorType    string
 	ErrorMessage string
 	FixApplied   string
 	Status       string
+
+	TimestampTime time.Time
 }
 
 type NamespaceStats struct {
@@ -43,15 +64,57 @@ type NamespaceStats struct {
 	OkCount    int
 	FixedCount int
 	FailedCount int
+	IssuesFoundCount int // runs that completed but found problems they didn't fix
+	Archived   bool // hidden from GetNamespaces, see ArchiveNamespace
+}
+
+// NeedsAttention counts failed runs and runs with unresolved issues, which
+// FailedCount covered before the two were split
+func (s NamespaceStats) NeedsAttention() int {
+	return s.FailedCount + s.IssuesFoundCount
 }
 
 type DB struct {
-	conn *sql.DB
+	driver string // DriverPostgres or DriverSQLite
+	dsn    string
+	connMu sync.RWMutex // guards conn and replica, which reconnect may swap
+	conn   *sql.DB
+	health healthState
+
+	stmtMu sync.Mutex
+	stmts  map[stmtKey]*sql.Stmt // prepared statements for hot read queries
+
+	retryAttempts int // attempts for reads failing with transient errors
+
+	nsCache namespacesCache // GetNamespaces results, invalidated on writes
+
+	onRunComplete func(run Run) // see OnRunComplete
+
+	fixDedupWindow time.Duration // see SetFixDedupWindow
+
+	slowQuery time.Duration // see SetSlowQueryThreshold
+
+	replica    *sql.DB // optional read replica, see SetReplica
+	replicaDSN string
+
+	importRenumber    bool      // see SetImportRenumber
+	resultsGlob       string    // see SetResultsGlob
+	importNotifyAfter time.Time // see SetImportNotifyAfter
+
+	sloTarget float64 // see SetSLOTarget
 }
 
-// New creates a new database connection using PostgreSQL DSN
+// New creates a new database connection using PostgreSQL DSN, or sqlite when
+// the DSN starts with "sqlite:"
 func New(dsn string) (*DB, error) {
-	conn, err := sql.Open("postgres", dsn)
+	return Open("", dsn)
+}
+
+// Open creates a new database connection with the given driver, see
+// ParseDriver
+func Open(driverName, dsn string) (*DB, error) {
+	driverName, dsn = ParseDriver(driverName, dsn)
+	conn, err := openPool(driverName, dsn, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -61,31 +124,84 @@ func New(dsn string) (*DB, error) {
 		return nil, err
 	}
 
-	// Tables are created by migrations, not here
-	return &DB{conn: conn}, nil
+	// Postgres tables are created by Migrate, not here
+	if driverName == DriverSQLite {
+		if err := initSQLiteSchema(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	db := &DB{driver: driverName, dsn: dsn, conn: conn, importNotifyAfter: time.Now()}
+	db.health.set(nil)
+	db.nsCache.ttl = defaultNamespacesCacheTTL
+	return db, nil
 }
 
 func (db *DB) Close() error {
-	return db.conn.Close()
+	db.closeStatements()
+	if replica := db.replicaPool(); replica != nil {
+		replica.Close()
+	}
+	return db.pool().Close()
+}
+
+// Ping checks database connectivity, bounded by ctx
+func (db *DB) Ping(ctx context.Context) error {
+	return db.pool().PingContext(ctx)
+}
+
+// Stats returns connection pool statistics
+func (db *DB) Stats() sql.DBStats {
+	return db.pool().Stats()
 }
 
 // Run operations
 
-func (db *DB) CreateRun(namespace, mode string) (int64, error) {
+// CreateRun starts a running run. mode is checked with ParseMode.
+func (db *DB) CreateRun(namespace string, mode Mode) (int64, error) {
+	if _, err := ParseMode(string(mode)); err != nil {
+		return 0, err
+	}
+
 	var id int64
-	err := db.conn.QueryRow(`
+	err := db.pool().QueryRow(`
 		INSERT INTO clopus_watcher_runs (started_at, namespace, mode, status)
 		VALUES (NOW(), $1, $2, 'running')
 		RETURNING id
-	`, namespace, mode).Scan(&id)
+	`, namespace, string(mode)).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
+	db.nsCache.invalidate()
+	db.recordRunEvent(id, "running")
 	return id, nil
 }
 
+// RetryRun starts a new run with the namespace and mode of run id, linked
+// to it through parent_run_id
+func (db *DB) RetryRun(id int64) (int64, error) {
+	var childID int64
+	err := db.pool().QueryRow(`
+		INSERT INTO clopus_watcher_runs (started_at, namespace, mode, status, parent_run_id)
+		SELECT NOW(), namespace, mode, 'running', id
+		FROM clopus_watcher_runs
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id
+	`, id).Scan(&childID)
+	if err != nil {
+		return 0, notFound(err, ErrRunNotFound, id)
+	}
+	db.nsCache.invalidate()
+	db.recordRunEvent(childID, "running")
+	return childID, nil
+}
+
+// CompleteRun records a running run's outcome. Completing a run that is not
+// running returns ErrRunNotRunning, so concurrent writers can't complete it
+// twice.
 func (db *DB) CompleteRun(id int64, status string, podCount, errorCount, fixCount int, report, log string) error {
-	_, err := db.conn.Exec(`
+	run, err := scanRun(db.pool().QueryRow(`
 		UPDATE clopus_watcher_runs SET
 			ended_at = NOW(),
 			status = $1,
@@ -94,249 +210,1474 @@ func (db *DB) CompleteRun(id int64, status string, podCount, errorCount, fixCoun
 			fix_count = $4,
 			report = $5,
 			log = $6
-		WHERE id = $7
-	`, status, podCount, errorCount, fixCount, report, log, id)
+		WHERE id = $7 AND status = 'running'
+		RETURNING `+runMetaColumns, status, podCount, errorCount, fixCount, report, log, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.notRunning(id)
+	}
+	if err != nil {
+		return err
+	}
+	db.nsCache.invalidate()
+	db.recordRunEvent(id, status)
+	db.runCompleted(run)
+	return nil
+}
+
+// runUpdateColumns are the columns UpdateRun may set, with a check that
+// converts the given value to what the column stores
+var runUpdateColumns = map[string]func(v interface{}) (interface{}, bool){
+	"status":      finalStatusValue,
+	"report":      stringValue,
+	"pod_count":   countValue,
+	"error_count": countValue,
+	"fix_count":   countValue,
+	"mode": func(v interface{}) (interface{}, bool) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		mode, err := ParseMode(s)
+		return string(mode), err == nil
+	},
+}
+
+func stringValue(v interface{}) (interface{}, bool) {
+	s, ok := v.(string)
+	return s, ok
+}
+
+// finalStatusValue accepts the statuses a run can complete with; a run
+// can't be set back to running
+func finalStatusValue(v interface{}) (interface{}, bool) {
+	s, ok := v.(string)
+	return s, ok && s != "running" && slices.Contains(runStatuses, s)
+}
+
+// countValue accepts non-negative whole numbers, including JSON-decoded
+// float64 and json.Number values
+func countValue(v interface{}) (interface{}, bool) {
+	var n float64
+	switch v := v.(type) {
+	case int:
+		n = float64(v)
+	case int64:
+		n = float64(v)
+	case float64:
+		n = v
+	case json.Number:
+		i, err := v.Int64()
+		if err != nil {
+			return nil, false
+		}
+		n = float64(i)
+	default:
+		return nil, false
+	}
+	if n < 0 || n != float64(int64(n)) {
+		return nil, false
+	}
+	return int64(n), true
+}
+
+// UpdateRun sets only the given columns of a run, for amending a single
+// field such as report or the counts. Columns outside runUpdateColumns, or
+// values of the wrong type, return ErrInvalidRunUpdate. Setting status
+// completes the run like CompleteRun: only a running run can be completed,
+// anything else returns ErrRunNotRunning.
+func (db *DB) UpdateRun(id int64, fields map[string]interface{}) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("%w: no fields given", ErrInvalidRunUpdate)
+	}
+
+	// Sorted so the same fields always build the same statement
+	columns := make([]string, 0, len(fields))
+	for column := range fields {
+		columns = append(columns, column)
+	}
+	slices.Sort(columns)
+
+	args := db.newArgs()
+	sets := make([]string, 0, len(columns)+1)
+	for _, column := range columns {
+		convert, ok := runUpdateColumns[column]
+		if !ok {
+			return fmt.Errorf("%w: unknown field %q", ErrInvalidRunUpdate, column)
+		}
+		value, ok := convert(fields[column])
+		if !ok {
+			return fmt.Errorf("%w: invalid value for %q", ErrInvalidRunUpdate, column)
+		}
+		sets = append(sets, column+" = "+args.add(value))
+	}
+
+	where := ` WHERE id = ` + args.add(id) + ` AND deleted_at IS NULL`
+	status, completing := fields["status"].(string)
+	if completing {
+		sets = append(sets, "ended_at = NOW()")
+		where += ` AND status = 'running'`
+	}
+
+	run, err := scanRun(db.pool().QueryRow(`UPDATE clopus_watcher_runs SET `+strings.Join(sets, ", ")+
+		where+` RETURNING `+runMetaColumns, args.values...))
+	if errors.Is(err, sql.ErrNoRows) {
+		if completing {
+			return db.notRunning(id)
+		}
+		return fmt.Errorf("%w: %d", ErrRunNotFound, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	db.nsCache.invalidate()
+	if completing {
+		db.recordRunEvent(id, status)
+		db.runCompleted(run)
+	}
+	return nil
+}
+
+// notRunning explains why an update of a running run matched no rows:
+// either the run doesn't exist or it already completed
+func (db *DB) notRunning(id int64) error {
+	var exists bool
+	if err := db.pool().QueryRow(`SELECT EXISTS(SELECT 1 FROM clopus_watcher_runs WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%w: %d", ErrRunNotRunning, id)
+	}
+	return fmt.Errorf("%w: %d", ErrRunNotFound, id)
+}
+
+// IncrementRunCounters adds to a run's error and fix counts in a single
+// UPDATE, so concurrent reporters for the same run don't overwrite each
+// other. CompleteRun still sets the final counts.
+func (db *DB) IncrementRunCounters(id int64, errorDelta, fixDelta int) error {
+	err := db.execOne(`
+		UPDATE clopus_watcher_runs
+		SET error_count = error_count + $1, fix_count = fix_count + $2
+		WHERE id = $3
+	`, errorDelta, fixDelta, id)
+	if err != nil {
+		return notFound(err, ErrRunNotFound, id)
+	}
+	db.nsCache.invalidate()
+	return nil
+}
+
+// UpdateRunProgress records how far a running run has got. The counts land
+// in pod_count and error_count, so reads see them before the run completes;
+// CompleteRun overwrites them with the final numbers.
+func (db *DB) UpdateRunProgress(id int64, podsScanned, errorsFound int) error {
+	err := db.execOne(`
+		UPDATE clopus_watcher_runs
+		SET pod_count = $1, error_count = $2
+		WHERE id = $3 AND status = 'running'
+	`, podsScanned, errorsFound, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.notRunning(id)
+	}
 	return err
 }
 
+// OnRunComplete registers fn to be called with every run completed through
+// CompleteRun, or imported by ImportJSONResults when it ended after
+// SetImportNotifyAfter, so backfilled history doesn't notify. The run's Log
+// is left empty. It must be set before the DB is shared between goroutines.
+func (db *DB) OnRunComplete(fn func(run Run)) {
+	db.onRunComplete = fn
+}
+
+func (db *DB) runCompleted(run Run) {
+	if db.onRunComplete != nil {
+		db.onRunComplete(run)
+	}
+}
+
+// GetNamespaceWindowCounts sums the errors and counts the failed runs of
+// namespace's runs started since since
+func (db *DB) GetNamespaceWindowCounts(namespace string, since time.Time) (errorCount, failedRuns int, err error) {
+	err = db.retry(func() error {
+		return db.pool().QueryRow(`
+			SELECT
+				COALESCE(SUM(error_count), 0),
+				COALESCE(SUM(CASE WHEN status = 'failed' OR status = 'issues_found' THEN 1 ELSE 0 END), 0)
+			FROM clopus_watcher_runs
+			WHERE namespace = $1 AND started_at >= $2 AND deleted_at IS NULL
+		`, namespace, since).Scan(&errorCount, &failedRuns)
+	})
+	return errorCount, failedRuns, err
+}
+
+// runColumns is the select list matching scanRun
+const runColumns = `id, started_at, ended_at, namespace, mode, status,
+		       pod_count, error_count, fix_count, COALESCE(report, ''), COALESCE(report_json::text, ''), COALESCE(log, ''),
+		       COALESCE(parent_run_id, 0)`
+
+// runMetaColumns is runColumns with an empty log, for reads that don't need
+// a possibly very large log
+const runMetaColumns = `id, started_at, ended_at, namespace, mode, status,
+		       pod_count, error_count, fix_count, COALESCE(report, ''), COALESCE(report_json::text, ''), '',
+		       COALESCE(parent_run_id, 0)`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRun(row rowScanner) (Run, error) {
+	var r Run
+	err := scanRunInto(row, &r)
+	return r, err
+}
+
+// scanRunInto scans runColumns into r, followed by any extra columns
+func scanRunInto(row rowScanner, r *Run, extra ...interface{}) error {
+	var endedAt sql.NullTime
+	var reportJSON string
+	dest := []interface{}{&r.ID, &r.StartedAtTime, &endedAt, &r.Namespace, &r.Mode,
+		&r.Status, &r.PodCount, &r.ErrorCount, &r.FixCount, &r.Report, &reportJSON, &r.Log,
+		&r.ParentRunID}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+
+	r.StartedAt = r.StartedAtTime.Format(time.RFC3339)
+	if endedAt.Valid {
+		r.EndedAtTime = endedAt.Time
+		r.EndedAt = endedAt.Time.Format(time.RFC3339)
+	}
+	if reportJSON != "" {
+		r.ReportJSON = json.RawMessage(reportJSON)
+	}
+	return nil
+}
+
+func scanRuns(rows *sql.Rows) ([]Run, error) {
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// GetRuns returns the latest runs for the sidebar, without their logs. It
+// reads from the primary so the sidebar reflects changes the user just made.
 func (db *DB) GetRuns(namespace string, limit int) ([]Run, error) {
-	query := `
-		SELECT id, started_at::text, COALESCE(ended_at::text, ''), namespace, mode, status,
-		       pod_count, error_count, fix_count, COALESCE(report, ''), COALESCE(log, '')
-		FROM clopus_watcher_runs
-	`
-	args := []interface{}{}
-	argIdx := 1
+	query := `SELECT ` + runMetaColumns + ` FROM clopus_watcher_runs WHERE deleted_at IS NULL`
+	args := db.newArgs()
 
 	if namespace != "" {
-		query += fmt.Sprintf(" WHERE namespace = $%d", argIdx)
-		args = append(args, namespace)
-		argIdx++
+		query += " AND namespace = " + args.add(namespace)
+	}
+
+	query += " ORDER BY started_at DESC LIMIT " + args.add(limit)
+
+	var runs []Run
+	err := db.retry(func() error {
+		rows, err := db.queryPrepared(query, args.values...)
+		if err != nil {
+			return err
+		}
+		runs, err = scanRuns(rows)
+		return err
+	})
+	return runs, err
+}
+
+// RunFilter narrows the runs returned by GetRunsFiltered. Zero values mean
+// no filter; soft-deleted runs are excluded unless IncludeDeleted is set.
+type RunFilter struct {
+	Namespace      string
+	Status         string
+	Namespaces     []string // any of these namespaces; combined with Namespace
+	Statuses       []string // any of these statuses; combined with Status
+	Modes          []string // any of these modes
+	From           time.Time
+	To             time.Time
+	IncludeDeleted bool
+	MinErrors      int    // error_count at least this; 0 disables
+	MinFixes       int    // fix_count at least this; 0 disables
+	WithFixCounts  bool   // also count each run's fixes into FixCountActual
+	WithoutLog     bool   // leave Log empty instead of loading it
+	Sort           string // whitelisted field, "-" prefix for descending; default -started_at
+	Limit          int
+	Offset         int
+}
+
+// where builds the WHERE clause and args for the filter
+func (f RunFilter) where(args *queryArgs) string {
+	var conds []string
+
+	if !f.IncludeDeleted {
+		conds = append(conds, "deleted_at IS NULL")
+	}
+	if f.Namespace != "" {
+		conds = append(conds, "namespace = "+args.add(f.Namespace))
+	}
+	if f.Status != "" {
+		conds = append(conds, "status = "+args.add(f.Status))
+	}
+	if len(f.Namespaces) > 0 {
+		conds = append(conds, "namespace IN "+args.list(f.Namespaces))
+	}
+	if len(f.Statuses) > 0 {
+		conds = append(conds, "status IN "+args.list(f.Statuses))
+	}
+	if len(f.Modes) > 0 {
+		conds = append(conds, "mode IN "+args.list(f.Modes))
+	}
+	if !f.From.IsZero() {
+		conds = append(conds, "started_at >= "+args.add(f.From))
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "started_at < "+args.add(f.To))
+	}
+	if f.MinErrors > 0 {
+		conds = append(conds, "error_count >= "+args.add(f.MinErrors))
+	}
+	if f.MinFixes > 0 {
+		conds = append(conds, "fix_count >= "+args.add(f.MinFixes))
 	}
 
-	query += fmt.Sprintf(" ORDER BY started_at DESC LIMIT $%d", argIdx)
-	args = append(args, limit)
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
 
-	rows, err := db.conn.Query(query, args...)
+// GetRunsFiltered returns runs matching f, newest first
+func (db *DB) GetRunsFiltered(f RunFilter) ([]Run, error) {
+	args := db.newArgs()
+	where := f.where(args)
+	columns := runColumns
+	if f.WithoutLog {
+		columns = runMetaColumns
+	}
+	if f.WithFixCounts {
+		columns += `, (SELECT COUNT(*) FROM clopus_watcher_fixes WHERE run_id = clopus_watcher_runs.id)`
+	}
+	order, err := orderBy(runSortColumns, f.Sort, DefaultRunSort)
 	if err != nil {
 		return nil, err
 	}
+	query := `SELECT ` + columns + ` FROM clopus_watcher_runs` + where + order
+	query += " LIMIT " + args.add(f.Limit) + " OFFSET " + args.add(f.Offset)
+
+	var runs []Run
+	err = db.retry(func() error {
+		rows, err := db.readPool().Query(query, args.values...)
+		if err != nil {
+			return err
+		}
+		if f.WithFixCounts {
+			runs, err = scanRunsWithFixCounts(rows)
+		} else {
+			runs, err = scanRuns(rows)
+		}
+		return err
+	})
+	return runs, err
+}
+
+// EachRun calls fn for every run matching f, newest first, without loading
+// them all into memory. A zero Limit means no limit; WithFixCounts is ignored.
+// Iteration stops at the first error fn returns.
+func (db *DB) EachRun(f RunFilter, fn func(Run) error) error {
+	order, err := orderBy(runSortColumns, f.Sort, DefaultRunSort)
+	if err != nil {
+		return err
+	}
+	columns := runColumns
+	if f.WithoutLog {
+		columns = runMetaColumns
+	}
+	args := db.newArgs()
+	query := `SELECT ` + columns + ` FROM clopus_watcher_runs` + f.where(args) + order
+	if f.Limit > 0 {
+		query += " LIMIT " + args.add(f.Limit)
+	}
+	if f.Offset > 0 {
+		query += " OFFSET " + args.add(f.Offset)
+	}
+
+	rows, err := db.readPool().Query(query, args.values...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// scanRunsWithFixCounts scans runColumns followed by the joined fix count
+func scanRunsWithFixCounts(rows *sql.Rows) ([]Run, error) {
 	defer rows.Close()
 
 	var runs []Run
 	for rows.Next() {
 		var r Run
-		err := rows.Scan(&r.ID, &r.StartedAt, &r.EndedAt, &r.Namespace, &r.Mode,
-			&r.Status, &r.PodCount, &r.ErrorCount, &r.FixCount, &r.Report, &r.Log)
-		if err != nil {
+		if err := scanRunInto(rows, &r, &r.FixCountActual); err != nil {
 			return nil, err
 		}
 		runs = append(runs, r)
 	}
-	return runs, nil
+	return runs, rows.Err()
+}
+
+// GetRunCount counts runs matching the same filters as GetRunsFiltered
+func (db *DB) GetRunCount(namespace, status string, from, to time.Time) (int, error) {
+	return db.GetRunCountFiltered(RunFilter{Namespace: namespace, Status: status, From: from, To: to})
+}
+
+// GetRunCountFiltered counts runs matching f, ignoring its Limit and Offset
+func (db *DB) GetRunCountFiltered(f RunFilter) (int, error) {
+	args := db.newArgs()
+	where := f.where(args)
+
+	var count int
+	err := db.retry(func() error {
+		return db.readPool().QueryRow(`SELECT COUNT(*) FROM clopus_watcher_runs`+where, args.values...).Scan(&count)
+	})
+	return count, err
 }
 
+// GetRun returns a run by id; soft-deleted runs are treated as missing
 func (db *DB) GetRun(id int) (*Run, error) {
 	var r Run
-	err := db.conn.QueryRow(`
-		SELECT id, started_at::text, COALESCE(ended_at::text, ''), namespace, mode, status,
-		       pod_count, error_count, fix_count, COALESCE(report, ''), COALESCE(log, '')
-		FROM clopus_watcher_runs WHERE id = $1
-	`, id).Scan(&r.ID, &r.StartedAt, &r.EndedAt, &r.Namespace, &r.Mode,
-		&r.Status, &r.PodCount, &r.ErrorCount, &r.FixCount, &r.Report, &r.Log)
+	err := db.retry(func() error {
+		var err error
+		r, err = scanRun(db.pool().QueryRow(`SELECT `+runColumns+` FROM clopus_watcher_runs WHERE id = $1 AND deleted_at IS NULL`, id))
+		return err
+	})
 	if err != nil {
-		return nil, err
+		return nil, notFound(err, ErrRunNotFound, id)
+	}
+	return &r, nil
+}
+
+// SoftDeleteRun hides a run from reads without removing its data
+func (db *DB) SoftDeleteRun(id int) error {
+	defer db.nsCache.invalidate()
+	err := db.execOne(`UPDATE clopus_watcher_runs SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
+	return notFound(err, ErrRunNotFound, id)
+}
+
+// RestoreRun undoes SoftDeleteRun
+func (db *DB) RestoreRun(id int) error {
+	defer db.nsCache.invalidate()
+	err := db.execOne(`UPDATE clopus_watcher_runs SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+	return notFound(err, ErrRunNotFound, id)
+}
+
+// execOne runs a statement expected to affect exactly one row, returning
+// sql.ErrNoRows when it affected none
+func (db *DB) execOne(query string, args ...interface{}) error {
+	res, err := db.pool().Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetRunMeta returns a run without its log, which can be very large. Log is
+// left empty and LogSize reports its length; use StreamRunLog to read it.
+func (db *DB) GetRunMeta(id int) (*Run, error) {
+	var r Run
+	err := db.retry(func() error {
+		return scanRunInto(db.pool().QueryRow(`
+			SELECT `+runMetaColumns+`, COALESCE(octet_length(log), 0)
+			FROM clopus_watcher_runs WHERE id = $1 AND deleted_at IS NULL
+		`, id), &r, &r.LogSize)
+	})
+	if err != nil {
+		return nil, notFound(err, ErrRunNotFound, id)
 	}
 	return &r, nil
 }
 
+// logChunkChars is how many characters of a log StreamRunLog reads per query
+const logChunkChars = 256 * 1024
+
+// StreamRunLog copies a run's log to w in chunks so the whole log is never
+// held in memory at once
+func (db *DB) StreamRunLog(id int, w io.Writer) error {
+	for start := 1; ; start += logChunkChars {
+		var chunk string
+		err := db.pool().QueryRow(`
+			SELECT COALESCE(substr(log, $2, $3), '')
+			FROM clopus_watcher_runs WHERE id = $1 AND deleted_at IS NULL
+		`, id, start, logChunkChars).Scan(&chunk)
+		if err != nil {
+			return notFound(err, ErrRunNotFound, id)
+		}
+		if chunk == "" {
+			return nil
+		}
+		if _, err := io.WriteString(w, chunk); err != nil {
+			return err
+		}
+	}
+}
+
+// GetLastRunAt returns when the namespace's last completed run ended, or nil
+// if it has none
+func (db *DB) GetLastRunAt(namespace string) (*time.Time, error) {
+	var lastRun nullTime
+	err := db.retry(func() error {
+		return db.pool().QueryRow(`
+			SELECT MAX(ended_at) FROM clopus_watcher_runs
+			WHERE namespace = $1 AND status != 'running' AND deleted_at IS NULL
+		`, namespace).Scan(&lastRun)
+	})
+	if err != nil || !lastRun.Valid {
+		return nil, err
+	}
+	return &lastRun.Time, nil
+}
+
+// GetLastRunTime is GetLastRunAt formatted as RFC3339, empty if the
+// namespace has no completed runs
 func (db *DB) GetLastRunTime(namespace string) (string, error) {
-	var lastRun string
-	err := db.conn.QueryRow(`
-		SELECT COALESCE(MAX(ended_at)::text, '') FROM clopus_watcher_runs WHERE namespace = $1 AND status != 'running'
-	`, namespace).Scan(&lastRun)
-	return lastRun, err
+	lastRun, err := db.GetLastRunAt(namespace)
+	if err != nil || lastRun == nil {
+		return "", err
+	}
+	return lastRun.Format(time.RFC3339), nil
 }
 
 // Namespace operations
 
+// GetNamespaces returns per-namespace run counts, leaving out archived
+// namespaces
 func (db *DB) GetNamespaces() ([]NamespaceStats, error) {
-	rows, err := db.conn.Query(`
-		SELECT
-			namespace,
-			COUNT(*) as run_count,
-			SUM(CASE WHEN status = 'ok' THEN 1 ELSE 0 END) as ok_count,
-			SUM(CASE WHEN status = 'fixed' THEN 1 ELSE 0 END) as fixed_count,
-			SUM(CASE WHEN status = 'failed' OR status = 'issues_found' THEN 1 ELSE 0 END) as failed_count
-		FROM clopus_watcher_runs
-		GROUP BY namespace
-		ORDER BY namespace
-	`)
-	if err != nil {
-		return nil, err
+	return db.ListNamespaces(false)
+}
+
+// ListNamespaces returns per-namespace run counts, including archived
+// namespaces when asked. Results are served from a short-lived cache (see
+// SetNamespacesCacheTTL).
+func (db *DB) ListNamespaces(includeArchived bool) ([]NamespaceStats, error) {
+	stats, gen, ok := db.nsCache.get()
+	if !ok {
+		var err error
+		if stats, err = db.loadNamespaces(); err != nil {
+			return nil, err
+		}
+		db.nsCache.set(stats, gen)
+	}
+	if includeArchived {
+		return stats, nil
 	}
-	defer rows.Close()
 
+	var active []NamespaceStats
+	for _, s := range stats {
+		if !s.Archived {
+			active = append(active, s)
+		}
+	}
+	return active, nil
+}
+
+func (db *DB) loadNamespaces() ([]NamespaceStats, error) {
 	var stats []NamespaceStats
-	for rows.Next() {
-		var s NamespaceStats
-		err := rows.Scan(&s.Namespace, &s.RunCount, &s.OkCount, &s.FixedCount, &s.FailedCount)
+	err := db.retry(func() error {
+		stats = nil
+		rows, err := db.queryPreparedList(`
+			SELECT
+				r.namespace,
+				COUNT(*) as run_count,
+				SUM(CASE WHEN r.status = 'ok' THEN 1 ELSE 0 END) as ok_count,
+				SUM(CASE WHEN r.status = 'fixed' THEN 1 ELSE 0 END) as fixed_count,
+				SUM(CASE WHEN r.status = 'failed' THEN 1 ELSE 0 END) as failed_count,
+				SUM(CASE WHEN r.status = 'issues_found' THEN 1 ELSE 0 END) as issues_found_count,
+				MAX(CASE WHEN a.namespace IS NOT NULL THEN 1 ELSE 0 END) as archived
+			FROM clopus_watcher_runs r
+			LEFT JOIN clopus_watcher_archived_namespaces a ON a.namespace = r.namespace
+			WHERE r.deleted_at IS NULL
+			GROUP BY r.namespace
+			ORDER BY r.namespace
+		`)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		stats = append(stats, s)
-	}
-	return stats, nil
+		defer rows.Close()
+
+		for rows.Next() {
+			var s NamespaceStats
+			var archived int
+			err := rows.Scan(&s.Namespace, &s.RunCount, &s.OkCount, &s.FixedCount, &s.FailedCount, &s.IssuesFoundCount, &archived)
+			if err != nil {
+				return err
+			}
+			s.Archived = archived == 1
+			stats = append(stats, s)
+		}
+		return rows.Err()
+	})
+	return stats, err
+}
+
+// ArchiveNamespace hides a namespace from GetNamespaces without deleting
+// its runs. Archiving an archived namespace is a no-op.
+func (db *DB) ArchiveNamespace(name string) error {
+	defer db.nsCache.invalidate()
+	_, err := db.pool().Exec(`
+		INSERT INTO clopus_watcher_archived_namespaces (namespace) VALUES ($1)
+		ON CONFLICT (namespace) DO NOTHING
+	`, name)
+	return err
+}
+
+// UnarchiveNamespace undoes ArchiveNamespace
+func (db *DB) UnarchiveNamespace(name string) error {
+	defer db.nsCache.invalidate()
+	_, err := db.pool().Exec(`DELETE FROM clopus_watcher_archived_namespaces WHERE namespace = $1`, name)
+	return err
 }
 
 func (db *DB) GetNamespaceStats(namespace string) (*NamespaceStats, error) {
 	var s NamespaceStats
 	s.Namespace = namespace
 
-	err := db.conn.QueryRow(`SELECT COUNT(*) FROM clopus_watcher_runs WHERE namespace = $1`, namespace).Scan(&s.RunCount)
+	query := `
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN status = 'ok' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN status = 'fixed' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN status = 'issues_found' THEN 1 ELSE 0 END), 0)
+		FROM clopus_watcher_runs
+		WHERE namespace = $1 AND deleted_at IS NULL
+	`
+	err := db.retry(func() error {
+		return db.pool().QueryRow(query, namespace).Scan(&s.RunCount, &s.OkCount, &s.FixedCount, &s.FailedCount, &s.IssuesFoundCount)
+	})
 	if err != nil {
 		return nil, err
 	}
-	// Count 'ok' status as ok
-	db.conn.QueryRow(`SELECT COUNT(*) FROM clopus_watcher_runs WHERE namespace = $1 AND status = 'ok'`, namespace).Scan(&s.OkCount)
-	// Count 'fixed' status as fixed
-	db.conn.QueryRow(`SELECT COUNT(*) FROM clopus_watcher_runs WHERE namespace = $1 AND status = 'fixed'`, namespace).Scan(&s.FixedCount)
-	// Count 'failed' and 'issues_found' as failed (issues that need attention)
-	db.conn.QueryRow(`SELECT COUNT(*) FROM clopus_watcher_runs WHERE namespace = $1 AND (status = 'failed' OR status = 'issues_found')`, namespace).Scan(&s.FailedCount)
 
 	return &s, nil
 }
 
 // Fix operations
 
-func (db *DB) GetFixes(limit int) ([]Fix, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, COALESCE(run_id, 0), timestamp::text, namespace, pod_name, error_type,
-		       COALESCE(error_message, ''), COALESCE(fix_applied, ''), status
-		FROM clopus_watcher_fixes
-		ORDER BY timestamp DESC
-		LIMIT $1
-	`, limit)
-	if err != nil {
-		return nil, err
-	}
+// fixColumns is the select list matching scanFix
+const fixColumns = `id, COALESCE(run_id, 0), timestamp, namespace, pod_name, error_type,
+		       COALESCE(error_message, ''), COALESCE(fix_applied, ''), status`
+
+func scanFix(row rowScanner) (Fix, error) {
+	var f Fix
+	err := row.Scan(&f.ID, &f.RunID, &f.TimestampTime, &f.Namespace, &f.PodName,
+		&f.ErrorType, &f.ErrorMessage, &f.FixApplied, &f.Status)
+	f.Timestamp = f.TimestampTime.Format(time.RFC3339)
+	return f, err
+}
+
+func scanFixes(rows *sql.Rows) ([]Fix, error) {
 	defer rows.Close()
 
 	var fixes []Fix
 	for rows.Next() {
-		var f Fix
-		err := rows.Scan(&f.ID, &f.RunID, &f.Timestamp, &f.Namespace, &f.PodName,
-			&f.ErrorType, &f.ErrorMessage, &f.FixApplied, &f.Status)
+		f, err := scanFix(rows)
 		if err != nil {
 			return nil, err
 		}
 		fixes = append(fixes, f)
 	}
-	return fixes, nil
+	return fixes, rows.Err()
+}
+
+// queryFixes runs a prepared fix query on the primary with retries, for
+// lookups by run that usually follow a write
+func (db *DB) queryFixes(query string, args ...interface{}) ([]Fix, error) {
+	return db.scanFixesRetry(db.queryPrepared, query, args...)
+}
+
+// listFixes is queryFixes for list reads, which may go to the replica
+func (db *DB) listFixes(query string, args ...interface{}) ([]Fix, error) {
+	return db.scanFixesRetry(db.queryPreparedList, query, args...)
+}
+
+func (db *DB) scanFixesRetry(queryFn func(string, ...interface{}) (*sql.Rows, error), query string, args ...interface{}) ([]Fix, error) {
+	var fixes []Fix
+	err := db.retry(func() error {
+		rows, err := queryFn(query, args...)
+		if err != nil {
+			return err
+		}
+		fixes, err = scanFixes(rows)
+		return err
+	})
+	return fixes, err
+}
+
+// SetFixDedupWindow makes CreateFix skip a fix identical to one recorded
+// within d (same run, pod, error type and fix). Zero disables deduplication.
+func (db *DB) SetFixDedupWindow(d time.Duration) {
+	db.fixDedupWindow = d
+}
+
+// CreateFix records a fix from f's RunID, Namespace, PodName, ErrorType,
+// ErrorMessage, FixApplied and Status (pending when empty). deduped reports
+// that an identical recent fix already existed and nothing was inserted.
+func (db *DB) CreateFix(f Fix) (id int64, deduped bool, err error) {
+	if f.Status == "" {
+		f.Status = "pending"
+	}
+	if db.fixDedupWindow <= 0 {
+		err = db.pool().QueryRow(`
+			INSERT INTO clopus_watcher_fixes (run_id, namespace, pod_name, error_type, error_message, fix_applied, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id
+		`, f.RunID, f.Namespace, f.PodName, f.ErrorType, f.ErrorMessage, f.FixApplied, f.Status).Scan(&id)
+		return id, false, err
+	}
+
+	tx, err := db.pool().Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	// Two identical fixes inserted at once would both pass the NOT EXISTS
+	// check, so on Postgres they take turns on an advisory lock keyed on the
+	// fix. sqlite already runs one writer at a time.
+	if db.driver == DriverPostgres {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, fixDedupKey(f)); err != nil {
+			return 0, false, err
+		}
+	}
+
+	// Insert only if no identical fix landed within the window, measured on
+	// the database clock that stamps timestamp
+	cutoff := `NOW() - make_interval(secs => $8)`
+	if db.driver == DriverSQLite {
+		cutoff = `datetime('now', '-' || $8 || ' seconds')`
+	}
+	err = tx.QueryRow(`
+		INSERT INTO clopus_watcher_fixes (run_id, namespace, pod_name, error_type, error_message, fix_applied, status)
+		SELECT $1, $2, $3, $4, $5, $6, $7
+		WHERE NOT EXISTS (
+			SELECT 1 FROM clopus_watcher_fixes
+			WHERE run_id = $1 AND pod_name = $3 AND error_type = $4
+			  AND COALESCE(fix_applied, '') = $6 AND timestamp >= `+cutoff+`
+		)
+		RETURNING id
+	`, f.RunID, f.Namespace, f.PodName, f.ErrorType, f.ErrorMessage, f.FixApplied, f.Status,
+		db.fixDedupWindow.Seconds()).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, true, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return id, false, tx.Commit()
+}
+
+// fixDedupKey is the advisory lock key for fixes CreateFix treats as
+// identical
+func fixDedupKey(f Fix) int64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d\x00%s\x00%s\x00%s", f.RunID, f.PodName, f.ErrorType, f.FixApplied)
+	return int64(h.Sum64())
+}
+
+// GetFix returns a fix by id
+func (db *DB) GetFix(id int) (*Fix, error) {
+	var f Fix
+	err := db.retry(func() error {
+		var err error
+		f, err = scanFix(db.pool().QueryRow(`SELECT `+fixColumns+` FROM clopus_watcher_fixes WHERE id = $1`, id))
+		return err
+	})
+	if err != nil {
+		return nil, notFound(err, ErrFixNotFound, id)
+	}
+	return &f, nil
+}
+
+func (db *DB) GetFixes(limit int) ([]Fix, error) {
+	return db.listFixes(`
+		SELECT `+fixColumns+`
+		FROM clopus_watcher_fixes
+		ORDER BY timestamp DESC
+		LIMIT $1
+	`, limit)
 }
 
 func (db *DB) GetFixesByRun(runID int) ([]Fix, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, COALESCE(run_id, 0), timestamp::text, namespace, pod_name, error_type,
-		       COALESCE(error_message, ''), COALESCE(fix_applied, ''), status
+	return db.queryFixes(`
+		SELECT `+fixColumns+`
 		FROM clopus_watcher_fixes
 		WHERE run_id = $1
 		ORDER BY timestamp DESC
 	`, runID)
+}
+
+// GetFixesByRunPaged returns one page of a run's fixes, newest first
+func (db *DB) GetFixesByRunPaged(runID, limit, offset int) ([]Fix, error) {
+	return db.queryFixes(`
+		SELECT `+fixColumns+`
+		FROM clopus_watcher_fixes
+		WHERE run_id = $1
+		ORDER BY timestamp DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`, runID, limit, offset)
+}
+
+// GetFixesForRuns returns the fixes of several runs with one query, keyed by
+// run id and newest first like GetFixesByRun. Runs without fixes are absent
+// from the map.
+func (db *DB) GetFixesForRuns(runIDs []int) (map[int][]Fix, error) {
+	byRun := make(map[int][]Fix)
+	if len(runIDs) == 0 {
+		return byRun, nil
+	}
+
+	ids := make([]int64, len(runIDs))
+	for i, id := range runIDs {
+		ids[i] = int64(id)
+	}
+	fixes, err := db.queryFixes(`
+		SELECT `+fixColumns+`
+		FROM clopus_watcher_fixes
+		WHERE run_id = ANY($1)
+		ORDER BY timestamp DESC
+	`, pq.Array(ids))
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	for _, f := range fixes {
+		byRun[f.RunID] = append(byRun[f.RunID], f)
+	}
+	return byRun, nil
+}
+
+// FixFilter selects fixes for GetFixesFiltered. Empty fields match
+// everything.
+type FixFilter struct {
+	Namespace string
+	Status    string
+	Sort      string // whitelisted field, "-" prefix for descending; default -timestamp
+	Limit     int
+	Offset    int
+}
+
+func (f FixFilter) where(args *queryArgs) string {
+	var conds []string
+	if f.Namespace != "" {
+		conds = append(conds, "namespace = "+args.add(f.Namespace))
+	}
+	if f.Status != "" {
+		conds = append(conds, "status = "+args.add(f.Status))
+	}
+
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// GetFixesFiltered returns a page of fixes matching f, newest first
+func (db *DB) GetFixesFiltered(f FixFilter) ([]Fix, error) {
+	order, err := orderBy(fixSortColumns, f.Sort, DefaultFixSort)
+	if err != nil {
+		return nil, err
+	}
+	args := db.newArgs()
+	query := `SELECT ` + fixColumns + ` FROM clopus_watcher_fixes` + f.where(args) + order
+	query += " LIMIT " + args.add(f.Limit) + " OFFSET " + args.add(f.Offset)
 
 	var fixes []Fix
+	err = db.retry(func() error {
+		rows, err := db.readPool().Query(query, args.values...)
+		if err != nil {
+			return err
+		}
+		fixes, err = scanFixes(rows)
+		return err
+	})
+	return fixes, err
+}
+
+// GetFixCount counts fixes matching f's filters, ignoring paging
+func (db *DB) GetFixCount(f FixFilter) (int, error) {
+	args := db.newArgs()
+	where := f.where(args)
+
+	var count int
+	err := db.retry(func() error {
+		return db.readPool().QueryRow(`SELECT COUNT(*) FROM clopus_watcher_fixes`+where, args.values...).Scan(&count)
+	})
+	return count, err
+}
+
+// EachFix calls fn for every fix matching f, newest first, without loading
+// them all into memory. A zero Limit means no limit.
+func (db *DB) EachFix(f FixFilter, fn func(Fix) error) error {
+	order, err := orderBy(fixSortColumns, f.Sort, DefaultFixSort)
+	if err != nil {
+		return err
+	}
+	args := db.newArgs()
+	query := `SELECT ` + fixColumns + ` FROM clopus_watcher_fixes` + f.where(args) + order
+	if f.Limit > 0 {
+		query += " LIMIT " + args.add(f.Limit)
+	}
+	if f.Offset > 0 {
+		query += " OFFSET " + args.add(f.Offset)
+	}
+
+	rows, err := db.readPool().Query(query, args.values...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
 	for rows.Next() {
-		var f Fix
-		err := rows.Scan(&f.ID, &f.RunID, &f.Timestamp, &f.Namespace, &f.PodName,
-			&f.ErrorType, &f.ErrorMessage, &f.FixApplied, &f.Status)
+		fix, err := scanFix(rows)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if err := fn(fix); err != nil {
+			return err
 		}
-		fixes = append(fixes, f)
 	}
-	return fixes, nil
+	return rows.Err()
+}
+
+// GetFixesByPod returns the newest fixes for a pod name, or for every pod
+// whose name starts with podName when prefix is set
+func (db *DB) GetFixesByPod(podName string, prefix bool, limit int) ([]Fix, error) {
+	cond, arg := `pod_name = $1`, podName
+	if prefix {
+		cond, arg = `pod_name LIKE $1 ESCAPE '\'`, likeEscaper.Replace(podName)+"%"
+	}
+	return db.listFixes(`
+		SELECT `+fixColumns+`
+		FROM clopus_watcher_fixes
+		WHERE `+cond+`
+		ORDER BY timestamp DESC
+		LIMIT $2
+	`, arg, limit)
+}
+
+// GetRecentFixes returns fixes recorded in the last since across every
+// namespace, newest first
+func (db *DB) GetRecentFixes(since time.Duration, limit int) ([]Fix, error) {
+	return db.listFixes(`
+		SELECT `+fixColumns+`
+		FROM clopus_watcher_fixes
+		WHERE timestamp >= $1
+		ORDER BY timestamp DESC
+		LIMIT $2
+	`, time.Now().Add(-since), limit)
+}
+
+// ReconcileFixCounts sets each run's fix_count to the number of fixes
+// actually recorded against it, returning how many runs were corrected
+func (db *DB) ReconcileFixCounts() (int, error) {
+	res, err := db.pool().Exec(`
+		UPDATE clopus_watcher_runs AS r
+		SET fix_count = c.actual
+		FROM (
+			SELECT r2.id, COUNT(f.id) as actual
+			FROM clopus_watcher_runs r2
+			LEFT JOIN clopus_watcher_fixes f ON f.run_id = r2.id
+			GROUP BY r2.id
+		) c
+		WHERE r.id = c.id AND r.fix_count IS DISTINCT FROM c.actual
+	`)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		db.nsCache.invalidate()
+	}
+	return int(n), nil
+}
+
+// UpdateFixStatus sets a fix's status and records when it entered analysis
+// (pending/analyzing) and when it was resolved (success/failed)
+func (db *DB) UpdateFixStatus(id int, status string) error {
+	_, err := db.pool().Exec(`
+		UPDATE clopus_watcher_fixes SET
+			status = $1,
+			analyzing_at = CASE WHEN $1 IN ('pending', 'analyzing') THEN COALESCE(analyzing_at, NOW()) ELSE analyzing_at END,
+			resolved_at = CASE WHEN $1 IN ('success', 'failed') THEN NOW() ELSE resolved_at END
+		WHERE id = $2
+	`, status, id)
+	return err
+}
+
+// FixStatuses are the statuses a fix can have
+var FixStatuses = []string{"pending", "analyzing", "success", "failed", "reported"}
+
+// UpdateFixStatusBatch sets the status of several fixes at once, like
+// UpdateFixStatus, returning how many were updated. Unknown ids are skipped.
+func (db *DB) UpdateFixStatusBatch(ids []int, status string) (int64, error) {
+	if !slices.Contains(FixStatuses, status) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidFixStatus, status)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	ids64 := make([]int64, len(ids))
+	for i, id := range ids {
+		ids64[i] = int64(id)
+	}
+
+	tx, err := db.pool().Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE clopus_watcher_fixes SET
+			status = $1,
+			analyzing_at = CASE WHEN $1 IN ('pending', 'analyzing') THEN COALESCE(analyzing_at, NOW()) ELSE analyzing_at END,
+			resolved_at = CASE WHEN $1 IN ('success', 'failed') THEN NOW() ELSE resolved_at END
+		WHERE id = ANY($2)
+	`, status, pq.Array(ids64))
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// GetMTTF returns the mean time to fix in seconds for fixes resolved
+// successfully in the last days days, along with the number of fixes averaged.
+// Fixes that never recorded an analyzing time are measured from detection.
+func (db *DB) GetMTTF(namespace string, days int) (seconds float64, count int, err error) {
+	query := `
+		SELECT COALESCE(AVG(EXTRACT(EPOCH FROM resolved_at - COALESCE(analyzing_at, timestamp))), 0), COUNT(*)
+		FROM clopus_watcher_fixes
+		WHERE status = 'success' AND resolved_at IS NOT NULL
+		  AND resolved_at >= NOW() - make_interval(days => $1)
+	`
+	args := []interface{}{days}
+
+	if namespace != "" {
+		query += " AND namespace = $2"
+		args = append(args, namespace)
+	}
+
+	err = db.retry(func() error {
+		return db.readPool().QueryRow(query, args...).Scan(&seconds, &count)
+	})
+	return
+}
+
+type FixSuccessRate struct {
+	Date    string
+	Success int
+	Failed  int
+	Rate    float64 // success / total fixes that day, 0 when there were none
+}
+
+// GetFixSuccessRate returns one entry per day for the last days days (oldest
+// first), including days with no fixes
+func (db *DB) GetFixSuccessRate(namespace string, days int) ([]FixSuccessRate, error) {
+	// Joining on a timestamp range rather than timestamp::date lets an index
+	// on timestamp serve each day
+	query := `
+		SELECT
+			d.day::date::text,
+			COUNT(f.id),
+			COALESCE(SUM(CASE WHEN f.status = 'success' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN f.status = 'failed' THEN 1 ELSE 0 END), 0)
+		FROM generate_series(CURRENT_DATE - ($1::int - 1), CURRENT_DATE, INTERVAL '1 day') AS d(day)
+		LEFT JOIN clopus_watcher_fixes f
+			ON f.timestamp >= d.day AND f.timestamp < d.day + INTERVAL '1 day'
+			AND ($2 = '' OR f.namespace = $2)
+		GROUP BY d.day
+		ORDER BY d.day
+	`
+
+	var rates []FixSuccessRate
+	err := db.retry(func() error {
+		rates = nil
+		rows, err := db.readPool().Query(query, days, namespace)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var r FixSuccessRate
+			var total int
+			if err := rows.Scan(&r.Date, &total, &r.Success, &r.Failed); err != nil {
+				return err
+			}
+			if total > 0 {
+				r.Rate = float64(r.Success) / float64(total)
+			}
+			rates = append(rates, r)
+		}
+		return rows.Err()
+	})
+	return rates, err
+}
+
+type PodFixCount struct {
+	PodName   string
+	FixCount  int
+	FailCount int
+}
+
+// GetTopPods returns the pods with the most recorded fixes, optionally
+// scoped to a namespace
+func (db *DB) GetTopPods(namespace string, limit int) ([]PodFixCount, error) {
+	query := `
+		SELECT pod_name, COUNT(*) as fix_count,
+		       SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) as fail_count
+		FROM clopus_watcher_fixes
+	`
+	args := db.newArgs()
+
+	if namespace != "" {
+		query += " WHERE namespace = " + args.add(namespace)
+	}
+
+	query += " GROUP BY pod_name ORDER BY fix_count DESC, pod_name LIMIT " + args.add(limit)
+
+	var pods []PodFixCount
+	err := db.retry(func() error {
+		pods = nil
+		rows, err := db.readPool().Query(query, args.values...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var p PodFixCount
+			if err := rows.Scan(&p.PodName, &p.FixCount, &p.FailCount); err != nil {
+				return err
+			}
+			pods = append(pods, p)
+		}
+		return rows.Err()
+	})
+	return pods, err
 }
 
 func (db *DB) GetStats() (total, success, failed, pending int, err error) {
-	err = db.conn.QueryRow("SELECT COUNT(*) FROM clopus_watcher_fixes").Scan(&total)
+	s, err := db.GetStatsStruct()
 	if err != nil {
 		return
 	}
-	err = db.conn.QueryRow("SELECT COUNT(*) FROM clopus_watcher_fixes WHERE status = 'success'").Scan(&success)
+	return s.Total, s.Success, s.Failed, s.Pending, nil
+}
+
+// Stats holds the fix totals returned by GetStats
+type Stats struct {
+	Total   int `json:"total"`
+	Success int `json:"success"`
+	Failed  int `json:"failed"`
+	Pending int `json:"pending"` // pending or analyzing
+}
+
+// statsQuery selects the Stats totals; callers append any WHERE clause
+const statsQuery = `
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN status = 'success' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN status = 'pending' OR status = 'analyzing' THEN 1 ELSE 0 END), 0)
+		FROM clopus_watcher_fixes`
+
+// GetStatsStruct returns the GetStats totals in one query
+func (db *DB) GetStatsStruct() (*Stats, error) {
+	var s Stats
+	err := db.retry(func() error {
+		return db.readPool().QueryRow(statsQuery).Scan(&s.Total, &s.Success, &s.Failed, &s.Pending)
+	})
 	if err != nil {
-		return
+		return nil, err
 	}
-	err = db.conn.QueryRow("SELECT COUNT(*) FROM clopus_watcher_fixes WHERE status = 'failed'").Scan(&failed)
+	return &s, nil
+}
+
+// GetStatsWindow returns the GetStatsStruct totals for fixes recorded in the
+// last since
+func (db *DB) GetStatsWindow(since time.Duration) (*Stats, error) {
+	var s Stats
+	err := db.retry(func() error {
+		return db.readPool().QueryRow(statsQuery+`
+			WHERE timestamp >= $1
+		`, time.Now().Add(-since)).Scan(&s.Total, &s.Success, &s.Failed, &s.Pending)
+	})
 	if err != nil {
-		return
+		return nil, err
 	}
-	err = db.conn.QueryRow("SELECT COUNT(*) FROM clopus_watcher_fixes WHERE status = 'pending' OR status = 'analyzing'").Scan(&pending)
-	return
+	return &s, nil
+}
+
+// SetImportRenumber makes ImportJSONResults let the database assign run ids,
+// keeping each file's id in external_id, so watchers whose ids collide don't
+// skip each other's runs. A run is then a duplicate when its external id,
+// namespace and start time were all imported before. Off by default, which
+// keeps the file's id as the run id.
+func (db *DB) SetImportRenumber(on bool) {
+	db.importRenumber = on
+}
+
+// SetImportNotifyAfter makes ImportJSONResults pass only runs that ended
+// after t to OnRunComplete. It defaults to when the DB was opened.
+func (db *DB) SetImportNotifyAfter(t time.Time) {
+	db.importNotifyAfter = t
+}
+
+// DefaultResultsGlob matches the result files the watcher writes
+const DefaultResultsGlob = "run_*.json"
+
+// SetResultsGlob sets the filepath.Match pattern of result files
+// ImportJSONResults reads, relative to its results directory. The pattern
+// must be valid and stay inside the directory.
+func (db *DB) SetResultsGlob(pattern string) error {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid results glob %q: %w", pattern, err)
+	}
+	if !filepath.IsLocal(pattern) {
+		return fmt.Errorf("invalid results glob %q: must be relative to the results directory", pattern)
+	}
+	db.resultsGlob = pattern
+	return nil
+}
+
+// ImportResult summarizes one ImportJSONResults pass
+type ImportResult struct {
+	Files    int     // result files found
+	Imported int     // runs inserted
+	Skipped  int     // runs already present
+	Errors   []error // per-file failures, *ImportError for unreadable or invalid files
+}
+
+// ImportError describes a result file ImportJSONResults couldn't use. For
+// invalid JSON, Line and Column locate the problem (1-based, 0 if unknown)
+// and Field names the offending field for type mismatches.
+type ImportError struct {
+	File   string
+	Line   int
+	Column int
+	Field  string
+	Err    error
+}
+
+func (e *ImportError) Error() string {
+	msg := e.File
+	if e.Line > 0 {
+		msg += fmt.Sprintf(":%d:%d", e.Line, e.Column)
+	}
+	if e.Field != "" {
+		msg += fmt.Sprintf(": field %q", e.Field)
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *ImportError) Unwrap() error { return e.Err }
+
+// newImportError wraps a read or json.Unmarshal error of file, locating
+// syntax and type errors within data
+func newImportError(file string, data []byte, err error) *ImportError {
+	ie := &ImportError{File: file, Err: err}
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+		ie.Field = typeErr.Field
+	}
+	if offset > 0 && offset <= int64(len(data)) {
+		before := data[:offset]
+		ie.Line = bytes.Count(before, []byte("\n")) + 1
+		ie.Column = int(offset) - (bytes.LastIndexByte(before, '\n') + 1)
+	}
+	return ie
+}
+
+// importBatchSize is how many runs ImportJSONResults inserts per statement
+const importBatchSize = 200
+
+// importedRun is a parsed watcher result file
+type importedRun struct {
+	file       string
+	ID         int64  `json:"id"`
+	StartedAt  string `json:"started_at"`
+	EndedAt    string `json:"ended_at"`
+	Namespace  string `json:"namespace"`
+	Mode       string `json:"mode"`
+	Status     string `json:"status"`
+	PodCount   int    `json:"pod_count"`
+	ErrorCount int    `json:"error_count"`
+	FixCount   int    `json:"fix_count"`
+	Report     string `json:"report"`
+	Log        string `json:"log"`
 }
 
 // ImportJSONResults imports watcher results from JSON files to PostgreSQL
-// Scans resultsDir for run_*.json files and inserts them into the database
-func (db *DB) ImportJSONResults(resultsDir string) error {
-	files, err := filepath.Glob(filepath.Join(resultsDir, "run_*.json"))
+// Scans resultsDir for run_*.json files (see SetResultsGlob) and inserts them
+// into the database in batches, skipping runs that already exist
+func (db *DB) ImportJSONResults(resultsDir string) (*ImportResult, error) {
+	pattern := db.resultsGlob
+	if pattern == "" {
+		pattern = DefaultResultsGlob
+	}
+	files, err := filepath.Glob(filepath.Join(resultsDir, pattern))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	res := &ImportResult{Files: len(files)}
+	var runs []importedRun
 	for _, file := range files {
 		data, err := os.ReadFile(file)
 		if err != nil {
+			res.Errors = append(res.Errors, newImportError(file, nil, err))
 			continue // Skip files that can't be read
 		}
 
-		var result struct {
-			ID         int64  `json:"id"`
-			StartedAt  string `json:"started_at"`
-			EndedAt    string `json:"ended_at"`
-			Namespace  string `json:"namespace"`
-			Mode       string `json:"mode"`
-			Status     string `json:"status"`
-			PodCount   int    `json:"pod_count"`
-			ErrorCount int    `json:"error_count"`
-			FixCount   int    `json:"fix_count"`
-			Report     string `json:"report"`
-			Log        string `json:"log"`
-		}
-
+		result := importedRun{file: file}
 		if err := json.Unmarshal(data, &result); err != nil {
+			res.Errors = append(res.Errors, newImportError(file, data, err))
 			continue // Skip invalid JSON files
 		}
 
-		// Check if run already exists
-		var exists bool
-		err = db.conn.QueryRow("SELECT EXISTS(SELECT 1 FROM clopus_watcher_runs WHERE id = $1)", result.ID).Scan(&exists)
-		if err != nil || exists {
-			continue // Skip if already imported
+		// Fill in missing timestamps from the file's mtime rather than the
+		// import time, so every pass derives the same started_at; with
+		// SetImportRenumber it is part of the duplicate check
+		if result.StartedAt == "" || result.EndedAt == "" {
+			info, err := os.Stat(file)
+			if err != nil {
+				res.Errors = append(res.Errors, newImportError(file, nil, err))
+				continue
+			}
+			modified := info.ModTime().UTC().Format(time.RFC3339)
+			if result.StartedAt == "" {
+				result.StartedAt = modified
+			}
+			if result.EndedAt == "" {
+				result.EndedAt = modified
+			}
 		}
+		runs = append(runs, result)
+	}
 
-		// Parse timestamps
-		startedAt := result.StartedAt
-		if startedAt == "" {
-			startedAt = time.Now().Format(time.RFC3339)
+	// imported counts attempted runs, of which inserted were new
+	imported := func(attempted int, inserted []Run) {
+		res.Imported += len(inserted)
+		res.Skipped += attempted - len(inserted)
+		for _, run := range inserted {
+			if run.EndedAtTime.After(db.importNotifyAfter) {
+				db.runCompleted(run)
+			}
 		}
-		endedAt := result.EndedAt
-		if endedAt == "" {
-			endedAt = time.Now().Format(time.RFC3339)
+	}
+	for start := 0; start < len(runs); start += importBatchSize {
+		batch := runs[start:min(start+importBatchSize, len(runs))]
+		inserted, err := db.insertImportBatch(batch)
+		if err == nil {
+			imported(len(batch), inserted)
+			continue
+		}
+		if len(batch) == 1 {
+			res.Errors = append(res.Errors, &ImportError{File: batch[0].file, Err: err})
+			continue
 		}
+		// The batch was rolled back as a whole; retry its runs one at a time
+		// so a single bad file doesn't fail the others, and each failure
+		// carries its own error
+		for _, run := range batch {
+			inserted, err := db.insertImportBatch([]importedRun{run})
+			if err != nil {
+				res.Errors = append(res.Errors, &ImportError{File: run.file, Err: err})
+				continue
+			}
+			imported(1, inserted)
+		}
+	}
 
-		// Insert run record
-		_, err = db.conn.Exec(`
-			INSERT INTO clopus_watcher_runs (id, started_at, ended_at, namespace, mode, status, pod_count, error_count, fix_count, report, log)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		`, result.ID, startedAt, endedAt, result.Namespace, result.Mode, result.Status, result.PodCount, result.ErrorCount, result.FixCount, result.Report, result.Log)
+	if res.Imported > 0 {
+		db.nsCache.invalidate()
+	}
+	return res, nil
+}
 
-		if err != nil {
-			continue // Skip files that fail to import
-		}
+// insertImportBatch inserts runs with one multi-row INSERT in a transaction,
+// ignoring ids that already exist, or with SetImportRenumber external ids
+// already imported. It returns the runs actually inserted, without their logs.
+func (db *DB) insertImportBatch(runs []importedRun) ([]Run, error) {
+	idColumn, conflict := "id", "(id)"
+	if db.importRenumber {
+		idColumn, conflict = "external_id", "(external_id, namespace, started_at) WHERE external_id IS NOT NULL"
 	}
 
-	return nil
+	args := db.newArgs()
+	values := make([]string, 0, len(runs))
+	for _, r := range runs {
+		values = append(values, "("+strings.Join([]string{
+			args.add(r.ID), args.add(r.StartedAt), args.add(r.EndedAt), args.add(r.Namespace),
+			args.add(r.Mode), args.add(r.Status), args.add(r.PodCount), args.add(r.ErrorCount),
+			args.add(r.FixCount), args.add(r.Report), args.add(r.Log),
+		}, ", ")+")")
+	}
+
+	tx, err := db.pool().Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		INSERT INTO clopus_watcher_runs (`+idColumn+`, started_at, ended_at, namespace, mode, status, pod_count, error_count, fix_count, report, log)
+		VALUES `+strings.Join(values, ", ")+`
+		ON CONFLICT `+conflict+` DO NOTHING
+		RETURNING `+runMetaColumns, args.values...)
+	if err != nil {
+		return nil, err
+	}
+	inserted, err := scanRuns(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return inserted, tx.Commit()
 }
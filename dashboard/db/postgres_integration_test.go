@@ -0,0 +1,257 @@
+//go:build postgres
+
+package db
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// openPostgresTestDB migrates a fresh schema in the database at
+// TEST_DATABASE_URL, skipping the test when it is unset. Sessions run in UTC
+// so date and hour buckets are predictable.
+func openPostgresTestDB(t *testing.T) *DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	admin, err := Open(DriverPostgres, dsn)
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.pool().Exec(`CREATE SCHEMA ` + schema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.pool().Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		admin.Close()
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("TEST_DATABASE_URL must be a postgres:// URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	q.Set("timezone", "UTC")
+	u.RawQuery = q.Encode()
+
+	db, err := Open(DriverPostgres, u.String())
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// pgRun starts a run in namespace and completes it with status unless
+// status is empty
+func pgRun(t *testing.T, db *DB, namespace, status string) int64 {
+	t.Helper()
+	id, err := db.CreateRun(namespace, ModeAutonomous)
+	if err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+	if status != "" {
+		if err := db.CompleteRun(id, status, 1, 0, 0, "", ""); err != nil {
+			t.Fatalf("CompleteRun: %v", err)
+		}
+	}
+	return id
+}
+
+// pgFix records a fix against runID with status
+func pgFix(t *testing.T, db *DB, runID int64, namespace, status string) int64 {
+	t.Helper()
+	id, _, err := db.CreateFix(Fix{RunID: int(runID), Namespace: namespace, PodName: "api", ErrorType: "CrashLoopBackOff", Status: status})
+	if err != nil {
+		t.Fatalf("CreateFix: %v", err)
+	}
+	return id
+}
+
+// pgExec runs a fixture statement, failing the test on error
+func pgExec(t *testing.T, db *DB, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := db.pool().Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+func TestPostgresGetFixesForRuns(t *testing.T) {
+	db := openPostgresTestDB(t)
+	a := pgRun(t, db, "default", "")
+	b := pgRun(t, db, "default", "")
+	c := pgRun(t, db, "default", "")
+	pgFix(t, db, a, "default", "success")
+	pgFix(t, db, a, "default", "failed")
+	pgFix(t, db, b, "default", "pending")
+	pgFix(t, db, c, "default", "pending")
+
+	byRun, err := db.GetFixesForRuns([]int{int(a), int(b), 9999})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byRun[int(a)]) != 2 || len(byRun[int(b)]) != 1 {
+		t.Errorf("fixes per run = %d, %d; want 2, 1", len(byRun[int(a)]), len(byRun[int(b)]))
+	}
+	if _, ok := byRun[int(c)]; ok {
+		t.Errorf("run %d was not requested but has fixes", c)
+	}
+}
+
+func TestPostgresGetNamespaceStatsBatch(t *testing.T) {
+	db := openPostgresTestDB(t)
+	pgRun(t, db, "alpha", "ok")
+	pgRun(t, db, "alpha", "fixed")
+	pgRun(t, db, "beta", "failed")
+	deleted := pgRun(t, db, "alpha", "failed")
+	if err := db.SoftDeleteRun(int(deleted)); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := db.GetNamespaceStatsBatch([]string{"beta", "empty", "alpha"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []NamespaceStats{
+		{Namespace: "beta", RunCount: 1, FailedCount: 1},
+		{Namespace: "empty"},
+		{Namespace: "alpha", RunCount: 2, OkCount: 1, FixedCount: 1},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("got %d stats, want %d", len(stats), len(want))
+	}
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("stats[%d] = %+v, want %+v", i, stats[i], want[i])
+		}
+	}
+}
+
+func TestPostgresGetFixSuccessRate(t *testing.T) {
+	db := openPostgresTestDB(t)
+	run := pgRun(t, db, "rate", "")
+	pgFix(t, db, run, "rate", "success")
+	pgFix(t, db, run, "rate", "failed")
+	pgFix(t, db, run, "other", "failed")
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	yesterday := pgFix(t, db, run, "rate", "success")
+	pgExec(t, db, `UPDATE clopus_watcher_fixes SET timestamp = $1 WHERE id = $2`, today.Add(-12*time.Hour), yesterday)
+
+	rates, err := db.GetFixSuccessRate("rate", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FixSuccessRate{
+		{Date: today.AddDate(0, 0, -2).Format("2006-01-02")},
+		{Date: today.AddDate(0, 0, -1).Format("2006-01-02"), Success: 1, Rate: 1},
+		{Date: today.Format("2006-01-02"), Success: 1, Failed: 1, Rate: 0.5},
+	}
+	if len(rates) != len(want) {
+		t.Fatalf("got %d days, want %d: %+v", len(rates), len(want), rates)
+	}
+	for i := range want {
+		if rates[i] != want[i] {
+			t.Errorf("day %d = %+v, want %+v", i, rates[i], want[i])
+		}
+	}
+}
+
+func TestPostgresGetMTTF(t *testing.T) {
+	db := openPostgresTestDB(t)
+	run := pgRun(t, db, "mttf", "")
+	now := time.Now()
+
+	analyzed := pgFix(t, db, run, "mttf", "success")
+	pgExec(t, db, `UPDATE clopus_watcher_fixes SET timestamp = $1, analyzing_at = $2, resolved_at = $3 WHERE id = $4`,
+		now.Add(-10*time.Minute), now.Add(-6*time.Minute), now.Add(-time.Minute), analyzed)
+	detected := pgFix(t, db, run, "mttf", "success")
+	pgExec(t, db, `UPDATE clopus_watcher_fixes SET timestamp = $1, resolved_at = $2 WHERE id = $3`,
+		now.Add(-3*time.Minute), now.Add(-time.Minute), detected)
+	old := pgFix(t, db, run, "mttf", "success")
+	pgExec(t, db, `UPDATE clopus_watcher_fixes SET timestamp = $1, resolved_at = $2 WHERE id = $3`,
+		now.AddDate(0, 0, -41), now.AddDate(0, 0, -40), old)
+	elsewhere := pgFix(t, db, run, "other", "success")
+	pgExec(t, db, `UPDATE clopus_watcher_fixes SET timestamp = $1, resolved_at = $2 WHERE id = $3`,
+		now.Add(-time.Hour), now.Add(-time.Minute), elsewhere)
+
+	seconds, count, err := db.GetMTTF("mttf", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// (300s from analyzing + 120s from detection) / 2
+	if count != 2 || math.Abs(seconds-210) > 0.01 {
+		t.Errorf("GetMTTF = %v over %d fixes, want 210 over 2", seconds, count)
+	}
+}
+
+func TestPostgresGetRunHeatmap(t *testing.T) {
+	db := openPostgresTestDB(t)
+	at := time.Now().UTC().Add(-48 * time.Hour).Truncate(time.Hour).Add(15 * time.Minute)
+	for _, ns := range []string{"heat", "heat", "other"} {
+		pgExec(t, db, `UPDATE clopus_watcher_runs SET started_at = $1 WHERE id = $2`, at, pgRun(t, db, ns, ""))
+	}
+	pgExec(t, db, `UPDATE clopus_watcher_runs SET started_at = $1 WHERE id = $2`, at.AddDate(0, 0, -35), pgRun(t, db, "heat", ""))
+
+	grid, err := db.GetRunHeatmap("heat", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, hours := range grid {
+		for _, n := range hours {
+			total += n
+		}
+	}
+	if got := grid[at.Weekday()][at.Hour()]; got != 2 || total != 2 {
+		t.Errorf("grid[%d][%d] = %d with %d runs in total, want 2 and 2", at.Weekday(), at.Hour(), got, total)
+	}
+}
+
+func TestPostgresCreateFixDedupConcurrent(t *testing.T) {
+	db := openPostgresTestDB(t)
+	db.SetFixDedupWindow(time.Hour)
+	fix := Fix{RunID: int(pgRun(t, db, "default", "")), Namespace: "default", PodName: "api", ErrorType: "OOMKilled"}
+
+	const n = 8
+	var wg sync.WaitGroup
+	var inserted atomic.Int32
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, deduped, err := db.CreateFix(fix)
+			if err != nil {
+				t.Errorf("CreateFix: %v", err)
+				return
+			}
+			if !deduped {
+				inserted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	fixes, err := db.GetFixesByRun(fix.RunID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted.Load() != 1 || len(fixes) != 1 {
+		t.Errorf("%d inserts reported, %d fixes stored; want 1", inserted.Load(), len(fixes))
+	}
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+// GetFixesForRuns queries with ANY($1), which only Postgres supports, so
+// only the no-query path is covered here
+func TestGetFixesForRunsEmpty(t *testing.T) {
+	byRun, err := (&DB{}).GetFixesForRuns(nil)
+	if err != nil || byRun == nil || len(byRun) != 0 {
+		t.Errorf("GetFixesForRuns(nil) = %v, %v; want an empty map", byRun, err)
+	}
+}
+
+func TestNewImportError(t *testing.T) {
+	tests := []struct {
+		name, data string
+		want       string
+		line, col  int
+		field      string
+	}{
+		{
+			name: "type error",
+			data: "{\n  \"id\": 1,\n  \"pod_count\": \"three\"\n}",
+			want: `results/run_1.json:3:22: field "pod_count": json: cannot unmarshal string into Go struct field importedRun.pod_count of type int`,
+			line: 3, col: 22, field: "pod_count",
+		},
+		{
+			name: "syntax error",
+			data: "{\n  \"id\": 1,\n}",
+			want: `results/run_1.json:3:1: invalid character '}' looking for beginning of object key string`,
+			line: 3, col: 1,
+		},
+	}
+	for _, tt := range tests {
+		var run importedRun
+		err := newImportError("results/run_1.json", []byte(tt.data), json.Unmarshal([]byte(tt.data), &run))
+		if err.Line != tt.line || err.Column != tt.col || err.Field != tt.field || err.Error() != tt.want {
+			t.Errorf("%s: %d:%d field %q, %q; want %d:%d field %q, %q", tt.name, err.Line, err.Column, err.Field, err.Error(), tt.line, tt.col, tt.field, tt.want)
+		}
+	}
+
+	err := newImportError("results/run_2.json", nil, fs.ErrPermission)
+	if !errors.Is(err, fs.ErrPermission) || err.Line != 0 || err.Error() != "results/run_2.json: permission denied" {
+		t.Errorf("read error = %q, want the file and cause without a position", err)
+	}
+}
+
+func TestCountValue(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want int64
+		ok   bool
+	}{
+		{3, 3, true},
+		{int64(4), 4, true},
+		{float64(5), 5, true},
+		{json.Number("6"), 6, true},
+		{0, 0, true},
+		{-1, 0, false},
+		{2.5, 0, false},
+		{json.Number("2.5"), 0, false},
+		{"7", 0, false},
+		{nil, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := countValue(tt.in)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("countValue(%#v) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSetResultsGlob(t *testing.T) {
+	db := &DB{}
+	for _, pattern := range []string{"*.json", "results-*.json", "watcher/run_*.json"} {
+		if err := db.SetResultsGlob(pattern); err != nil || db.resultsGlob != pattern {
+			t.Errorf("SetResultsGlob(%q) = %v, glob %q", pattern, err, db.resultsGlob)
+		}
+	}
+	for _, pattern := range []string{"run_[.json", "/tmp/*.json", "../*.json", ""} {
+		if err := db.SetResultsGlob(pattern); err == nil {
+			t.Errorf("SetResultsGlob(%q) succeeded", pattern)
+		}
+	}
+	if db.resultsGlob != "watcher/run_*.json" {
+		t.Errorf("glob = %q after invalid patterns, want the last valid one", db.resultsGlob)
+	}
+}
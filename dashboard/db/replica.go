@@ -0,0 +1,48 @@
+package db
+
+import "database/sql"
+
+// SetReplica sends list reads (runs, fixes, namespaces) to a read replica
+// at dsn; everything else, including single-run lookups that usually follow
+// a write, stays on the primary. Call it once at startup, after
+// SetSlowQueryThreshold if that is used.
+func (db *DB) SetReplica(dsn string) error {
+	conn, err := openPool(db.driver, dsn, db.slowQuery)
+	if err != nil {
+		return err
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return err
+	}
+
+	db.connMu.Lock()
+	db.replica, db.replicaDSN = conn, dsn
+	db.connMu.Unlock()
+	return nil
+}
+
+// replicaPool returns the current replica pool, nil when none is configured
+func (db *DB) replicaPool() *sql.DB {
+	db.connMu.RLock()
+	defer db.connMu.RUnlock()
+	return db.replica
+}
+
+// readPool returns the replica when one is configured, else the primary
+func (db *DB) readPool() *sql.DB {
+	if replica := db.replicaPool(); replica != nil {
+		return replica
+	}
+	return db.pool()
+}
+
+// ReplicaStats returns the replica pool's statistics, and false when no
+// replica is configured
+func (db *DB) ReplicaStats() (sql.DBStats, bool) {
+	replica := db.replicaPool()
+	if replica == nil {
+		return sql.DBStats{}, false
+	}
+	return replica.Stats(), true
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// StructuredReport returns the run's report as JSON sections, or nil when the
+// run only has a plain text report. A text report that happens to be a JSON
+// object is treated as structured too.
+func (r *Run) StructuredReport() map[string]interface{} {
+	raw := []byte(r.ReportJSON)
+	if len(raw) == 0 && strings.HasPrefix(strings.TrimSpace(r.Report), "{") {
+		raw = []byte(r.Report)
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var report map[string]interface{}
+	if err := json.Unmarshal(raw, &report); err != nil || len(report) == 0 {
+		return nil
+	}
+	return report
+}
+
+// GetRunReport returns a run's report as a map. Plain text reports are
+// returned as {"text": "..."}.
+func (db *DB) GetRunReport(id int) (map[string]interface{}, error) {
+	run, err := db.GetRunMeta(id)
+	if err != nil {
+		return nil, err
+	}
+	if report := run.StructuredReport(); report != nil {
+		return report, nil
+	}
+	return map[string]interface{}{"text": run.Report}, nil
+}
+
+// SetRunReportJSON stores a structured report for a run
+func (db *DB) SetRunReportJSON(id int64, report map[string]interface{}) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	err = db.execOne(`UPDATE clopus_watcher_runs SET report_json = $1 WHERE id = $2`, string(data), id)
+	return notFound(err, ErrRunNotFound, id)
+}
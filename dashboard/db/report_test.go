@@ -0,0 +1,33 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStructuredReport(t *testing.T) {
+	tests := []struct {
+		name string
+		run  Run
+		want string // the "summary" section, or "" for a nil report
+	}{
+		{"report_json", Run{ReportJSON: json.RawMessage(`{"summary": "json"}`), Report: "text"}, "json"},
+		{"json text report", Run{Report: `  {"summary": "text"}`}, "text"},
+		{"plain text", Run{Report: "all pods healthy"}, ""},
+		{"empty object", Run{ReportJSON: json.RawMessage(`{}`)}, ""},
+		{"invalid json", Run{ReportJSON: json.RawMessage(`{"summary":`)}, ""},
+		{"empty", Run{}, ""},
+	}
+	for _, tt := range tests {
+		report := tt.run.StructuredReport()
+		if tt.want == "" {
+			if report != nil {
+				t.Errorf("%s: report = %v, want nil", tt.name, report)
+			}
+			continue
+		}
+		if report["summary"] != tt.want {
+			t.Errorf("%s: report = %v, want summary %q", tt.name, report, tt.want)
+		}
+	}
+}
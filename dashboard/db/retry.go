@@ -0,0 +1,77 @@
+package db
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	defaultRetryAttempts = 3
+	retryBaseDelay       = 100 * time.Millisecond
+)
+
+// SetRetryAttempts sets how many times read queries are attempted when they
+// fail with a transient connection error. Values below 1 disable retrying.
+func (db *DB) SetRetryAttempts(n int) {
+	if n < 1 {
+		n = 1
+	}
+	db.retryAttempts = n
+}
+
+// retry runs fn, retrying with exponential backoff while it fails with a
+// transient connection error. Query and syntax errors are returned at once.
+func (db *DB) retry(fn func() error) error {
+	attempts := db.retryAttempts
+	if attempts == 0 {
+		attempts = defaultRetryAttempts
+	}
+
+	delay := retryBaseDelay
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil || !isTransient(err) {
+			return err
+		}
+		if i < attempts-1 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
+}
+
+// isTransient reports whether err looks like a dropped or refused connection
+// rather than a problem with the query itself
+func isTransient(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// Class 08 is connection exceptions; 57P01-57P03 are shutdown/startup
+		switch {
+		case pqErr.Code.Class() == "08",
+			pqErr.Code == "57P01", pqErr.Code == "57P02", pqErr.Code == "57P03":
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "bad connection") || strings.Contains(msg, "connection reset")
+}
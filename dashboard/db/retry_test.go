@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+// flakyConnector is a fake driver whose queries fail with a transient error
+// until failures runs out, then return row
+type flakyConnector struct {
+	failures int
+	err      error // returned while failing, ECONNRESET when nil
+	row      []driver.Value
+	queries  int
+}
+
+func (c *flakyConnector) Connect(context.Context) (driver.Conn, error) { return flakyConn{c}, nil }
+func (c *flakyConnector) Driver() driver.Driver                        { return nil }
+
+type flakyConn struct{ c *flakyConnector }
+
+func (fc flakyConn) Prepare(query string) (driver.Stmt, error) { return flakyStmt(fc), nil }
+func (fc flakyConn) Close() error                              { return nil }
+func (fc flakyConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type flakyStmt struct{ c *flakyConnector }
+
+func (s flakyStmt) Close() error  { return nil }
+func (s flakyStmt) NumInput() int { return -1 }
+func (s flakyStmt) Exec([]driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), s.fail()
+}
+
+func (s flakyStmt) Query([]driver.Value) (driver.Rows, error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	return &flakyRows{row: s.c.row}, nil
+}
+
+func (s flakyStmt) fail() error {
+	s.c.queries++
+	if s.c.failures == 0 {
+		return nil
+	}
+	s.c.failures--
+	if s.c.err != nil {
+		return s.c.err
+	}
+	return fmt.Errorf("read tcp: %w", syscall.ECONNRESET)
+}
+
+type flakyRows struct {
+	row  []driver.Value
+	done bool
+}
+
+func (r *flakyRows) Columns() []string {
+	cols := make([]string, len(r.row))
+	for i := range cols {
+		cols[i] = fmt.Sprintf("c%d", i)
+	}
+	return cols
+}
+
+func (r *flakyRows) Close() error { return nil }
+
+func (r *flakyRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.row)
+	return nil
+}
+
+// newFlakyDB returns a DB on c making 3 attempts per read
+func newFlakyDB(t *testing.T, c *flakyConnector) *DB {
+	t.Helper()
+	conn := sql.OpenDB(c)
+	t.Cleanup(func() { conn.Close() })
+	return &DB{driver: DriverPostgres, conn: conn, retryAttempts: 3}
+}
+
+func TestRetryTransientReads(t *testing.T) {
+	c := &flakyConnector{failures: 2, row: []driver.Value{int64(10), int64(6), int64(3), int64(1)}}
+	db := newFlakyDB(t, c)
+
+	stats, err := db.GetStatsStruct()
+	if err != nil {
+		t.Fatalf("GetStatsStruct: %v", err)
+	}
+	if *stats != (Stats{Total: 10, Success: 6, Failed: 3, Pending: 1}) {
+		t.Errorf("stats = %+v", stats)
+	}
+	if c.queries != 3 {
+		t.Errorf("queries = %d, want 2 failures then a success", c.queries)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	c := &flakyConnector{failures: 5, row: []driver.Value{float64(1), int64(1)}}
+	db := newFlakyDB(t, c)
+
+	if _, _, err := db.GetMTTF("", 30); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("GetMTTF err = %v, want the transient error", err)
+	}
+	if c.queries != 3 {
+		t.Errorf("queries = %d, want 3 attempts", c.queries)
+	}
+}
+
+func TestRetrySkipsQueryErrors(t *testing.T) {
+	syntaxErr := &pq.Error{Code: "42601", Message: "syntax error"}
+	c := &flakyConnector{failures: 1, err: syntaxErr}
+	db := newFlakyDB(t, c)
+
+	if err := db.RecordRunEvent(1, "running"); !errors.Is(err, syntaxErr) {
+		t.Errorf("RecordRunEvent err = %v, want the syntax error", err)
+	}
+	if c.queries != 1 {
+		t.Errorf("queries = %d, want no retry", c.queries)
+	}
+}
+
+func TestRetrySkipsEventInserts(t *testing.T) {
+	c := &flakyConnector{failures: 1}
+	db := newFlakyDB(t, c)
+
+	if err := db.RecordRunEvent(1, "running"); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("RecordRunEvent err = %v, want the transient error", err)
+	}
+	if c.queries != 1 {
+		t.Errorf("queries = %d, want the insert attempted once", c.queries)
+	}
+}
+
+func TestRetryNamespaceSearch(t *testing.T) {
+	c := &flakyConnector{failures: 2, row: []driver.Value{"payments"}}
+	db := newFlakyDB(t, c)
+
+	names, err := db.SearchNamespaces("pay", 10)
+	if err != nil {
+		t.Fatalf("SearchNamespaces: %v", err)
+	}
+	if len(names) != 1 || names[0] != "payments" {
+		t.Errorf("names = %v, want [payments] once", names)
+	}
+	if c.queries != 3 {
+		t.Errorf("queries = %d, want 2 failures then a success", c.queries)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{driver.ErrBadConn, true},
+		{io.ErrUnexpectedEOF, true},
+		{fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true},
+		{&pq.Error{Code: "08006"}, true},
+		{&pq.Error{Code: "57P01"}, true},
+		{&pq.Error{Code: "23505"}, false},
+		{sql.ErrNoRows, false},
+		{errors.New("driver: bad connection"), true},
+	}
+	for _, tt := range tests {
+		if got := isTransient(tt.err); got != tt.want {
+			t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
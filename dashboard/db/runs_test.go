@@ -0,0 +1,457 @@
+//go:build sqlite
+
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSoftDeleteHidesRuns(t *testing.T) {
+	db := openTestDB(t)
+	kept := addRun(t, db, "default")
+	deleted := addRun(t, db, "default")
+	if err := db.SoftDeleteRun(int(deleted)); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := db.GetRunsFiltered(RunFilter{Namespace: "default", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].ID != int(kept) {
+		t.Errorf("GetRunsFiltered = %d runs, want only run %d", len(runs), kept)
+	}
+
+	runs, err = db.GetRunsFiltered(RunFilter{Namespace: "default", IncludeDeleted: true, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Errorf("with IncludeDeleted: %d runs, want 2", len(runs))
+	}
+
+	stats, err := db.GetNamespaceStats("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RunCount != 1 {
+		t.Errorf("RunCount = %d, want deleted runs left out", stats.RunCount)
+	}
+
+	if err := db.SoftDeleteRun(int(deleted)); err == nil {
+		t.Error("deleting a deleted run succeeded")
+	}
+}
+
+func TestStreamRunLog(t *testing.T) {
+	db := openTestDB(t)
+	id := addRun(t, db, "default")
+	log := strings.Repeat("line of watcher output\n", 2*logChunkChars/20)
+	if err := db.CompleteRun(id, "ok", 0, 0, 0, "", log); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := db.StreamRunLog(int(id), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != log {
+		t.Errorf("streamed %d bytes, want the %d byte log", buf.Len(), len(log))
+	}
+
+	meta, err := db.GetRunMeta(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Log != "" || meta.LogSize != len(log) {
+		t.Errorf("GetRunMeta: Log has %d bytes, LogSize %d; want none and %d", len(meta.Log), meta.LogSize, len(log))
+	}
+
+	if err := db.StreamRunLog(int(id)+1, &buf); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("missing run: err = %v, want ErrRunNotFound", err)
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	db := openTestDB(t)
+	id := addRun(t, db, "default")
+	if err := db.CompleteRun(id, "ok", 0, 0, 0, "plain text", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := db.GetRunReport(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 1 || report["text"] != "plain text" {
+		t.Errorf("text report = %v, want {text: plain text}", report)
+	}
+
+	if err := db.SetRunReportJSON(id, map[string]interface{}{"summary": "one pod fixed"}); err != nil {
+		t.Fatal(err)
+	}
+	report, err = db.GetRunReport(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report["summary"] != "one pod fixed" {
+		t.Errorf("structured report = %v", report)
+	}
+
+	if err := db.SetRunReportJSON(id+1, nil); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("SetRunReportJSON(missing): err = %v, want ErrRunNotFound", err)
+	}
+}
+
+func TestGetRunsFilteredWithFixCounts(t *testing.T) {
+	db := openTestDB(t)
+	run := addRun(t, db, "default")
+	addFix(t, db, run, "default", "api", "success")
+	addFix(t, db, run, "default", "web", "failed")
+	empty := addRun(t, db, "default")
+
+	runs, err := db.GetRunsFiltered(RunFilter{WithFixCounts: true, Sort: "id", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].ID != int(run) || runs[0].FixCountActual != 2 ||
+		runs[1].ID != int(empty) || runs[1].FixCountActual != 0 {
+		t.Errorf("runs = %+v, want fix counts 2 and 0", runs)
+	}
+}
+
+func TestReconcileFixCounts(t *testing.T) {
+	db := openTestDB(t)
+	run := addRun(t, db, "default")
+	addFix(t, db, run, "default", "api", "success")
+	addFix(t, db, run, "default", "web", "success")
+	if err := db.CompleteRun(run, "fixed", 2, 2, 5, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	correct := addRun(t, db, "default")
+	if err := db.CompleteRun(correct, "ok", 1, 0, 0, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := db.ReconcileFixCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("corrected %d runs, want 1", n)
+	}
+	got, err := db.GetRun(int(run))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FixCount != 2 {
+		t.Errorf("fix_count = %d, want 2", got.FixCount)
+	}
+
+	if n, err := db.ReconcileFixCounts(); err != nil || n != 0 {
+		t.Errorf("second pass = %d, %v; want nothing to correct", n, err)
+	}
+}
+
+func TestGetRunsFilteredSort(t *testing.T) {
+	db := openTestDB(t)
+	for _, namespace := range []string{"b", "c", "a"} {
+		addRun(t, db, namespace)
+	}
+
+	runs, err := db.GetRunsFiltered(RunFilter{Sort: "namespace", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	for _, run := range runs {
+		got += run.Namespace
+	}
+	if got != "abc" {
+		t.Errorf("sorted by namespace = %q, want abc", got)
+	}
+
+	if _, err := db.GetRunsFiltered(RunFilter{Sort: "log", Limit: 10}); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("sort by log: err = %v, want ErrInvalidSort", err)
+	}
+}
+
+func TestTimestampsRFC3339(t *testing.T) {
+	db := openTestDB(t)
+	id := addRun(t, db, "default")
+	fixID := addFix(t, db, id, "default", "api", "success")
+
+	run, err := db.GetRun(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.EndedAt != "" || !run.EndedAtTime.IsZero() {
+		t.Errorf("running run ended at %q (%v), want empty", run.EndedAt, run.EndedAtTime)
+	}
+	if err := db.CompleteRun(id, "ok", 0, 0, 0, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if run, err = db.GetRun(int(id)); err != nil {
+		t.Fatal(err)
+	}
+	fix, err := db.GetFix(int(fixID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, ts := range map[string]struct {
+		text string
+		time time.Time
+	}{
+		"run started_at": {run.StartedAt, run.StartedAtTime},
+		"run ended_at":   {run.EndedAt, run.EndedAtTime},
+		"fix timestamp":  {fix.Timestamp, fix.TimestampTime},
+	} {
+		parsed, err := time.Parse(time.RFC3339, ts.text)
+		if err != nil {
+			t.Errorf("%s %q is not RFC3339: %v", name, ts.text, err)
+			continue
+		}
+		if !parsed.Equal(ts.time.Truncate(time.Second)) {
+			t.Errorf("%s %q, want %v", name, ts.text, ts.time)
+		}
+	}
+}
+
+// TestCompleteRunOnce checks a second completion neither overwrites the
+// first nor notifies OnRunComplete again
+func TestCompleteRunOnce(t *testing.T) {
+	db := openTestDB(t)
+	var completed []Run
+	db.OnRunComplete(func(run Run) { completed = append(completed, run) })
+	id := addRun(t, db, "default")
+
+	if err := db.CompleteRun(id, "fixed", 3, 1, 1, "first", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CompleteRun(id, "failed", 0, 0, 0, "second", ""); !errors.Is(err, ErrRunNotRunning) {
+		t.Errorf("second CompleteRun: err = %v, want ErrRunNotRunning", err)
+	}
+
+	run, err := db.GetRun(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != "fixed" || run.Report != "first" {
+		t.Errorf("run = %s %q, want the first completion kept", run.Status, run.Report)
+	}
+	if len(completed) != 1 || completed[0].ID != int(id) || completed[0].Status != "fixed" {
+		t.Errorf("OnRunComplete calls = %+v, want one for the first completion", completed)
+	}
+}
+
+func TestIncrementRunCounters(t *testing.T) {
+	db := openTestDB(t)
+	id := addRun(t, db, "default")
+	for _, delta := range [][2]int{{2, 0}, {1, 1}, {0, 2}} {
+		if err := db.IncrementRunCounters(id, delta[0], delta[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run, err := db.GetRun(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.ErrorCount != 3 || run.FixCount != 3 {
+		t.Errorf("counts = %d errors, %d fixes; want 3 and 3", run.ErrorCount, run.FixCount)
+	}
+	if err := db.IncrementRunCounters(id+1, 1, 1); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("missing run: err = %v, want ErrRunNotFound", err)
+	}
+}
+
+func TestGetRunsFilteredMinCounts(t *testing.T) {
+	db := openTestDB(t)
+	for _, counts := range [][2]int{{0, 0}, {2, 1}, {5, 0}, {5, 3}} {
+		if err := db.CompleteRun(addRun(t, db, "default"), "ok", 1, counts[0], counts[1], "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		filter RunFilter
+		want   int
+	}{
+		{RunFilter{}, 4},
+		{RunFilter{MinErrors: 2}, 3},
+		{RunFilter{MinErrors: 5}, 2},
+		{RunFilter{MinFixes: 1}, 2},
+		{RunFilter{MinErrors: 5, MinFixes: 1}, 1},
+		{RunFilter{MinErrors: 6}, 0},
+	} {
+		tt.filter.Limit = 10
+		runs, err := db.GetRunsFiltered(tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(runs) != tt.want {
+			t.Errorf("min errors %d, min fixes %d: %d runs, want %d", tt.filter.MinErrors, tt.filter.MinFixes, len(runs), tt.want)
+		}
+	}
+}
+
+func TestRetryRun(t *testing.T) {
+	db := openTestDB(t)
+	parent, err := db.CreateRun("prod", ModeReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CompleteRun(parent, "failed", 0, 0, 0, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	child, err := db.RetryRun(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := db.GetRun(int(child))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Namespace != "prod" || run.Mode != string(ModeReport) || run.Status != "running" || run.ParentRunID != int(parent) {
+		t.Errorf("retry = %+v, want a running prod report run with parent %d", run, parent)
+	}
+
+	if err := db.SoftDeleteRun(int(parent)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RetryRun(parent); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("retrying a deleted run: err = %v, want ErrRunNotFound", err)
+	}
+}
+
+func TestGetRunLineage(t *testing.T) {
+	db := openTestDB(t)
+	root := addRun(t, db, "default")
+	retry1, err := db.RetryRun(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retry2, err := db.RetryRun(retry1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sibling, err := db.RetryRun(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unrelated := addRun(t, db, "default")
+
+	want := []int64{root, retry1, retry2, sibling}
+	for _, id := range want {
+		runs, err := db.GetRunLineage(int(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int64
+		for _, run := range runs {
+			got = append(got, int64(run.ID))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("GetRunLineage(%d) = %v, want %v", id, got, want)
+		}
+	}
+
+	if runs, err := db.GetRunLineage(int(unrelated)); err != nil || len(runs) != 1 {
+		t.Errorf("GetRunLineage(unrelated) = %d runs, %v; want just itself", len(runs), err)
+	}
+	if _, err := db.GetRunLineage(9999); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("GetRunLineage(missing): err = %v, want ErrRunNotFound", err)
+	}
+}
+
+// TestGetRunLineageCycle checks a corrupt parent cycle ends the walk
+func TestGetRunLineageCycle(t *testing.T) {
+	db := openTestDB(t)
+	a := addRun(t, db, "default")
+	b, err := db.RetryRun(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.pool().Exec(`UPDATE clopus_watcher_runs SET parent_run_id = ? WHERE id = ?`, b, a); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := db.GetRunLineage(int(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Errorf("lineage of a cycle = %d runs, want 2", len(runs))
+	}
+}
+
+func TestUpdateRun(t *testing.T) {
+	db := openTestDB(t)
+	var completed []Run
+	db.OnRunComplete(func(run Run) { completed = append(completed, run) })
+	id := addRun(t, db, "default")
+	if err := db.UpdateRunProgress(id, 5, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.UpdateRun(id, map[string]interface{}{"status": "fixed"}); err != nil {
+		t.Fatal(err)
+	}
+	run, err := db.GetRun(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != "fixed" || run.EndedAt == "" || run.PodCount != 5 || run.ErrorCount != 2 {
+		t.Errorf("run after status update = %+v, want it completed with its counts kept", run)
+	}
+	if len(completed) != 1 || completed[0].Status != "fixed" {
+		t.Errorf("OnRunComplete calls = %+v, want one for the completion", completed)
+	}
+
+	if err := db.UpdateRun(id, map[string]interface{}{"fix_count": float64(2), "mode": "report"}); err != nil {
+		t.Fatal(err)
+	}
+	if run, err = db.GetRun(int(id)); err != nil || run.FixCount != 2 || run.Mode != "report" {
+		t.Errorf("run after two-field update = %+v, %v", run, err)
+	}
+
+	for name, fields := range map[string]map[string]interface{}{
+		"no fields":      {},
+		"unknown field":  {"status": "ok", "log": "rewritten"},
+		"id":             {"id": 7},
+		"wrong type":     {"status": 1},
+		"unknown status": {"status": "done"},
+		"running":        {"status": "running"},
+		"negative":       {"pod_count": -1},
+		"invalid mode":   {"mode": "scan"},
+	} {
+		if err := db.UpdateRun(id, fields); !errors.Is(err, ErrInvalidRunUpdate) {
+			t.Errorf("%s: err = %v, want ErrInvalidRunUpdate", name, err)
+		}
+	}
+
+	// A finished run can't be completed again with another status
+	if err := db.UpdateRun(id, map[string]interface{}{"status": "failed"}); !errors.Is(err, ErrRunNotRunning) {
+		t.Errorf("reopening a finished run: err = %v, want ErrRunNotRunning", err)
+	}
+	if run, err = db.GetRun(int(id)); err != nil || run.Status != "fixed" {
+		t.Errorf("run after rejected updates = %+v, %v; want it unchanged", run, err)
+	}
+	if len(completed) != 1 {
+		t.Errorf("%d OnRunComplete calls, want only the first completion", len(completed))
+	}
+
+	if err := db.UpdateRun(id+1, map[string]interface{}{"status": "ok"}); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("missing run: err = %v, want ErrRunNotFound", err)
+	}
+	if err := db.UpdateRun(id+1, map[string]interface{}{"report": "r"}); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("missing run without status: err = %v, want ErrRunNotFound", err)
+	}
+}
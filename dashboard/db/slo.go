@@ -0,0 +1,68 @@
+package db
+
+import "time"
+
+// defaultSLOTarget is the success ratio GetErrorBudget measures against when
+// SetSLOTarget wasn't called
+const defaultSLOTarget = 0.99
+
+// SetSLOTarget sets the fraction of runs (between 0 and 1) expected to end
+// ok or fixed, used by GetErrorBudget
+func (db *DB) SetSLOTarget(target float64) {
+	db.sloTarget = target
+}
+
+// ErrorBudget compares a namespace's share of good runs (ok or fixed) over
+// a window against the SLO target. Runs still running are not counted.
+type ErrorBudget struct {
+	Namespace string  `json:"namespace"`
+	Days      int     `json:"days"`
+	Target    float64 `json:"target"`
+	Total     int     `json:"total"`
+	Good      int     `json:"good"`
+	Ratio     float64 `json:"ratio"`   // Good / Total; 1 without runs
+	Allowed   float64 `json:"allowed"` // bad runs the target allows for Total
+	// Remaining is the fraction of the budget left: 1 untouched, 0 used up,
+	// negative when the target is missed
+	Remaining float64 `json:"remaining"`
+	Met       bool    `json:"met"`
+}
+
+// GetErrorBudget computes namespace's error budget over the last days days
+func (db *DB) GetErrorBudget(namespace string, days int) (*ErrorBudget, error) {
+	b := &ErrorBudget{Namespace: namespace, Days: days, Target: db.sloTarget}
+	if b.Target <= 0 || b.Target >= 1 {
+		b.Target = defaultSLOTarget
+	}
+
+	err := db.retry(func() error {
+		return db.readPool().QueryRow(`
+			SELECT
+				COUNT(*),
+				COALESCE(SUM(CASE WHEN status IN ('ok', 'fixed') THEN 1 ELSE 0 END), 0)
+			FROM clopus_watcher_runs
+			WHERE namespace = $1 AND status <> 'running' AND deleted_at IS NULL
+			  AND started_at >= $2
+		`, namespace, time.Now().AddDate(0, 0, -days)).Scan(&b.Total, &b.Good)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b.Ratio = 1
+	if b.Total > 0 {
+		b.Ratio = float64(b.Good) / float64(b.Total)
+	}
+	b.Allowed = (1 - b.Target) * float64(b.Total)
+	bad := float64(b.Total - b.Good)
+	switch {
+	case bad == 0:
+		b.Remaining = 1
+	case b.Allowed > 0:
+		b.Remaining = 1 - bad/b.Allowed
+	default:
+		b.Remaining = -bad
+	}
+	b.Met = b.Ratio >= b.Target
+	return b, nil
+}
@@ -0,0 +1,74 @@
+//go:build sqlite
+
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// addRuns records n runs in namespace that ended with status
+func addRuns(t *testing.T, db *DB, namespace, status string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := db.CompleteRun(addRun(t, db, namespace), status, 1, 0, 0, "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetErrorBudget(t *testing.T) {
+	db := openTestDB(t)
+	db.SetSLOTarget(0.9)
+
+	addRuns(t, db, "meeting", "ok", 6)
+	addRuns(t, db, "meeting", "fixed", 3)
+	addRuns(t, db, "meeting", "failed", 1)
+	addRun(t, db, "meeting")
+	old := addRun(t, db, "meeting")
+	if err := db.CompleteRun(old, "failed", 1, 1, 0, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.pool().Exec(`UPDATE clopus_watcher_runs SET started_at = $1 WHERE id = $2`, time.Now().AddDate(0, 0, -40), old); err != nil {
+		t.Fatal(err)
+	}
+
+	addRuns(t, db, "missing", "ok", 7)
+	addRuns(t, db, "missing", "issues_found", 2)
+	addRuns(t, db, "missing", "failed", 1)
+
+	tests := []struct {
+		namespace string
+		want      ErrorBudget
+	}{
+		{"meeting", ErrorBudget{Total: 10, Good: 9, Ratio: 0.9, Allowed: 1, Remaining: 0, Met: true}},
+		{"missing", ErrorBudget{Total: 10, Good: 7, Ratio: 0.7, Allowed: 1, Remaining: -2, Met: false}},
+		{"empty", ErrorBudget{Ratio: 1, Remaining: 1, Met: true}},
+	}
+	for _, tt := range tests {
+		got, err := db.GetErrorBudget(tt.namespace, 30)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.want.Namespace, tt.want.Days, tt.want.Target = tt.namespace, 30, 0.9
+		if !approxBudget(*got, tt.want) {
+			t.Errorf("%s: budget = %+v, want %+v", tt.namespace, *got, tt.want)
+		}
+	}
+
+	db.SetSLOTarget(0)
+	got, err := db.GetErrorBudget("meeting", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Target != defaultSLOTarget || got.Met {
+		t.Errorf("default target: budget = %+v, want target %v missed", *got, defaultSLOTarget)
+	}
+}
+
+// approxBudget compares budgets allowing for float rounding
+func approxBudget(a, b ErrorBudget) bool {
+	near := func(x, y float64) bool { return x-y < 1e-9 && y-x < 1e-9 }
+	return a.Namespace == b.Namespace && a.Days == b.Days && a.Total == b.Total && a.Good == b.Good && a.Met == b.Met &&
+		near(a.Target, b.Target) && near(a.Ratio, b.Ratio) && near(a.Allowed, b.Allowed) && near(a.Remaining, b.Remaining)
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// SetSlowQueryThreshold logs every query taking longer than d at WARN level,
+// with its duration. The pool is reopened with a timing wrapper around the
+// driver; d <= 0 reopens it without one, so there is no cost when disabled.
+func (db *DB) SetSlowQueryThreshold(d time.Duration) error {
+	db.slowQuery = max(d, 0)
+	return db.reconnect(context.Background(), db.dsn, &db.conn)
+}
+
+// wrapSlowQueries returns a pool like conn whose driver times every query.
+// conn is only used for its driver and is closed.
+func wrapSlowQueries(conn *sql.DB, dsn string, threshold time.Duration) *sql.DB {
+	drv := slowQueryDriver{Driver: conn.Driver(), threshold: threshold}
+	conn.Close()
+	return sql.OpenDB(slowQueryConnector{drv: drv, dsn: dsn})
+}
+
+type slowQueryConnector struct {
+	drv slowQueryDriver
+	dsn string
+}
+
+func (c slowQueryConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.drv.Open(c.dsn)
+}
+
+func (c slowQueryConnector) Driver() driver.Driver {
+	return c.drv
+}
+
+type slowQueryDriver struct {
+	driver.Driver
+	threshold time.Duration
+}
+
+func (d slowQueryDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return slowQueryConn{Conn: conn, threshold: d.threshold}, nil
+}
+
+// slowQueryConn times queries and forwards the optional driver interfaces
+// database/sql relies on, such as Pinger for the health check
+type slowQueryConn struct {
+	driver.Conn
+	threshold time.Duration
+}
+
+func (c slowQueryConn) logIfSlow(query string, start time.Time) {
+	if elapsed := time.Since(start); elapsed > c.threshold {
+		slog.Warn("slow query", "duration", elapsed, "query", strings.Join(strings.Fields(query), " "))
+	}
+}
+
+func (c slowQueryConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return slowQueryStmt{Stmt: stmt, conn: c, query: query}, nil
+}
+
+func (c slowQueryConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer c.logIfSlow(query, time.Now())
+	return q.QueryContext(ctx, query, args)
+}
+
+func (c slowQueryConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer c.logIfSlow(query, time.Now())
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c slowQueryConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c slowQueryConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c slowQueryConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c slowQueryConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+type slowQueryStmt struct {
+	driver.Stmt
+	conn  slowQueryConn
+	query string
+}
+
+func (s slowQueryStmt) Exec(args []driver.Value) (driver.Result, error) {
+	defer s.conn.logIfSlow(s.query, time.Now())
+	return s.Stmt.Exec(args)
+}
+
+func (s slowQueryStmt) Query(args []driver.Value) (driver.Rows, error) {
+	defer s.conn.logIfSlow(s.query, time.Now())
+	return s.Stmt.Query(args)
+}
@@ -0,0 +1,58 @@
+//go:build sqlite
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureLogs sends slog output to the returned buffer for the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestSlowQueryThreshold(t *testing.T) {
+	db := openTestDB(t)
+	logs := captureLogs(t)
+
+	if err := db.SetSlowQueryThreshold(time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	id := addRun(t, db, "default")
+	if _, err := db.GetRun(int(id)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), `msg="slow query"`) || !strings.Contains(logs.String(), "clopus_watcher_runs") {
+		t.Errorf("logs = %q, want slow query entries", logs)
+	}
+	if err := db.Ping(context.Background()); err != nil {
+		t.Errorf("Ping through the wrapper: %v", err)
+	}
+
+	logs.Reset()
+	if err := db.SetSlowQueryThreshold(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetRun(int(id)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetSlowQueryThreshold(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetRun(int(id)); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(logs.String(), "slow query") {
+		t.Errorf("logs = %q, want no slow queries under the threshold or when disabled", logs)
+	}
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidSort is returned for a sort field outside the whitelist
+var ErrInvalidSort = errors.New("invalid sort field")
+
+// Sortable fields, mapped to the SQL they sort by. Only these strings ever
+// reach an ORDER BY.
+var (
+	runSortColumns = map[string]string{
+		"id":          "id",
+		"started_at":  "started_at",
+		"ended_at":    "ended_at",
+		"namespace":   "namespace",
+		"status":      "status",
+		"mode":        "mode",
+		"pod_count":   "pod_count",
+		"error_count": "error_count",
+		"fix_count":   "fix_count",
+	}
+	fixSortColumns = map[string]string{
+		"id":         "id",
+		"timestamp":  "timestamp",
+		"namespace":  "namespace",
+		"pod_name":   "pod_name",
+		"error_type": "error_type",
+		"status":     "status",
+	}
+)
+
+// Default sorts when RunFilter.Sort or FixFilter.Sort is empty: newest first
+const (
+	DefaultRunSort = "-started_at"
+	DefaultFixSort = "-timestamp"
+)
+
+// sortColumn looks up field in whitelist. A leading "-" sorts descending.
+func sortColumn(whitelist map[string]string, field string) (string, bool) {
+	dir := " ASC"
+	if strings.HasPrefix(field, "-") {
+		field, dir = field[1:], " DESC"
+	}
+	column, ok := whitelist[field]
+	if !ok {
+		return "", false
+	}
+	return column + dir, true
+}
+
+// orderBy builds an ORDER BY clause for field, falling back to def when field
+// is empty. id breaks ties so paging is stable.
+func orderBy(whitelist map[string]string, field, def string) (string, error) {
+	if field == "" {
+		field = def
+	}
+	column, ok := sortColumn(whitelist, field)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrInvalidSort, field)
+	}
+	return " ORDER BY " + column + ", id DESC", nil
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOrderBy(t *testing.T) {
+	tests := []struct {
+		field   string
+		want    string
+		wantErr bool
+	}{
+		{"", " ORDER BY started_at DESC, id DESC", false},
+		{"namespace", " ORDER BY namespace ASC, id DESC", false},
+		{"-error_count", " ORDER BY error_count DESC, id DESC", false},
+		{"log", "", true},
+		{"started_at; DROP TABLE clopus_watcher_runs", "", true},
+		{"--started_at", "", true},
+	}
+	for _, tt := range tests {
+		got, err := orderBy(runSortColumns, tt.field, DefaultRunSort)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidSort) {
+				t.Errorf("orderBy(%q): err = %v, want ErrInvalidSort", tt.field, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("orderBy(%q) = %q, %v; want %q", tt.field, got, err, tt.want)
+		}
+	}
+}
+
+// TestDefaultSortsWhitelisted guards against a default sort that would make
+// every unsorted query fail
+func TestDefaultSortsWhitelisted(t *testing.T) {
+	if _, ok := sortColumn(runSortColumns, DefaultRunSort); !ok {
+		t.Errorf("DefaultRunSort %q is not a run sort column", DefaultRunSort)
+	}
+	if _, ok := sortColumn(fixSortColumns, DefaultFixSort); !ok {
+		t.Errorf("DefaultFixSort %q is not a fix sort column", DefaultFixSort)
+	}
+}
@@ -0,0 +1,78 @@
+//go:build sqlite
+
+package db
+
+import (
+	"database/sql"
+
+	"modernc.org/sqlite"
+)
+
+// sqliteSchema mirrors migrations/ for local development databases;
+// TestSQLiteSchemaMatchesMigrations fails when the two drift apart
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS clopus_watcher_runs (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    started_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ended_at    TIMESTAMP,
+    namespace   TEXT NOT NULL,
+    mode        TEXT NOT NULL,
+    status      TEXT NOT NULL,
+    pod_count   INTEGER NOT NULL DEFAULT 0,
+    error_count INTEGER NOT NULL DEFAULT 0,
+    fix_count   INTEGER NOT NULL DEFAULT 0,
+    report      TEXT,
+    report_json TEXT,
+    log         TEXT,
+    deleted_at  TIMESTAMP,
+    parent_run_id INTEGER REFERENCES clopus_watcher_runs(id) ON DELETE SET NULL,
+    external_id INTEGER
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS clopus_watcher_runs_external_id_idx
+    ON clopus_watcher_runs (external_id, namespace, started_at) WHERE external_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS clopus_watcher_fixes (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id        INTEGER REFERENCES clopus_watcher_runs(id) ON DELETE CASCADE,
+    timestamp     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    namespace     TEXT NOT NULL,
+    pod_name      TEXT NOT NULL,
+    error_type    TEXT NOT NULL,
+    error_message TEXT,
+    fix_applied   TEXT,
+    status        TEXT NOT NULL DEFAULT 'pending',
+    analyzing_at  TIMESTAMP,
+    resolved_at   TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS clopus_watcher_artifacts (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id       INTEGER NOT NULL REFERENCES clopus_watcher_runs(id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size         INTEGER NOT NULL,
+    data         BLOB NOT NULL,
+    created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS clopus_watcher_run_events (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id     INTEGER NOT NULL REFERENCES clopus_watcher_runs(id) ON DELETE CASCADE,
+    status     TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS clopus_watcher_archived_namespaces (
+    namespace   TEXT PRIMARY KEY,
+    archived_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+func init() {
+	sql.Register(sqliteDriverName, sqliteDriver{&sqlite.Driver{}})
+	initSQLiteSchema = func(conn *sql.DB) error {
+		_, err := conn.Exec(sqliteSchema)
+		return err
+	}
+}
@@ -0,0 +1,232 @@
+//go:build sqlite
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// openTestDB opens a fresh sqlite database in the test's temp dir
+func openTestDB(t testing.TB) *DB {
+	t.Helper()
+	db, err := Open(DriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+var (
+	createTableRe = regexp.MustCompile(`(?is)CREATE TABLE IF NOT EXISTS (\w+) \((.*?)\n\);`)
+	addColumnRe   = regexp.MustCompile(`(?i)ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+)`)
+)
+
+// migrationColumns replays the CREATE TABLE and ADD COLUMN statements of
+// migrations/ into table -> sorted column names
+func migrationColumns(t *testing.T) map[string][]string {
+	t.Helper()
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := map[string][]string{}
+	for _, entry := range entries {
+		script, err := migrationsFS.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range createTableRe.FindAllStringSubmatch(string(script), -1) {
+			for _, line := range strings.Split(m[2], "\n") {
+				fields := strings.Fields(line)
+				if len(fields) > 0 {
+					tables[m[1]] = append(tables[m[1]], fields[0])
+				}
+			}
+		}
+		for _, m := range addColumnRe.FindAllStringSubmatch(string(script), -1) {
+			tables[m[1]] = append(tables[m[1]], m[2])
+		}
+	}
+	for _, cols := range tables {
+		sort.Strings(cols)
+	}
+	return tables
+}
+
+// TestSQLiteSchemaMatchesMigrations keeps sqliteSchema in step with the
+// Postgres migrations: every table and column must exist in both
+func TestSQLiteSchemaMatchesMigrations(t *testing.T) {
+	db := openTestDB(t)
+	want := migrationColumns(t)
+	if len(want) == 0 {
+		t.Fatal("no tables parsed from migrations")
+	}
+
+	rows, err := db.pool().Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE 'clopus_watcher_%'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if len(tables) != len(want) {
+		t.Errorf("sqlite tables = %v, migrations define %d tables", tables, len(want))
+	}
+
+	for table, wantCols := range want {
+		rows, err := db.pool().Query(fmt.Sprintf(`SELECT name FROM pragma_table_info('%s')`, table))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, name)
+		}
+		rows.Close()
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(wantCols, ",") {
+			t.Errorf("%s columns:\n sqlite:     %v\n migrations: %v", table, got, wantCols)
+		}
+	}
+}
+
+func TestRunCRUD(t *testing.T) {
+	db := openTestDB(t)
+
+	id, err := db.CreateRun("default", ModeWatcher)
+	if err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+
+	run, err := db.GetRun(int(id))
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if run.Namespace != "default" || run.Status != "running" || run.EndedAt != "" {
+		t.Errorf("new run = %+v, want a running run in default", run)
+	}
+
+	if err := db.CompleteRun(id, "fixed", 3, 2, 1, "report", "log line"); err != nil {
+		t.Fatalf("CompleteRun: %v", err)
+	}
+	run, err = db.GetRun(int(id))
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if run.Status != "fixed" || run.PodCount != 3 || run.ErrorCount != 2 || run.FixCount != 1 ||
+		run.Report != "report" || run.Log != "log line" || run.EndedAt == "" {
+		t.Errorf("completed run = %+v", run)
+	}
+	if err := db.CompleteRun(id, "ok", 0, 0, 0, "", ""); !errors.Is(err, ErrRunNotRunning) {
+		t.Errorf("completing twice: err = %v, want ErrRunNotRunning", err)
+	}
+
+	runs, err := db.GetRuns("default", 10)
+	if err != nil {
+		t.Fatalf("GetRuns: %v", err)
+	}
+	if len(runs) != 1 || runs[0].ID != int(id) || runs[0].Log != "" {
+		t.Errorf("GetRuns = %+v, want run %d without its log", runs, id)
+	}
+
+	if err := db.SoftDeleteRun(int(id)); err != nil {
+		t.Fatalf("SoftDeleteRun: %v", err)
+	}
+	if _, err := db.GetRun(int(id)); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("GetRun after delete: err = %v, want ErrRunNotFound", err)
+	}
+	if err := db.RestoreRun(int(id)); err != nil {
+		t.Fatalf("RestoreRun: %v", err)
+	}
+	if _, err := db.GetRun(int(id)); err != nil {
+		t.Errorf("GetRun after restore: %v", err)
+	}
+
+	if _, err := db.GetRun(int(id) + 1); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("GetRun(missing): err = %v, want ErrRunNotFound", err)
+	}
+}
+
+func TestCreateRunInvalidMode(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.CreateRun("default", Mode("scan")); !errors.Is(err, ErrInvalidMode) {
+		t.Errorf("CreateRun(scan): err = %v, want ErrInvalidMode", err)
+	}
+	runs, err := db.GetRuns("default", 10)
+	if err != nil || len(runs) != 0 {
+		t.Errorf("runs = %+v, %v; want none created", runs, err)
+	}
+}
+
+func TestLookupsNotFound(t *testing.T) {
+	db := openTestDB(t)
+
+	if _, err := db.GetFix(1); !errors.Is(err, ErrFixNotFound) {
+		t.Errorf("GetFix: err = %v, want ErrFixNotFound", err)
+	}
+	if err := db.CompleteRun(1, "ok", 0, 0, 0, "", ""); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("CompleteRun: err = %v, want ErrRunNotFound", err)
+	}
+	if err := db.SoftDeleteRun(1); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("SoftDeleteRun: err = %v, want ErrRunNotFound", err)
+	}
+}
+
+func TestMigrateSQLite(t *testing.T) {
+	if err := openTestDB(t).Migrate(); err != nil {
+		t.Errorf("Migrate on sqlite = %v, want a no-op", err)
+	}
+}
+
+func TestEnsureIndexes(t *testing.T) {
+	db := openTestDB(t)
+	for pass := 1; pass <= 2; pass++ {
+		if err := db.EnsureIndexes(); err != nil {
+			t.Fatalf("pass %d: %v", pass, err)
+		}
+	}
+
+	for _, idx := range hotIndexes {
+		var table string
+		err := db.pool().QueryRow(`SELECT tbl_name FROM sqlite_master WHERE type = 'index' AND name = ?`, idx.name).Scan(&table)
+		if err != nil || table != idx.table {
+			t.Errorf("index %s: table %q, %v; want it on %s", idx.name, table, err, idx.table)
+		}
+	}
+
+	var plan string
+	rows, err := db.pool().Query(`EXPLAIN QUERY PLAN SELECT id FROM clopus_watcher_fixes WHERE run_id = 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var id, parent, notused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+			t.Fatal(err)
+		}
+		plan += detail
+	}
+	rows.Close()
+	if !strings.Contains(plan, "clopus_watcher_fixes_run_id_idx") {
+		t.Errorf("fixes by run_id plan = %q, want it to use the run_id index", plan)
+	}
+}
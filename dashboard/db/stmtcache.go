@@ -0,0 +1,70 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// stmtKey identifies a cached statement by its query and the pool it was
+// prepared on
+type stmtKey struct {
+	query   string
+	replica bool
+}
+
+// prepared returns a cached prepared statement for query, preparing it on
+// first use on the primary, or on the replica when replica is set and one
+// is configured. Only use it for queries whose text comes from a small fixed
+// set, since every distinct string stays cached until Close.
+func (db *DB) prepared(query string, replica bool) (*sql.Stmt, error) {
+	db.stmtMu.Lock()
+	defer db.stmtMu.Unlock()
+
+	conn, replicaConn := db.pool(), db.replicaPool()
+	key := stmtKey{query, replica && replicaConn != nil}
+	if stmt, ok := db.stmts[key]; ok {
+		return stmt, nil
+	}
+
+	if key.replica {
+		conn = replicaConn
+	}
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	if db.stmts == nil {
+		db.stmts = make(map[stmtKey]*sql.Stmt)
+	}
+	db.stmts[key] = stmt
+	return stmt, nil
+}
+
+// queryPrepared runs a read query on the primary through the statement cache
+func (db *DB) queryPrepared(query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := db.prepared(query, false)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Query(args...)
+}
+
+// queryPreparedList is queryPrepared for list reads, which go to the replica
+// when one is configured (see SetReplica)
+func (db *DB) queryPreparedList(query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := db.prepared(query, true)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Query(args...)
+}
+
+// closeStatements closes and forgets every cached statement
+func (db *DB) closeStatements() {
+	db.stmtMu.Lock()
+	defer db.stmtMu.Unlock()
+
+	for _, stmt := range db.stmts {
+		stmt.Close()
+	}
+	db.stmts = nil
+}
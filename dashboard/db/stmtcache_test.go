@@ -0,0 +1,108 @@
+//go:build sqlite
+
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestPreparedReplica checks that list reads are prepared on the replica
+// while other reads stay on the primary
+func TestPreparedReplica(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(DriverSQLite, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	const query = `SELECT COUNT(*) FROM clopus_watcher_runs`
+
+	primary, err := db.prepared(query, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := db.prepared(query, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list != primary {
+		t.Error("without a replica, list reads should share the primary's statement")
+	}
+
+	// A second pool on the same file stands in for the replica
+	if err := db.SetReplica(path); err != nil {
+		t.Fatal(err)
+	}
+	list, err = db.prepared(query, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list == primary {
+		t.Error("with a replica, list reads reused the primary's statement")
+	}
+	if again, _ := db.prepared(query, false); again != primary {
+		t.Error("primary reads lost their cached statement")
+	}
+}
+
+func TestPreparedReuse(t *testing.T) {
+	db := openTestDB(t)
+	addRun(t, db, "default")
+
+	for i := 0; i < 3; i++ {
+		runs, err := db.GetRuns("default", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(runs) != 1 {
+			t.Fatalf("GetRuns returned %d runs, want 1", len(runs))
+		}
+	}
+	if len(db.stmts) != 1 {
+		t.Errorf("%d cached statements after repeating one query, want 1", len(db.stmts))
+	}
+
+	first, _ := db.prepared(`SELECT 1`, false)
+	second, _ := db.prepared(`SELECT 1`, false)
+	if first != second {
+		t.Error("same query prepared twice")
+	}
+
+	db.closeStatements()
+	if db.stmts != nil {
+		t.Error("closeStatements kept statements")
+	}
+	if _, err := db.GetRuns("default", 10); err != nil {
+		t.Errorf("GetRuns after closeStatements: %v", err)
+	}
+}
+
+const benchRunsQuery = `SELECT ` + runColumns + ` FROM clopus_watcher_runs WHERE namespace = $1 ORDER BY started_at DESC LIMIT $2`
+
+func benchmarkRunsQuery(b *testing.B, prepared bool) {
+	db := openTestDB(b)
+	for i := 0; i < 20; i++ {
+		if _, err := db.CreateRun("default", ModeAutonomous); err != nil {
+			b.Fatal(err)
+		}
+	}
+	query := db.pool().Query
+	if prepared {
+		query = db.queryPrepared
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rows, err := query(benchRunsQuery, "default", 10)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := scanRuns(rows); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRunsQueryPrepared(b *testing.B)   { benchmarkRunsQuery(b, true) }
+func BenchmarkRunsQueryUnprepared(b *testing.B) { benchmarkRunsQuery(b, false) }
@@ -0,0 +1,294 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// Summary is the landing page overview across all namespaces
+type Summary struct {
+	TotalRuns     int
+	RunsByStatus  map[string]int
+	FixesByStatus map[string]int
+	RunningCount  int
+	RecentFailed  []Run
+}
+
+// GetDashboardSummary gathers run and fix totals plus the 5 most recent
+// failed runs (without logs) in three queries
+func (db *DB) GetDashboardSummary() (*Summary, error) {
+	s := &Summary{
+		RunsByStatus:  make(map[string]int),
+		FixesByStatus: make(map[string]int),
+	}
+
+	if err := db.countGrouped(`SELECT status, COUNT(*) FROM clopus_watcher_runs WHERE deleted_at IS NULL GROUP BY status`, s.RunsByStatus); err != nil {
+		return nil, err
+	}
+	for status, n := range s.RunsByStatus {
+		s.TotalRuns += n
+		if status == "running" {
+			s.RunningCount = n
+		}
+	}
+
+	if err := db.countGrouped(`SELECT status, COUNT(*) FROM clopus_watcher_fixes GROUP BY status`, s.FixesByStatus); err != nil {
+		return nil, err
+	}
+
+	err := db.retry(func() error {
+		rows, err := db.readPool().Query(`
+			SELECT ` + runMetaColumns + `
+			FROM clopus_watcher_runs
+			WHERE (status = 'failed' OR status = 'issues_found') AND deleted_at IS NULL
+			ORDER BY started_at DESC
+			LIMIT 5
+		`)
+		if err != nil {
+			return err
+		}
+		s.RecentFailed, err = scanRuns(rows)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// namespaceDashboardLimit caps the recent runs and fixes of a
+// NamespaceDashboard
+const namespaceDashboardLimit = 10
+
+// NamespaceDashboard is everything the namespace drill-down page shows
+type NamespaceDashboard struct {
+	Stats        NamespaceStats `json:"stats"`
+	LastRunAt    *time.Time     `json:"last_run_at"` // end of the last completed run
+	StatusCounts map[string]int `json:"status_counts"`
+	RecentRuns   []Run          `json:"recent_runs"` // without logs
+	RecentFixes  []Fix          `json:"recent_fixes"`
+}
+
+// GetNamespaceDashboard gathers a namespace's stats, status counts, last run
+// time and most recent runs and fixes. A namespace without runs returns
+// ErrNamespaceNotFound.
+func (db *DB) GetNamespaceDashboard(name string) (*NamespaceDashboard, error) {
+	counts, err := db.GetRunStatusCounts(name)
+	if err != nil {
+		return nil, err
+	}
+	d := &NamespaceDashboard{
+		Stats:        NamespaceStatsFromCounts(name, counts),
+		StatusCounts: counts,
+	}
+	if d.Stats.RunCount == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNamespaceNotFound, name)
+	}
+
+	if d.LastRunAt, err = db.GetLastRunAt(name); err != nil {
+		return nil, err
+	}
+	d.RecentRuns, err = db.GetRunsFiltered(RunFilter{Namespace: name, WithoutLog: true, Limit: namespaceDashboardLimit})
+	if err != nil {
+		return nil, err
+	}
+	d.RecentFixes, err = db.GetFixesFiltered(FixFilter{Namespace: name, Limit: namespaceDashboardLimit})
+	if err != nil {
+		return nil, err
+	}
+
+	if d.RecentRuns == nil {
+		d.RecentRuns = []Run{}
+	}
+	if d.RecentFixes == nil {
+		d.RecentFixes = []Fix{}
+	}
+	return d, nil
+}
+
+// countGrouped runs a (key, count) query and fills counts
+func (db *DB) countGrouped(query string, counts map[string]int, args ...interface{}) error {
+	return db.retry(func() error {
+		rows, err := db.readPool().Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var status string
+			var n int
+			if err := rows.Scan(&status, &n); err != nil {
+				return err
+			}
+			counts[status] = n
+		}
+		return rows.Err()
+	})
+}
+
+// GetModeDistribution counts runs per mode; an empty namespace means all
+func (db *DB) GetModeDistribution(namespace string) (map[string]int, error) {
+	counts := make(map[string]int)
+	query := `SELECT mode, COUNT(*) FROM clopus_watcher_runs WHERE deleted_at IS NULL`
+	var args []interface{}
+	if namespace != "" {
+		query += ` AND namespace = $1`
+		args = append(args, namespace)
+	}
+	query += ` GROUP BY mode`
+
+	if err := db.countGrouped(query, counts, args...); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// runStatuses are the statuses GetRunStatusCounts always reports, zero or not
+var runStatuses = []string{"running", "ok", "fixed", "failed", "issues_found"}
+
+// GetRunStatusCounts counts runs by status in one query, including running
+// runs; an empty namespace means all
+func (db *DB) GetRunStatusCounts(namespace string) (map[string]int, error) {
+	counts := make(map[string]int, len(runStatuses))
+	for _, status := range runStatuses {
+		counts[status] = 0
+	}
+	query := `SELECT status, COUNT(*) FROM clopus_watcher_runs WHERE deleted_at IS NULL`
+	var args []interface{}
+	if namespace != "" {
+		query += ` AND namespace = $1`
+		args = append(args, namespace)
+	}
+	query += ` GROUP BY status`
+
+	if err := db.countGrouped(query, counts, args...); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// NamespaceStatsFromCounts builds a namespace's stats from its
+// GetRunStatusCounts result
+func NamespaceStatsFromCounts(namespace string, counts map[string]int) NamespaceStats {
+	s := NamespaceStats{
+		Namespace:        namespace,
+		OkCount:          counts["ok"],
+		FixedCount:       counts["fixed"],
+		FailedCount:      counts["failed"],
+		IssuesFoundCount: counts["issues_found"],
+	}
+	for _, n := range counts {
+		s.RunCount += n
+	}
+	return s
+}
+
+// GetRunHeatmap counts runs started in the last days days by day of week
+// (0 = Sunday) and hour of day, in the database's time zone. An empty
+// namespace means all.
+func (db *DB) GetRunHeatmap(namespace string, days int) ([7][24]int, error) {
+	var grid [7][24]int
+	err := db.retry(func() error {
+		grid = [7][24]int{}
+		rows, err := db.readPool().Query(`
+			SELECT EXTRACT(DOW FROM started_at)::int, EXTRACT(HOUR FROM started_at)::int, COUNT(*)
+			FROM clopus_watcher_runs
+			WHERE started_at >= NOW() - make_interval(days => $1)
+			  AND ($2 = '' OR namespace = $2) AND deleted_at IS NULL
+			GROUP BY 1, 2
+		`, days, namespace)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var dow, hour, count int
+			if err := rows.Scan(&dow, &hour, &count); err != nil {
+				return err
+			}
+			if dow >= 0 && dow < 7 && hour >= 0 && hour < 24 {
+				grid[dow][hour] = count
+			}
+		}
+		return rows.Err()
+	})
+	return grid, err
+}
+
+// RunFixSummary counts a run's fixes by status and by error type
+type RunFixSummary struct {
+	RunID       int            `json:"run_id"`
+	Total       int            `json:"total"`
+	ByStatus    map[string]int `json:"by_status"`
+	ByErrorType map[string]int `json:"by_error_type"`
+}
+
+// GetRunFixSummary returns grouped fix counts for a run without loading
+// the fixes themselves
+func (db *DB) GetRunFixSummary(runID int) (*RunFixSummary, error) {
+	s := &RunFixSummary{
+		RunID:       runID,
+		ByStatus:    make(map[string]int),
+		ByErrorType: make(map[string]int),
+	}
+	err := db.countGrouped(`SELECT status, COUNT(*) FROM clopus_watcher_fixes WHERE run_id = $1 GROUP BY status`, s.ByStatus, runID)
+	if err != nil {
+		return nil, err
+	}
+	err = db.countGrouped(`SELECT error_type, COUNT(*) FROM clopus_watcher_fixes WHERE run_id = $1 GROUP BY error_type`, s.ByErrorType, runID)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range s.ByStatus {
+		s.Total += n
+	}
+
+	// No fixes is a valid summary, as long as the run exists
+	if s.Total == 0 {
+		var exists bool
+		err := db.pool().QueryRow(`SELECT EXISTS(SELECT 1 FROM clopus_watcher_runs WHERE id = $1 AND deleted_at IS NULL)`, runID).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("%w: %d", ErrRunNotFound, runID)
+		}
+	}
+	return s, nil
+}
+
+// StorageStats sizes the run and fix tables, to inform retention
+type StorageStats struct {
+	RunRows     int   `json:"run_rows"`
+	FixRows     int   `json:"fix_rows"`
+	LogBytes    int64 `json:"log_bytes"`    // stored (possibly compressed) size of run logs
+	ReportBytes int64 `json:"report_bytes"` // stored size of text and JSON reports
+}
+
+// GetStorageStats counts rows and sums the stored size of the log and report
+// columns. pg_column_size reports the on-disk size, after TOAST compression.
+func (db *DB) GetStorageStats() (*StorageStats, error) {
+	var s StorageStats
+	err := db.retry(func() error {
+		return db.readPool().QueryRow(`
+			SELECT
+				COUNT(*),
+				COALESCE(SUM(pg_column_size(log)), 0),
+				COALESCE(SUM(COALESCE(pg_column_size(report), 0) + COALESCE(pg_column_size(report_json), 0)), 0)
+			FROM clopus_watcher_runs
+		`).Scan(&s.RunRows, &s.LogBytes, &s.ReportBytes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = db.retry(func() error {
+		return db.readPool().QueryRow(`SELECT COUNT(*) FROM clopus_watcher_fixes`).Scan(&s.FixRows)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
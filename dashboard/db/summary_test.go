@@ -0,0 +1,208 @@
+//go:build sqlite
+
+package db
+
+import (
+	"errors"
+	"maps"
+	"testing"
+)
+
+func TestGetDashboardSummary(t *testing.T) {
+	db := openTestDB(t)
+	for _, status := range []string{"ok", "failed", "issues_found"} {
+		id := addRun(t, db, "default")
+		if err := db.CompleteRun(id, status, 1, 0, 0, "", "a long log"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	running := addRun(t, db, "other")
+	addFix(t, db, running, "other", "api", "pending")
+
+	s, err := db.GetDashboardSummary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.TotalRuns != 4 || s.RunningCount != 1 || s.RunsByStatus["failed"] != 1 {
+		t.Errorf("summary = %+v", s)
+	}
+	if s.FixesByStatus["pending"] != 1 {
+		t.Errorf("FixesByStatus = %v", s.FixesByStatus)
+	}
+	if len(s.RecentFailed) != 2 {
+		t.Errorf("RecentFailed has %d runs, want the failed and issues_found ones", len(s.RecentFailed))
+	}
+	for _, r := range s.RecentFailed {
+		if r.Log != "" {
+			t.Errorf("RecentFailed run %d loaded its log", r.ID)
+		}
+	}
+}
+
+func TestGetModeDistribution(t *testing.T) {
+	db := openTestDB(t)
+	for _, run := range []struct {
+		namespace string
+		mode      Mode
+	}{
+		{"default", ModeAutonomous}, {"default", ModeAutonomous}, {"default", ModeReport},
+		{"other", ModeWatcher}, {"other", ModeReport},
+	} {
+		if _, err := db.CreateRun(run.namespace, run.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		namespace string
+		want      map[string]int
+	}{
+		{"", map[string]int{"autonomous": 2, "report": 2, "watcher": 1}},
+		{"default", map[string]int{"autonomous": 2, "report": 1}},
+		{"missing", map[string]int{}},
+	}
+	for _, tt := range tests {
+		got, err := db.GetModeDistribution(tt.namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("GetModeDistribution(%q) = %v, want %v", tt.namespace, got, tt.want)
+			continue
+		}
+		for mode, n := range tt.want {
+			if got[mode] != n {
+				t.Errorf("GetModeDistribution(%q) = %v, want %v", tt.namespace, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestGetRunFixSummary(t *testing.T) {
+	db := openTestDB(t)
+	run := addRun(t, db, "default")
+	for _, fix := range []struct{ errorType, status string }{
+		{"OOMKilled", "success"}, {"OOMKilled", "failed"}, {"CrashLoopBackOff", "success"},
+	} {
+		if _, _, err := db.CreateFix(Fix{RunID: int(run), Namespace: "default", PodName: "api", ErrorType: fix.errorType, Status: fix.status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := db.GetRunFixSummary(int(run))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Total != 3 || s.ByStatus["success"] != 2 || s.ByStatus["failed"] != 1 ||
+		s.ByErrorType["OOMKilled"] != 2 || s.ByErrorType["CrashLoopBackOff"] != 1 {
+		t.Errorf("summary = %+v", s)
+	}
+
+	empty := addRun(t, db, "default")
+	if s, err := db.GetRunFixSummary(int(empty)); err != nil || s.Total != 0 {
+		t.Errorf("run without fixes = %+v, %v; want an empty summary", s, err)
+	}
+	if _, err := db.GetRunFixSummary(int(empty) + 1); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("missing run: err = %v, want ErrRunNotFound", err)
+	}
+}
+
+func TestGetStorageStats(t *testing.T) {
+	db := openTestDB(t)
+	stats, err := db.GetStorageStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stats != (StorageStats{}) {
+		t.Errorf("empty database stats = %+v, want zeros", stats)
+	}
+
+	id := addRun(t, db, "default")
+	if err := db.CompleteRun(id, "ok", 1, 0, 0, "all pods healthy", "scanning pods\ndone"); err != nil {
+		t.Fatal(err)
+	}
+	addRun(t, db, "default")
+	addFix(t, db, id, "default", "api", "success")
+
+	stats, err = db.GetStorageStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RunRows != 2 || stats.FixRows != 1 || stats.LogBytes == 0 || stats.ReportBytes == 0 {
+		t.Errorf("stats = %+v, want 2 runs, 1 fix and non-zero log and report bytes", stats)
+	}
+}
+
+func TestGetRunStatusCounts(t *testing.T) {
+	db := openTestDB(t)
+	addRuns(t, db, "default", "ok", 3)
+	addRuns(t, db, "default", "failed", 1)
+	addRun(t, db, "default")
+	addRuns(t, db, "prod", "fixed", 2)
+	addRuns(t, db, "prod", "skipped", 1)
+	deleted := addRun(t, db, "prod")
+	if err := db.SoftDeleteRun(int(deleted)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		namespace string
+		want      map[string]int
+	}{
+		{"default", map[string]int{"running": 1, "ok": 3, "fixed": 0, "failed": 1, "issues_found": 0}},
+		{"prod", map[string]int{"running": 0, "ok": 0, "fixed": 2, "failed": 0, "issues_found": 0, "skipped": 1}},
+		{"", map[string]int{"running": 1, "ok": 3, "fixed": 2, "failed": 1, "issues_found": 0, "skipped": 1}},
+		{"other", map[string]int{"running": 0, "ok": 0, "fixed": 0, "failed": 0, "issues_found": 0}},
+	}
+	for _, tt := range tests {
+		got, err := db.GetRunStatusCounts(tt.namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Errorf("GetRunStatusCounts(%q) = %v, want %v", tt.namespace, got, tt.want)
+		}
+	}
+}
+
+func TestGetNamespaceDashboard(t *testing.T) {
+	db := openTestDB(t)
+	addRuns(t, db, "default", "ok", 2)
+	failed := addRun(t, db, "default")
+	if err := db.CompleteRun(failed, "failed", 3, 1, 0, "", "a long log"); err != nil {
+		t.Fatal(err)
+	}
+	addFix(t, db, failed, "default", "api", "failed")
+	addRun(t, db, "default")
+	addFix(t, db, addRun(t, db, "prod"), "prod", "worker", "success")
+
+	d, err := db.GetNamespaceDashboard("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Stats.RunCount != 4 || d.Stats.OkCount != 2 || d.Stats.FailedCount != 1 {
+		t.Errorf("stats = %+v", d.Stats)
+	}
+	if d.StatusCounts["running"] != 1 || d.StatusCounts["ok"] != 2 || d.StatusCounts["failed"] != 1 {
+		t.Errorf("status counts = %v", d.StatusCounts)
+	}
+	if d.LastRunAt == nil || d.LastRunAt.IsZero() {
+		t.Error("last run time missing")
+	}
+	if len(d.RecentRuns) != 4 {
+		t.Errorf("%d recent runs, want 4", len(d.RecentRuns))
+	}
+	for _, run := range d.RecentRuns {
+		if run.Log != "" {
+			t.Errorf("recent run %d includes its log", run.ID)
+		}
+	}
+	if len(d.RecentFixes) != 1 || d.RecentFixes[0].PodName != "api" {
+		t.Errorf("recent fixes = %+v, want default's one fix", d.RecentFixes)
+	}
+
+	if _, err := db.GetNamespaceDashboard("missing"); !errors.Is(err, ErrNamespaceNotFound) {
+		t.Errorf("missing namespace: err = %v, want ErrNamespaceNotFound", err)
+	}
+}
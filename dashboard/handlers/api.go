@@ -0,0 +1,1242 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kubeden/clopus-watcher/dashboard/db"
+)
+
+// API endpoints (JSON)
+
+// APINamespaces lists namespaces with run counts; archived namespaces are
+// left out unless ?includeArchived=true
+func (h *Handler) APINamespaces(w http.ResponseWriter, r *http.Request) {
+	queryDone := h.timeQuery(w)
+	namespaces, err := h.db.ListNamespaces(r.URL.Query().Get("includeArchived") == "true")
+	queryDone()
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	writeJSONWithETag(w, r, namespaces)
+}
+
+// runFilter parses the run filters shared by the runs endpoints: ns, status,
+// from, to, min_errors, min_fixes, include_deleted and sort. Non-numeric
+// minimums are ignored.
+func runFilter(r *http.Request) (db.RunFilter, error) {
+	q := r.URL.Query()
+	from, err := queryTime(r, "from")
+	if err != nil {
+		return db.RunFilter{}, err
+	}
+	to, err := queryTime(r, "to")
+	if err != nil {
+		return db.RunFilter{}, err
+	}
+	return db.RunFilter{
+		Namespace:      q.Get("ns"),
+		Status:         q.Get("status"),
+		From:           from,
+		To:             to,
+		MinErrors:      queryInt(r, "min_errors", 0),
+		MinFixes:       queryInt(r, "min_fixes", 0),
+		IncludeDeleted: q.Get("include_deleted") == "true",
+		Sort:           sortParam(r, db.DefaultRunSort),
+	}, nil
+}
+
+// sortParam reads ?sort=, applying ?order=asc|desc when given, to the field
+// of def (such as db.DefaultRunSort) when sort is missing. Without order a
+// "-" prefix on the field sorts descending.
+func sortParam(r *http.Request, def string) string {
+	field := strings.TrimPrefix(r.URL.Query().Get("sort"), "-")
+	if field == "" {
+		field = strings.TrimPrefix(def, "-")
+	}
+	switch r.URL.Query().Get("order") {
+	case "asc":
+		return field
+	case "desc":
+		return "-" + field
+	}
+	return r.URL.Query().Get("sort")
+}
+
+func (h *Handler) APIRuns(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter, err := runFilter(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit, err := parseLimit(r, defaultLimit)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	offset, err := queryIntStrict(r, "offset", 0)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fields, err := runFields(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter.WithFixCounts = q.Get("fix_counts") == "true"
+	filter.WithoutLog = !slices.Contains(fields, "Log")
+	filter.Limit = limit
+	filter.Offset = offset
+	queryDone := h.timeQuery(w)
+	runs, err := h.db.GetRunsFiltered(filter)
+	if errors.Is(err, db.ErrInvalidSort) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	projected := projectRuns(runs, fields)
+
+	// Bare array by default for existing callers; ?envelope=true adds paging info
+	if q.Get("envelope") != "true" {
+		queryDone()
+		writeJSONWithETag(w, r, projected)
+		return
+	}
+
+	total, err := h.db.GetRunCountFiltered(filter)
+	queryDone()
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	writeJSONWithETag(w, r, envelope{Data: projected, Total: total, Limit: filter.Limit, Offset: filter.Offset})
+}
+
+// patchRun updates the run ?id= from a JSON object of column names to new
+// values, e.g. {"status": "fixed"}, and returns the updated run
+func (h *Handler) patchRun(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "id must be an integer")
+		return
+	}
+
+	var fields map[string]interface{}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	err = h.db.UpdateRun(id, fields)
+	if errors.Is(err, db.ErrInvalidRunUpdate) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, db.ErrRunNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, db.ErrRunNotRunning) {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+
+	run, err := h.db.GetRunMeta(int(id))
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Run *db.Run `json:"run"`
+	}{run})
+}
+
+// APIRunsStatusCounts counts runs by status, including running, for ?ns=
+// or all namespaces
+func (h *Handler) APIRunsStatusCounts(w http.ResponseWriter, r *http.Request) {
+	counts, err := h.db.GetRunStatusCounts(r.URL.Query().Get("ns"))
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
+
+// runQuery is the JSON body of POST /api/runs/query
+type runQuery struct {
+	Namespaces []string  `json:"namespaces"`
+	Statuses   []string  `json:"statuses"`
+	Modes      []string  `json:"modes"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	MinErrors  int       `json:"minErrors"`
+	Sort       string    `json:"sort"`
+	Limit      int       `json:"limit"`
+	Offset     int       `json:"offset"`
+}
+
+// APIRunsQuery is APIRuns with the filters in a JSON body, for combinations
+// such as several namespaces and statuses that don't fit a query string.
+// It always returns the envelope.
+func (h *Handler) APIRunsQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var body runQuery
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if body.Limit < 0 || body.Offset < 0 || body.MinErrors < 0 {
+		writeJSONError(w, http.StatusBadRequest, "limit, offset and minErrors must not be negative")
+		return
+	}
+	for _, mode := range body.Modes {
+		if _, err := db.ParseMode(mode); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if body.Limit == 0 {
+		body.Limit = defaultLimit
+	}
+
+	filter := db.RunFilter{
+		Namespaces: body.Namespaces,
+		Statuses:   body.Statuses,
+		Modes:      body.Modes,
+		From:       body.From,
+		To:         body.To,
+		MinErrors:  body.MinErrors,
+		WithoutLog: true,
+		Sort:       body.Sort,
+		Limit:      min(body.Limit, maxLimit),
+		Offset:     body.Offset,
+	}
+	queryDone := h.timeQuery(w)
+	runs, err := h.db.GetRunsFiltered(filter)
+	if errors.Is(err, db.ErrInvalidSort) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	total, err := h.db.GetRunCountFiltered(filter)
+	queryDone()
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(envelope{Data: projectRuns(runs, defaultRunFields), Total: total, Limit: filter.Limit, Offset: filter.Offset})
+}
+
+// runFieldValues are the run fields ?fields= can select, by JSON name
+var runFieldValues = map[string]func(db.Run) interface{}{
+	"ID":             func(r db.Run) interface{} { return r.ID },
+	"StartedAt":      func(r db.Run) interface{} { return r.StartedAt },
+	"EndedAt":        func(r db.Run) interface{} { return r.EndedAt },
+	"Namespace":      func(r db.Run) interface{} { return r.Namespace },
+	"Mode":           func(r db.Run) interface{} { return r.Mode },
+	"Status":         func(r db.Run) interface{} { return r.Status },
+	"PodCount":       func(r db.Run) interface{} { return r.PodCount },
+	"ErrorCount":     func(r db.Run) interface{} { return r.ErrorCount },
+	"FixCount":       func(r db.Run) interface{} { return r.FixCount },
+	"Report":         func(r db.Run) interface{} { return r.Report },
+	"ReportJSON":     func(r db.Run) interface{} { return r.ReportJSON },
+	"Log":            func(r db.Run) interface{} { return r.Log },
+	"ParentRunID":    func(r db.Run) interface{} { return r.ParentRunID },
+	"FixCountActual": func(r db.Run) interface{} { return r.FixCountActual },
+	"StartedAtTime":  func(r db.Run) interface{} { return r.StartedAtTime },
+	"EndedAtTime":    func(r db.Run) interface{} { return r.EndedAtTime },
+}
+
+// defaultRunFields leaves out the report and log, which are large and not
+// needed for listing runs
+var defaultRunFields = []string{
+	"ID", "StartedAt", "EndedAt", "Namespace", "Mode", "Status",
+	"PodCount", "ErrorCount", "FixCount", "ParentRunID",
+}
+
+// runFields parses ?fields=, a comma list of run field names (matched
+// case-insensitively). FixCountActual is added to the default set when
+// ?fix_counts=true.
+func runFields(r *http.Request) ([]string, error) {
+	requested := queryList(r, "fields")
+	if len(requested) == 0 {
+		fields := defaultRunFields
+		if r.URL.Query().Get("fix_counts") == "true" {
+			fields = append(fields[:len(fields):len(fields)], "FixCountActual")
+		}
+		return fields, nil
+	}
+
+	fields := make([]string, 0, len(requested))
+	for _, name := range requested {
+		field := ""
+		for known := range runFieldValues {
+			if strings.EqualFold(known, name) {
+				field = known
+				break
+			}
+		}
+		if field == "" {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// projectRuns keeps only fields of each run
+func projectRuns(runs []db.Run, fields []string) []map[string]interface{} {
+	projected := make([]map[string]interface{}, len(runs))
+	for i, run := range runs {
+		m := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			m[field] = runFieldValues[field](run)
+		}
+		projected[i] = m
+	}
+	return projected
+}
+
+// envelope wraps a page of list results with paging metadata
+type envelope struct {
+	Data   interface{} `json:"data"`
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
+
+// APIRun returns a run on GET and amends some of its fields on PATCH
+func (h *Handler) APIRun(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPatch:
+		h.patchRun(w, r)
+		return
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PATCH")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "id must be an integer")
+		return
+	}
+
+	queryDone := h.timeQuery(w)
+	run, err := h.db.GetRun(id)
+	queryDone()
+	if errors.Is(err, db.ErrRunNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+
+	// Fixes are only embedded when asked for with ?include=fixes, so the
+	// default response stays one query
+	var result interface{} = struct {
+		Run *db.Run `json:"run"`
+	}{run}
+	if includes(r, "fixes") {
+		fixes, err := h.db.GetFixesByRun(id)
+		if err != nil {
+			apiServerError(w, r, err)
+			return
+		}
+		if fixes == nil {
+			fixes = []db.Fix{}
+		}
+		result = struct {
+			Run   *db.Run  `json:"run"`
+			Fixes []db.Fix `json:"fixes"`
+		}{run, fixes}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// APIRunProgress returns a run's current counts, for polling while it runs
+func (h *Handler) APIRunProgress(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "id must be an integer")
+		return
+	}
+
+	run, err := h.db.GetRunMeta(id)
+	if errors.Is(err, db.ErrRunNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+
+	progress := struct {
+		ID          int    `json:"id"`
+		Status      string `json:"status"`
+		Running     bool   `json:"running"`
+		PodsScanned int    `json:"pods_scanned"`
+		ErrorsFound int    `json:"errors_found"`
+	}{run.ID, run.Status, run.Status == "running", run.PodCount, run.ErrorCount}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress)
+}
+
+// APIRunRetry starts a new run with the namespace and mode of ?id=, linked
+// to it as its parent
+func (h *Handler) APIRunRetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "id must be an integer")
+		return
+	}
+
+	childID, err := h.db.RetryRun(id)
+	if errors.Is(err, db.ErrRunNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]int64{"id": childID, "parent_run_id": id})
+}
+
+// APIRunLineage returns the retry chain ?id= belongs to, oldest first
+func (h *Handler) APIRunLineage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "id must be an integer")
+		return
+	}
+
+	runs, err := h.db.GetRunLineage(id)
+	if errors.Is(err, db.ErrRunNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+// APIRunEvents returns the statuses run ?id= went through, oldest first
+func (h *Handler) APIRunEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "id must be an integer")
+		return
+	}
+
+	events, err := h.db.GetRunEvents(id)
+	if errors.Is(err, db.ErrRunNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	if events == nil {
+		events = []db.RunEvent{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// APIRunSummary returns run ?id='s fix counts by status and error type
+func (h *Handler) APIRunSummary(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "id must be an integer")
+		return
+	}
+
+	summary, err := h.db.GetRunFixSummary(id)
+	if errors.Is(err, db.ErrRunNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+func (h *Handler) APIRunReport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "id must be an integer")
+		return
+	}
+
+	report, err := h.db.GetRunReport(id)
+	if errors.Is(err, db.ErrRunNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func (h *Handler) APIFixesMTTF(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("ns")
+	days, err := parseDays(r, 30)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	seconds, count, err := h.db.GetMTTF(namespace, days)
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+
+	result := struct {
+		Namespace string  `json:"namespace"`
+		Days      int     `json:"days"`
+		Seconds   float64 `json:"seconds"`
+		Count     int     `json:"count"`
+	}{namespace, days, seconds, count}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (h *Handler) APIFixesSuccessRate(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("ns")
+	days, err := parseDays(r, 30)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rates, err := h.db.GetFixSuccessRate(namespace, days)
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rates)
+}
+
+// APIFixes lists fixes filtered by ?ns= and ?status=, ordered by ?sort= and
+// ?order=. ?envelope=true wraps them with paging info like APIRuns.
+func (h *Handler) APIFixes(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r, defaultLimit)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	offset, err := queryIntStrict(r, "offset", 0)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := db.FixFilter{
+		Namespace: r.URL.Query().Get("ns"),
+		Status:    r.URL.Query().Get("status"),
+		Sort:      sortParam(r, db.DefaultFixSort),
+		Limit:     limit,
+		Offset:    offset,
+	}
+	queryDone := h.timeQuery(w)
+	fixes, err := h.db.GetFixesFiltered(filter)
+	if errors.Is(err, db.ErrInvalidSort) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+
+	if r.URL.Query().Get("envelope") != "true" {
+		queryDone()
+		writeJSONWithETag(w, r, fixes)
+		return
+	}
+
+	total, err := h.db.GetFixCount(filter)
+	queryDone()
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	writeJSONWithETag(w, r, envelope{Data: fixes, Total: total, Limit: filter.Limit, Offset: filter.Offset})
+}
+
+// maxFixStatusBatch caps the ids of one POST /api/fixes/status
+const maxFixStatusBatch = 500
+
+// APIFixesStatus sets the status of several fixes from a JSON body
+// {"ids": [...], "status": "..."}
+func (h *Handler) APIFixesStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var body struct {
+		IDs    []int  `json:"ids"`
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if len(body.IDs) > maxFixStatusBatch {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("at most %d ids per request", maxFixStatusBatch))
+		return
+	}
+
+	updated, err := h.db.UpdateFixStatusBatch(body.IDs, body.Status)
+	if errors.Is(err, db.ErrInvalidFixStatus) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": body.Status, "updated": updated})
+}
+
+// APIFixesClusters groups fix error messages into recurring patterns
+func (h *Handler) APIFixesClusters(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r, 20)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	clusters, err := h.db.GetErrorMessageClusters(r.URL.Query().Get("ns"), limit)
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clusters)
+}
+
+// APIFixesByPod lists fixes for ?pod=, matching name prefixes with
+// ?match=prefix
+func (h *Handler) APIFixesByPod(w http.ResponseWriter, r *http.Request) {
+	pod := r.URL.Query().Get("pod")
+	if pod == "" {
+		writeJSONError(w, http.StatusBadRequest, "pod is required")
+		return
+	}
+	match := r.URL.Query().Get("match")
+	if match != "" && match != "exact" && match != "prefix" {
+		writeJSONError(w, http.StatusBadRequest, "match must be exact or prefix")
+		return
+	}
+	limit, err := parseLimit(r, defaultLimit)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fixes, err := h.db.GetFixesByPod(pod, match == "prefix", limit)
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fixes)
+}
+
+// maxRecentMinutes bounds the /api/fixes/recent window to a week
+const maxRecentMinutes = 7 * 24 * 60
+
+// APIFixesRecent returns fixes from the last ?minutes= (default 60) across
+// all namespaces, newest first, for the activity feed
+func (h *Handler) APIFixesRecent(w http.ResponseWriter, r *http.Request) {
+	minutes, err := queryIntStrict(r, "minutes", 60)
+	if err != nil || minutes == 0 || minutes > maxRecentMinutes {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("minutes must be between 1 and %d", maxRecentMinutes))
+		return
+	}
+	limit, err := parseLimit(r, defaultLimit)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fixes, err := h.db.GetRecentFixes(time.Duration(minutes)*time.Minute, limit)
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	if fixes == nil {
+		fixes = []db.Fix{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fixes)
+}
+
+func (h *Handler) APIFixesTopPods(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("ns")
+	limit, err := parseLimit(r, 10)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pods, err := h.db.GetTopPods(namespace, limit)
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pods)
+}
+
+func (h *Handler) APINamespacesCompare(w http.ResponseWriter, r *http.Request) {
+	names := queryList(r, "names")
+	if len(names) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "Missing names")
+		return
+	}
+	days, err := parseDays(r, 14)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	stats, err := h.db.GetNamespaceStatsBatch(names)
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	trends, err := h.db.GetNamespaceRunTrends(names, days)
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+
+	type comparison struct {
+		Stats db.NamespaceStats `json:"stats"`
+		Trend []int             `json:"trend"`
+	}
+	result := make([]comparison, 0, len(stats))
+	for _, s := range stats {
+		result = append(result, comparison{s, trends[s.Namespace]})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// APINamespacesSparklines returns daily run counts for the last ?days= days
+// (default 14, oldest first) per namespace
+func (h *Handler) APINamespacesSparklines(w http.ResponseWriter, r *http.Request) {
+	days, err := parseDays(r, 14)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sparklines, err := h.db.GetNamespaceSparklines(days)
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	writeJSONWithETag(w, r, sparklines)
+}
+
+// APIStats returns the fix totals, all-time or for the last ?window= (a Go
+// duration, or whole days such as 7d)
+func (h *Handler) APIStats(w http.ResponseWriter, r *http.Request) {
+	window, err := parseWindow(r.URL.Query().Get("window"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	queryDone := h.timeQuery(w)
+	var stats *db.Stats
+	if window > 0 {
+		stats, err = h.db.GetStatsWindow(window)
+	} else {
+		stats, err = h.db.GetStatsStruct()
+	}
+	queryDone()
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func (h *Handler) APINamespacesSearch(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r, 10)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	names, err := h.db.SearchNamespaces(r.URL.Query().Get("q"), limit)
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(names)
+}
+
+// APINamespaceLastRun reports when ?name= last completed a run and whether
+// that is older than the stale threshold. Namespaces that never ran have a
+// null last_run and are stale.
+func (h *Handler) APINamespaceLastRun(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeJSONError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	lastRun, err := h.db.GetLastRunAt(name)
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+
+	result := struct {
+		Namespace string     `json:"namespace"`
+		LastRun   *time.Time `json:"last_run"`
+		IsStale   bool       `json:"is_stale"`
+	}{name, lastRun, lastRun == nil || time.Since(*lastRun) > h.staleThreshold}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// APINamespaceSLO returns the error budget of ?name= over the last ?days=
+// (default 30)
+func (h *Handler) APINamespaceSLO(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeJSONError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	days, err := parseDays(r, 30)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	budget, err := h.db.GetErrorBudget(name, days)
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(budget)
+}
+
+// APINamespace returns the dashboard of namespace ?name= on GET and deletes
+// its runs on DELETE
+func (h *Handler) APINamespace(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodDelete:
+		h.APIDeleteNamespace(w, r)
+		return
+	default:
+		w.Header().Set("Allow", "GET, HEAD, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeJSONError(w, http.StatusBadRequest, "Missing name")
+		return
+	}
+
+	queryDone := h.timeQuery(w)
+	dashboard, err := h.db.GetNamespaceDashboard(name)
+	queryDone()
+	if errors.Is(err, db.ErrNamespaceNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	writeJSONWithETag(w, r, dashboard)
+}
+
+// APIDeleteNamespace purges a namespace's run history (DELETE only)
+func (h *Handler) APIDeleteNamespace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeJSONError(w, http.StatusBadRequest, "Missing name")
+		return
+	}
+
+	deleted, err := h.db.DeleteRunsByNamespace(name)
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"namespace": name, "deleted": deleted})
+}
+
+// APIArchiveNamespace archives namespace ?name= (POST) or unarchives it
+// (DELETE)
+func (h *Handler) APIArchiveNamespace(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeJSONError(w, http.StatusBadRequest, "Missing name")
+		return
+	}
+
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		err = h.db.ArchiveNamespace(name)
+	case http.MethodDelete:
+		err = h.db.UnarchiveNamespace(name)
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"namespace": name, "archived": r.Method == http.MethodPost})
+}
+
+// APIStorage reports table row counts and log/report storage size
+func (h *Handler) APIStorage(w http.ResponseWriter, r *http.Request) {
+	queryDone := h.timeQuery(w)
+	stats, err := h.db.GetStorageStats()
+	queryDone()
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// APIMaintenance reports maintenance mode on GET and sets it on POST from a
+// JSON body {"enabled": bool}
+func (h *Handler) APIMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var body struct {
+			Enabled *bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil || body.Enabled == nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		h.maintenance.Store(*body.Enabled)
+		slog.Info("maintenance mode changed", "enabled", *body.Enabled)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"enabled": h.maintenance.Load()})
+}
+
+// poolStats is the JSON form of sql.DBStats served by APIDBStats
+type poolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMs     int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+func newPoolStats(s sql.DBStats) poolStats {
+	return poolStats{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDurationMs:     s.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+	}
+}
+
+// APIDBStats reports connection pool statistics, for diagnosing pool
+// exhaustion. The replica pool is included when one is configured.
+func (h *Handler) APIDBStats(w http.ResponseWriter, r *http.Request) {
+	result := struct {
+		Primary poolStats  `json:"primary"`
+		Replica *poolStats `json:"replica,omitempty"`
+	}{Primary: newPoolStats(h.db.Stats())}
+	if s, ok := h.db.ReplicaStats(); ok {
+		replica := newPoolStats(s)
+		result.Replica = &replica
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (h *Handler) APIRunsByMode(w http.ResponseWriter, r *http.Request) {
+	counts, err := h.db.GetModeDistribution(r.URL.Query().Get("ns"))
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
+
+// APIRunsHeatmap returns a 7x24 grid of run counts by day of week (0 =
+// Sunday) and hour
+func (h *Handler) APIRunsHeatmap(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("ns")
+	days, err := parseDays(r, 30)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	grid, err := h.db.GetRunHeatmap(namespace, days)
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(grid)
+}
+
+func (h *Handler) APISummary(w http.ResponseWriter, r *http.Request) {
+	queryDone := h.timeQuery(w)
+	summary, err := h.db.GetDashboardSummary()
+	queryDone()
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// writeJSONWithETag serializes v and tags it with a hash of the body so
+// pollers sending a matching If-None-Match get a 304 instead of the payload
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+
+	etag := bodyETag(body)
+	w.Header().Set("ETag", etag)
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(body, '\n'))
+}
+
+// bodyETag is the strong ETag for a response body
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// List endpoint limits: the default page size and the most a caller may ask for
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// parseWindow parses a time window such as 7d, 12h or 90m; "" is zero,
+// meaning no window
+func parseWindow(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	var window time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window %q", s)
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if window, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid window %q", s)
+		}
+	}
+	if window <= 0 {
+		return 0, fmt.Errorf("window must be positive")
+	}
+	return window, nil
+}
+
+// maxDays caps ?days= on the endpoints reporting over a window of days
+const maxDays = 90
+
+// parseDays reads ?days=, defaulting to def when missing. Values outside
+// 1..maxDays are an error, as each day costs query time and memory.
+func parseDays(r *http.Request, def int) (int, error) {
+	days, err := queryIntStrict(r, "days", def)
+	if err != nil || days < 1 || days > maxDays {
+		return 0, fmt.Errorf("days must be between 1 and %d", maxDays)
+	}
+	return days, nil
+}
+
+// parseLimit reads ?limit=, defaulting to def when missing or zero and
+// clamping to maxLimit. Negative or non-numeric values are an error.
+func parseLimit(r *http.Request, def int) (int, error) {
+	limit, err := queryIntStrict(r, "limit", def)
+	if err != nil {
+		return 0, err
+	}
+	if limit == 0 {
+		return def, nil
+	}
+	if limit > maxLimit {
+		return maxLimit, nil
+	}
+	return limit, nil
+}
+
+// timeQuery starts timing database work for the X-Query-Duration header,
+// sent only in debug mode. Call the returned func once the queries are done,
+// before writing the response.
+func (h *Handler) timeQuery(w http.ResponseWriter) func() {
+	if !h.debug {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		w.Header().Set("X-Query-Duration", time.Since(start).String())
+	}
+}
+
+// writeJSONError sends the API's error shape: {"error": "..."}
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// apiServerError logs err with the request id and sends a generic 500, so
+// internal details stay in the logs rather than the response
+func apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	logRequestError(r, err)
+	writeJSONError(w, http.StatusInternalServerError, "internal server error")
+}
@@ -0,0 +1,486 @@
+//go:build sqlite
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubeden/clopus-watcher/dashboard/db"
+)
+
+// newTestHandler returns a Handler backed by a fresh sqlite database
+func newTestHandler(t *testing.T) (*Handler, *db.DB) {
+	t.Helper()
+	database, err := db.Open(db.DriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return New(database, nil, ""), database
+}
+
+func TestAPIRunIncludeFixes(t *testing.T) {
+	h, database := newTestHandler(t)
+	id, err := database.CreateRun("default", db.ModeAutonomous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := database.CreateFix(db.Fix{RunID: int(id), Namespace: "default", PodName: "web-1", ErrorType: "CrashLoopBackOff"}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(query string) map[string]json.RawMessage {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.APIRun(w, httptest.NewRequest(http.MethodGet, "/api/run?id="+strconv.FormatInt(id, 10)+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: code = %d, body %s", query, w.Code, w.Body)
+		}
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+
+	if body := get(""); body["fixes"] != nil || body["run"] == nil {
+		t.Errorf("default response has keys %v, want only run", keys(body))
+	}
+	var fixes []db.Fix
+	if err := json.Unmarshal(get("&include=fixes")["fixes"], &fixes); err != nil || len(fixes) != 1 {
+		t.Errorf("include=fixes response fixes = %v (%v), want the run's one fix", fixes, err)
+	}
+}
+
+func keys(m map[string]json.RawMessage) []string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
+
+// getJSON calls handler with a GET of target and decodes the 200 response
+func getJSON(t *testing.T, handler http.HandlerFunc, target string, v interface{}) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, target, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: code = %d, body %s", target, w.Code, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("GET %s: %v", target, err)
+	}
+}
+
+func TestAPIRunsEnvelope(t *testing.T) {
+	h, database := newTestHandler(t)
+	for i := 0; i < 5; i++ {
+		if _, err := database.CreateRun("default", db.ModeAutonomous); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var bare []map[string]interface{}
+	getJSON(t, h.APIRuns, "/api/runs?limit=2", &bare)
+	if len(bare) != 2 {
+		t.Errorf("bare response has %d runs, want 2", len(bare))
+	}
+
+	var env struct {
+		Data   []map[string]interface{} `json:"data"`
+		Total  int                      `json:"total"`
+		Limit  int                      `json:"limit"`
+		Offset int                      `json:"offset"`
+	}
+	getJSON(t, h.APIRuns, "/api/runs?envelope=true&limit=2&offset=4", &env)
+	if len(env.Data) != 1 || env.Total != 5 || env.Limit != 2 || env.Offset != 4 {
+		t.Errorf("envelope = %d runs, total %d, limit %d, offset %d; want 1, 5, 2, 4", len(env.Data), env.Total, env.Limit, env.Offset)
+	}
+}
+
+func TestAPIRunsFields(t *testing.T) {
+	h, database := newTestHandler(t)
+	id, err := database.CreateRun("default", db.ModeAutonomous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CompleteRun(id, "ok", 1, 0, 0, "report", "log"); err != nil {
+		t.Fatal(err)
+	}
+
+	var runs []map[string]interface{}
+	getJSON(t, h.APIRuns, "/api/runs", &runs)
+	if len(runs) != 1 || len(runs[0]) != len(defaultRunFields) || runs[0]["Status"] != "ok" {
+		t.Fatalf("default runs = %v", runs)
+	}
+	if _, ok := runs[0]["Log"]; ok {
+		t.Error("default projection includes Log")
+	}
+
+	runs = nil
+	getJSON(t, h.APIRuns, "/api/runs?fields=id,log", &runs)
+	if len(runs) != 1 || len(runs[0]) != 2 || runs[0]["Log"] != "log" {
+		t.Errorf("runs with fields=id,log = %v", runs)
+	}
+
+	w := httptest.NewRecorder()
+	h.APIRuns(w, httptest.NewRequest(http.MethodGet, "/api/runs?fields=secret", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown field: code = %d, want 400", w.Code)
+	}
+}
+
+func TestAPIRunsQuery(t *testing.T) {
+	h, database := newTestHandler(t)
+	for _, r := range []struct {
+		namespace string
+		mode      db.Mode
+		status    string
+		errors    int
+	}{
+		{"default", db.ModeAutonomous, "ok", 0},
+		{"default", db.ModeReport, "failed", 3},
+		{"prod", db.ModeAutonomous, "issues_found", 5},
+		{"prod", db.ModeReport, "running", 0},
+	} {
+		id, err := database.CreateRun(r.namespace, r.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.status != "running" {
+			if err := database.CompleteRun(id, r.status, 10, r.errors, 0, "", ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		body  string
+		total int
+		ids   string
+	}{
+		{`{}`, 4, "4,3,2,1"},
+		{`{"namespaces": ["prod"]}`, 2, "4,3"},
+		{`{"namespaces": ["default", "prod"], "statuses": ["ok", "issues_found"]}`, 2, "3,1"},
+		{`{"modes": ["report"], "sort": "id"}`, 2, "2,4"},
+		{`{"minErrors": 1, "sort": "-error_count"}`, 2, "3,2"},
+		{`{"namespaces": ["default"], "minErrors": 1}`, 1, "2"},
+		{`{"from": "2000-01-01T00:00:00Z", "to": "2001-01-01T00:00:00Z"}`, 0, ""},
+		{`{"limit": 1, "offset": 1}`, 4, "3"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.APIRunsQuery(w, httptest.NewRequest(http.MethodPost, "/api/runs/query", strings.NewReader(tt.body)))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: code = %d, body %s", tt.body, w.Code, w.Body)
+			continue
+		}
+		var env struct {
+			Data  []struct{ ID int } `json:"data"`
+			Total int                `json:"total"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, run := range env.Data {
+			ids = append(ids, strconv.Itoa(run.ID))
+		}
+		if env.Total != tt.total || strings.Join(ids, ",") != tt.ids {
+			t.Errorf("%s: total %d, runs %v; want %d, %s", tt.body, env.Total, ids, tt.total, tt.ids)
+		}
+	}
+}
+
+func TestAPIStats(t *testing.T) {
+	h, database := newTestHandler(t)
+	id, err := database.CreateRun("default", db.ModeAutonomous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []string{"success", "success", "failed", "analyzing"} {
+		if _, _, err := database.CreateFix(db.Fix{RunID: int(id), Namespace: "default", PodName: "api", ErrorType: "OOMKilled", Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stats db.Stats
+	getJSON(t, h.APIStats, "/api/stats", &stats)
+	if stats != (db.Stats{Total: 4, Success: 2, Failed: 1, Pending: 1}) {
+		t.Errorf("stats = %+v", stats)
+	}
+	var windowed db.Stats
+	getJSON(t, h.APIStats, "/api/stats?window=7d", &windowed)
+	if windowed != stats {
+		t.Errorf("stats for 7d = %+v, want all %+v", windowed, stats)
+	}
+
+	w := httptest.NewRecorder()
+	h.APIStats(w, httptest.NewRequest(http.MethodGet, "/api/stats?window=week", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid window: code = %d, want 400", w.Code)
+	}
+}
+
+func TestAPIStorage(t *testing.T) {
+	h, database := newTestHandler(t)
+	id, err := database.CreateRun("default", db.ModeAutonomous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CompleteRun(id, "ok", 1, 0, 0, "report", "log"); err != nil {
+		t.Fatal(err)
+	}
+
+	var stats db.StorageStats
+	getJSON(t, h.APIStorage, "/api/storage", &stats)
+	if stats.RunRows != 1 || stats.LogBytes != 3 || stats.ReportBytes != 6 {
+		t.Errorf("storage = %+v, want 1 run with 3 log and 6 report bytes", stats)
+	}
+}
+
+func TestAPIDBStats(t *testing.T) {
+	h, _ := newTestHandler(t)
+	var stats map[string]map[string]interface{}
+	getJSON(t, h.APIDBStats, "/api/db/stats", &stats)
+	if _, ok := stats["replica"]; ok {
+		t.Error("replica stats reported without a replica")
+	}
+	for _, field := range []string{"max_open_connections", "open_connections", "in_use", "idle", "wait_count", "wait_duration_ms", "max_idle_closed", "max_lifetime_closed"} {
+		if _, ok := stats["primary"][field].(float64); !ok {
+			t.Errorf("primary.%s missing from %v", field, stats["primary"])
+		}
+	}
+}
+
+func TestAPIRunPatch(t *testing.T) {
+	h, database := newTestHandler(t)
+	id, err := database.CreateRun("default", db.ModeAutonomous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.UpdateRunProgress(id, 5, 2); err != nil {
+		t.Fatal(err)
+	}
+	target := "/api/run?id=" + strconv.FormatInt(id, 10)
+
+	tests := []struct {
+		target, body string
+		code         int
+	}{
+		{target, `{"status": "fixed", "fix_count": 1}`, http.StatusOK},
+		{target, `{"status": "ok"}`, http.StatusConflict},
+		{target, `{"status": "running"}`, http.StatusBadRequest},
+		{target, `{"status": "done"}`, http.StatusBadRequest},
+		{target, `{"started_at": "2024-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{target, `{"pod_count": 1.5}`, http.StatusBadRequest},
+		{target, `["status"]`, http.StatusBadRequest},
+		{"/api/run?id=x", `{"status": "ok"}`, http.StatusBadRequest},
+		{"/api/run?id=99", `{"status": "ok"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.APIRun(w, httptest.NewRequest(http.MethodPatch, tt.target, strings.NewReader(tt.body)))
+		if w.Code != tt.code {
+			t.Errorf("PATCH %s %s: code = %d, want %d (%s)", tt.target, tt.body, w.Code, tt.code, w.Body)
+		}
+	}
+
+	run, err := database.GetRun(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != "fixed" || run.FixCount != 1 || run.PodCount != 5 {
+		t.Errorf("run = %+v, want status and fix count patched only", run)
+	}
+}
+
+func TestAPIRunsStatusCounts(t *testing.T) {
+	h, database := newTestHandler(t)
+	for _, ns := range []string{"default", "default", "prod"} {
+		if _, err := database.CreateRun(ns, db.ModeAutonomous); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var counts map[string]int
+	getJSON(t, h.APIRunsStatusCounts, "/api/runs/status-counts?ns=default", &counts)
+	if counts["running"] != 2 || counts["ok"] != 0 || len(counts) != 5 {
+		t.Errorf("counts for default = %v, want 2 running and every status listed", counts)
+	}
+	getJSON(t, h.APIRunsStatusCounts, "/api/runs/status-counts", &counts)
+	if counts["running"] != 3 {
+		t.Errorf("counts = %v, want 3 running", counts)
+	}
+}
+
+func TestAPINamespaceDashboard(t *testing.T) {
+	h, database := newTestHandler(t)
+	id, err := database.CreateRun("default", db.ModeAutonomous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := database.CreateFix(db.Fix{RunID: int(id), Namespace: "default", PodName: "api", ErrorType: "OOMKilled", Status: "success"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CompleteRun(id, "fixed", 3, 1, 1, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var dashboard map[string]json.RawMessage
+	getJSON(t, h.APINamespace, "/api/namespace?name=default", &dashboard)
+	for _, section := range []string{"stats", "last_run_at", "status_counts", "recent_runs", "recent_fixes"} {
+		if v, ok := dashboard[section]; !ok || string(v) == "null" || string(v) == "[]" {
+			t.Errorf("section %s = %s, want it populated", section, v)
+		}
+	}
+
+	for query, code := range map[string]int{"": http.StatusBadRequest, "?name=missing": http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		h.APINamespace(w, httptest.NewRequest(http.MethodGet, "/api/namespace"+query, nil))
+		if w.Code != code {
+			t.Errorf("%q: code = %d, want %d", query, w.Code, code)
+		}
+	}
+}
+
+func TestAPIRunNotFound(t *testing.T) {
+	h, _ := newTestHandler(t)
+	w := httptest.NewRecorder()
+	h.APIRun(w, httptest.NewRequest(http.MethodGet, "/api/run?id=99", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("code = %d, want 404", w.Code)
+	}
+}
+
+func TestAPIRunEventsNotFound(t *testing.T) {
+	h, _ := newTestHandler(t)
+	w := httptest.NewRecorder()
+	h.APIRunEvents(w, httptest.NewRequest(http.MethodGet, "/api/run/events?id=99", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("code = %d, want 404", w.Code)
+	}
+}
+
+func TestAPINamespaceLastRun(t *testing.T) {
+	h, database := newTestHandler(t)
+	id, err := database.CreateRun("default", db.ModeAutonomous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CompleteRun(id, "ok", 0, 0, 0, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CreateRun("new", db.ModeAutonomous); err != nil {
+		t.Fatal(err)
+	}
+
+	type freshness struct {
+		LastRun *time.Time `json:"last_run"`
+		IsStale bool       `json:"is_stale"`
+	}
+	var got freshness
+	getJSON(t, h.APINamespaceLastRun, "/api/namespace/last-run?name=default", &got)
+	if got.LastRun == nil || got.IsStale {
+		t.Errorf("default = %+v, want a fresh last run", got)
+	}
+
+	h.SetStaleThreshold(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	getJSON(t, h.APINamespaceLastRun, "/api/namespace/last-run?name=default", &got)
+	if !got.IsStale {
+		t.Errorf("default past the threshold = %+v, want stale", got)
+	}
+
+	got = freshness{}
+	getJSON(t, h.APINamespaceLastRun, "/api/namespace/last-run?name=new", &got)
+	if got.LastRun != nil || !got.IsStale {
+		t.Errorf("namespace still running its first run = %+v, want stale with no last run", got)
+	}
+}
+
+func TestAPIFixes(t *testing.T) {
+	h, database := newTestHandler(t)
+	id, err := database.CreateRun("default", db.ModeAutonomous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pod := range []string{"b", "a", "c"} {
+		if _, _, err := database.CreateFix(db.Fix{RunID: int(id), Namespace: "default", PodName: pod, ErrorType: "OOMKilled", Status: "success"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var fixes []db.Fix
+	getJSON(t, h.APIFixes, "/api/fixes?ns=default&sort=pod_name&limit=2", &fixes)
+	if len(fixes) != 2 || fixes[0].PodName != "a" || fixes[1].PodName != "b" {
+		t.Errorf("fixes = %+v, want pods a and b", fixes)
+	}
+
+	w := httptest.NewRecorder()
+	h.APIFixes(w, httptest.NewRequest(http.MethodGet, "/api/fixes?sort=error_message", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown sort: code = %d, want 400", w.Code)
+	}
+}
+
+func TestAPIRunProgress(t *testing.T) {
+	h, database := newTestHandler(t)
+	id, err := database.CreateRun("default", db.ModeAutonomous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.UpdateRunProgress(id, 12, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	type progress struct {
+		Status      string `json:"status"`
+		Running     bool   `json:"running"`
+		PodsScanned int    `json:"pods_scanned"`
+		ErrorsFound int    `json:"errors_found"`
+	}
+	target := "/api/run/progress?id=" + strconv.FormatInt(id, 10)
+	var got progress
+	getJSON(t, h.APIRunProgress, target, &got)
+	if got != (progress{"running", true, 12, 3}) {
+		t.Errorf("progress = %+v", got)
+	}
+
+	if err := database.CompleteRun(id, "ok", 20, 0, 0, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.UpdateRunProgress(id, 1, 1); !errors.Is(err, db.ErrRunNotRunning) {
+		t.Errorf("progress after completion: err = %v, want ErrRunNotRunning", err)
+	}
+	getJSON(t, h.APIRunProgress, target, &got)
+	if got != (progress{"ok", false, 20, 0}) {
+		t.Errorf("progress after completion = %+v", got)
+	}
+}
+
+func TestQueryDurationHeader(t *testing.T) {
+	h, _ := newTestHandler(t)
+	for _, debug := range []bool{false, true} {
+		h.SetDebug(debug)
+		w := httptest.NewRecorder()
+		h.APIRuns(w, httptest.NewRequest(http.MethodGet, "/api/runs", nil))
+		header := w.Header().Get("X-Query-Duration")
+		if debug {
+			if _, err := time.ParseDuration(header); err != nil {
+				t.Errorf("debug: X-Query-Duration = %q, want a duration", header)
+			}
+		} else if header != "" {
+			t.Errorf("X-Query-Duration = %q without debug, want none", header)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kubeden/clopus-watcher/dashboard/db"
+)
+
+func TestParseDays(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{"", 30, false},
+		{"days=1", 1, false},
+		{"days=90", 90, false},
+		{"days=0", 0, true},
+		{"days=91", 0, true},
+		{"days=-5", 0, true},
+		{"days=1e9", 0, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/fixes/mttf?"+tt.query, nil)
+		got, err := parseDays(r, 30)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseDays(%q) = %d, %v; want %d, error %v", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestDaysOutOfRange checks the ?days= cap is enforced before any query
+func TestDaysOutOfRange(t *testing.T) {
+	h := &Handler{}
+	endpoints := map[string]http.HandlerFunc{
+		"/api/fixes/mttf":         h.APIFixesMTTF,
+		"/api/fixes/success-rate": h.APIFixesSuccessRate,
+		"/api/namespaces/compare": h.APINamespacesCompare,
+		"/api/runs/heatmap":       h.APIRunsHeatmap,
+	}
+	for path, handler := range endpoints {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, path+"?names=default&days=100000", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: code = %d, want 400", path, w.Code)
+		}
+	}
+}
+
+func TestAPINamespacesCompareMissingNames(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&Handler{}).APINamespacesCompare(w, httptest.NewRequest(http.MethodGet, "/api/namespaces/compare", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("code = %d, want 400", w.Code)
+	}
+}
+
+func TestSortParam(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", ""},
+		{"sort=namespace", "namespace"},
+		{"sort=-namespace", "-namespace"},
+		{"sort=namespace&order=desc", "-namespace"},
+		{"sort=-namespace&order=asc", "namespace"},
+		{"order=desc", "-started_at"},
+		{"order=asc", "started_at"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/runs?"+tt.query, nil)
+		if got := sortParam(r, db.DefaultRunSort); got != tt.want {
+			t.Errorf("sortParam(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestWriteJSONWithETag(t *testing.T) {
+	v := map[string]int{"runs": 3}
+
+	w := httptest.NewRecorder()
+	writeJSONWithETag(w, httptest.NewRequest(http.MethodGet, "/api/runs", nil), v)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Body.String() != `{"runs":3}`+"\n" {
+		t.Fatalf("first response: code %d, etag %q, body %q", w.Code, etag, w.Body)
+	}
+
+	for _, inm := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		r := httptest.NewRequest(http.MethodGet, "/api/runs", nil)
+		r.Header.Set("If-None-Match", inm)
+		w := httptest.NewRecorder()
+		writeJSONWithETag(w, r, v)
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: code %d with %d bytes, want an empty 304", inm, w.Code, w.Body.Len())
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/runs", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	writeJSONWithETag(w, r, map[string]int{"runs": 4})
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("changed body: code %d, etag %q, want 200 with a new etag", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{"", 50, false},
+		{"limit=0", 50, false},
+		{"limit=10", 10, false},
+		{"limit=500", 500, false},
+		{"limit=501", 500, false},
+		{"limit=-1", 0, true},
+		{"limit=ten", 0, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/runs?"+tt.query, nil)
+		got, err := parseLimit(r, 50)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseLimit(%q) = %d, %v; want %d, error %v", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestInvalidLimit(t *testing.T) {
+	h := &Handler{}
+	for path, handler := range map[string]http.HandlerFunc{
+		"/api/runs":  h.APIRuns,
+		"/api/fixes": h.APIFixes,
+	} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, path+"?limit=-1", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: code = %d, want 400", path, w.Code)
+		}
+	}
+}
+
+func TestAPIFixesByPodValidation(t *testing.T) {
+	for _, query := range []string{"", "?match=prefix", "?pod=api&match=regex"} {
+		w := httptest.NewRecorder()
+		(&Handler{}).APIFixesByPod(w, httptest.NewRequest(http.MethodGet, "/api/fixes/by-pod"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: code = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestRunFields(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{"", strings.Join(defaultRunFields, ","), false},
+		{"fix_counts=true", strings.Join(defaultRunFields, ",") + ",FixCountActual", false},
+		{"fields=id,log", "ID,Log", false},
+		{"fields=namespace,STATUS&fix_counts=true", "Namespace,Status", false},
+		{"fields=id,password", "", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/runs?"+tt.query, nil)
+		got, err := runFields(r)
+		if (err != nil) != tt.wantErr || strings.Join(got, ",") != tt.want {
+			t.Errorf("runFields(%q) = %v, %v; want %s, error %v", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if len(defaultRunFields) != 10 {
+		t.Errorf("defaultRunFields modified by the fix_counts default: %v", defaultRunFields)
+	}
+}
+
+func TestProjectRuns(t *testing.T) {
+	runs := []db.Run{{ID: 1, Namespace: "default", Log: "a long log"}, {ID: 2, Namespace: "prod"}}
+	got := projectRuns(runs, []string{"ID", "Namespace"})
+	if len(got) != 2 || len(got[0]) != 2 || got[0]["ID"] != 1 || got[1]["Namespace"] != "prod" {
+		t.Errorf("projectRuns = %v", got)
+	}
+	if _, ok := got[0]["Log"]; ok {
+		t.Error("projected run includes Log")
+	}
+}
+
+func TestAPIFixesStatusValidation(t *testing.T) {
+	tooMany := `{"ids": [` + strings.Repeat("1,", maxFixStatusBatch) + `1], "status": "success"}`
+	for name, body := range map[string]string{
+		"invalid JSON":   `{"ids": [1, 2]`,
+		"unknown status": `{"ids": [1, 2], "status": "done"}`,
+		"too many ids":   tooMany,
+	} {
+		w := httptest.NewRecorder()
+		(&Handler{}).APIFixesStatus(w, httptest.NewRequest(http.MethodPost, "/api/fixes/status", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: code = %d, want 400", name, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	(&Handler{}).APIFixesStatus(w, httptest.NewRequest(http.MethodPost, "/api/fixes/status", strings.NewReader(`{"ids": [], "status": "success"}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"updated":0`) {
+		t.Errorf("empty ids: code = %d, body %s; want 200 with nothing updated", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	(&Handler{}).APIFixesStatus(w, httptest.NewRequest(http.MethodGet, "/api/fixes/status", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: code = %d, want 405", w.Code)
+	}
+}
+
+func TestAPIFixesRecentValidation(t *testing.T) {
+	for _, query := range []string{"?minutes=0", "?minutes=-5", "?minutes=ten", "?minutes=100000", "?limit=-1"} {
+		w := httptest.NewRecorder()
+		(&Handler{}).APIFixesRecent(w, httptest.NewRequest(http.MethodGet, "/api/fixes/recent"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: code = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestNewPoolStats(t *testing.T) {
+	got := newPoolStats(sql.DBStats{OpenConnections: 5, InUse: 3, Idle: 2, WaitCount: 7, WaitDuration: 1500 * time.Millisecond})
+	if got != (poolStats{OpenConnections: 5, InUse: 3, Idle: 2, WaitCount: 7, WaitDurationMs: 1500}) {
+		t.Errorf("newPoolStats = %+v", got)
+	}
+}
+
+func TestAPIRunsQueryValidation(t *testing.T) {
+	for _, body := range []string{
+		`{"namespaces": "default"}`,
+		`{"limit": -1}`,
+		`{"offset": -1}`,
+		`{"minErrors": -1}`,
+		`{"modes": ["scan"]}`,
+		`{"from": "yesterday"}`,
+	} {
+		w := httptest.NewRecorder()
+		(&Handler{}).APIRunsQuery(w, httptest.NewRequest(http.MethodPost, "/api/runs/query", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: code = %d, want 400", body, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	(&Handler{}).APIRunsQuery(w, httptest.NewRequest(http.MethodGet, "/api/runs/query", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("GET: code = %d, Allow %q; want 405 allowing POST", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestAPINamespacesSparklinesValidation(t *testing.T) {
+	for _, query := range []string{"?days=0", "?days=-1", "?days=two", "?days=" + strconv.Itoa(maxDays+1)} {
+		w := httptest.NewRecorder()
+		(&Handler{}).APINamespacesSparklines(w, httptest.NewRequest(http.MethodGet, "/api/namespaces/sparklines"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: code = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"0d", 0, true},
+		{"-1h", 0, true},
+		{"1.5d", 0, true},
+		{"week", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseWindow(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseWindow(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestAPINamespaceSLOValidation(t *testing.T) {
+	for _, query := range []string{"", "?days=7", "?name=default&days=0", "?name=default&days=" + strconv.Itoa(maxDays+1)} {
+		w := httptest.NewRecorder()
+		(&Handler{}).APINamespaceSLO(w, httptest.NewRequest(http.MethodGet, "/api/namespace/slo"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: code = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestAPIMaintenance(t *testing.T) {
+	h := &Handler{maintenance: new(atomic.Bool)}
+	tests := []struct {
+		method, body string
+		code         int
+		want         bool
+	}{
+		{http.MethodGet, "", http.StatusOK, false},
+		{http.MethodPost, `{"enabled": true}`, http.StatusOK, true},
+		{http.MethodGet, "", http.StatusOK, true},
+		{http.MethodPost, `{}`, http.StatusBadRequest, true},
+		{http.MethodDelete, "", http.StatusMethodNotAllowed, true},
+		{http.MethodPost, `{"enabled": false}`, http.StatusOK, false},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		h.APIMaintenance(w, httptest.NewRequest(tt.method, "/api/maintenance", strings.NewReader(tt.body)))
+		if w.Code != tt.code || h.maintenance.Load() != tt.want {
+			t.Errorf("step %d, %s %s: code %d, maintenance %v; want %d, %v", i+1, tt.method, tt.body, w.Code, h.maintenance.Load(), tt.code, tt.want)
+		}
+	}
+}
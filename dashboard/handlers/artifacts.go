@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/kubeden/clopus-watcher/dashboard/db"
+)
+
+// defaultMaxArtifactSize caps artifact uploads unless SetMaxArtifactSize
+// says otherwise
+const defaultMaxArtifactSize = 10 << 20
+
+// SetMaxArtifactSize sets the largest artifact upload accepted, in bytes
+func (h *Handler) SetMaxArtifactSize(n int64) {
+	h.maxArtifactSize = n
+}
+
+// APIRunArtifacts lists a run's artifacts (GET ?run_id=) or uploads one
+// (POST ?run_id=&name=, raw body, type from Content-Type)
+func (h *Handler) APIRunArtifacts(w http.ResponseWriter, r *http.Request) {
+	runID, err := strconv.Atoi(r.URL.Query().Get("run_id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "run_id must be an integer")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		artifacts, err := h.db.ListRunArtifacts(runID)
+		if err != nil {
+			apiServerError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(artifacts)
+	case http.MethodPost:
+		h.uploadArtifact(w, r, runID)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (h *Handler) uploadArtifact(w http.ResponseWriter, r *http.Request, runID int) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeJSONError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxArtifactSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("artifact exceeds %d bytes", h.maxArtifactSize))
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "could not read body")
+		return
+	}
+
+	id, err := h.db.AddRunArtifact(runID, name, contentType, data)
+	if errors.Is(err, db.ErrRunNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "size": len(data)})
+}
+
+// APIArtifact downloads an artifact by ?id=. It is always served as an
+// attachment so uploaded HTML can't run in the dashboard's origin.
+func (h *Handler) APIArtifact(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "id must be an integer")
+		return
+	}
+
+	artifact, err := h.db.GetRunArtifact(id)
+	if errors.Is(err, db.ErrArtifactNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		apiServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", artifact.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": artifact.Name}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(artifact.Data)))
+	w.Write(artifact.Data)
+}
@@ -0,0 +1,85 @@
+//go:build sqlite
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kubeden/clopus-watcher/dashboard/db"
+)
+
+func TestArtifactRoundTrip(t *testing.T) {
+	h, database := newTestHandler(t)
+	runID, err := database.CreateRun("default", db.ModeAutonomous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := "/api/run/artifacts?run_id=" + strconv.FormatInt(runID, 10)
+
+	body := "<script>alert(1)</script>"
+	req := httptest.NewRequest(http.MethodPost, base+"&name=report.html", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/html")
+	w := httptest.NewRecorder()
+	h.APIRunArtifacts(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload: code = %d, body %s", w.Code, w.Body)
+	}
+	var created struct {
+		ID   int64 `json:"id"`
+		Size int   `json:"size"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.Size != len(body) {
+		t.Fatalf("upload response = %s", w.Body)
+	}
+
+	var artifacts []db.Artifact
+	getJSON(t, h.APIRunArtifacts, base, &artifacts)
+	if len(artifacts) != 1 || artifacts[0].Name != "report.html" || artifacts[0].Size != len(body) {
+		t.Errorf("artifacts = %+v", artifacts)
+	}
+
+	w = httptest.NewRecorder()
+	h.APIArtifact(w, httptest.NewRequest(http.MethodGet, "/api/artifact?id="+strconv.FormatInt(created.ID, 10), nil))
+	if w.Code != http.StatusOK || w.Body.String() != body {
+		t.Fatalf("download: code = %d, body %q", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename=report.html` {
+		t.Errorf("Content-Disposition = %q, want an attachment", got)
+	}
+	if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+	}
+
+	w = httptest.NewRecorder()
+	h.APIArtifact(w, httptest.NewRequest(http.MethodGet, "/api/artifact?id=99", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing artifact: code = %d, want 404", w.Code)
+	}
+}
+
+func TestArtifactUploadLimits(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.SetMaxArtifactSize(4)
+
+	tests := []struct {
+		target string
+		body   string
+		code   int
+	}{
+		{"/api/run/artifacts?run_id=1&name=a.txt", "too large", http.StatusRequestEntityTooLarge},
+		{"/api/run/artifacts?run_id=1", "ok", http.StatusBadRequest},
+		{"/api/run/artifacts?run_id=x&name=a.txt", "ok", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.APIRunArtifacts(w, httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body)))
+		if w.Code != tt.code {
+			t.Errorf("POST %s: code = %d, want %d", tt.target, w.Code, tt.code)
+		}
+	}
+}
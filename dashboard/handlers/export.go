@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/kubeden/clopus-watcher/dashboard/db"
+)
+
+// jsonlFlushEvery is how many lines are written between flushes
+const jsonlFlushEvery = 100
+
+// jsonlWriter writes one JSON value per line, flushing periodically so
+// consumers can start ingesting before the export finishes
+type jsonlWriter struct {
+	enc     *json.Encoder
+	flusher http.Flusher
+	n       int
+}
+
+func newJSONLWriter(w http.ResponseWriter) *jsonlWriter {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	return &jsonlWriter{enc: json.NewEncoder(w), flusher: flusher}
+}
+
+func (j *jsonlWriter) write(v interface{}) error {
+	if err := j.enc.Encode(v); err != nil {
+		return err
+	}
+	j.n++
+	if j.n%jsonlFlushEvery == 0 {
+		j.flush()
+	}
+	return nil
+}
+
+func (j *jsonlWriter) flush() {
+	if j.flusher != nil {
+		j.flusher.Flush()
+	}
+}
+
+// APIRunsJSONL streams runs as JSON Lines, filtered like /api/runs. Without
+// ?limit= every matching run is exported. Logs, which can be very large, are
+// left out unless ?include_log=true.
+func (h *Handler) APIRunsJSONL(w http.ResponseWriter, r *http.Request) {
+	filter, err := runFilter(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.WithoutLog = r.URL.Query().Get("include_log") != "true"
+	if filter.Limit, err = queryIntStrict(r, "limit", 0); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.Offset, err = queryIntStrict(r, "offset", 0); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	out := newJSONLWriter(w)
+	err = h.db.EachRun(filter, func(run db.Run) error {
+		return out.write(run)
+	})
+	if errors.Is(err, db.ErrInvalidSort) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		// Headers are likely sent already, so the stream just ends early
+		logRequestError(r, err)
+	}
+	out.flush()
+}
+
+// APIFixesJSONL streams fixes as JSON Lines, filtered by ?ns= and ?status=
+func (h *Handler) APIFixesJSONL(w http.ResponseWriter, r *http.Request) {
+	filter := db.FixFilter{
+		Namespace: r.URL.Query().Get("ns"),
+		Status:    r.URL.Query().Get("status"),
+		Sort:      r.URL.Query().Get("sort"),
+	}
+	var err error
+	if filter.Limit, err = queryIntStrict(r, "limit", 0); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.Offset, err = queryIntStrict(r, "offset", 0); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	out := newJSONLWriter(w)
+	err = h.db.EachFix(filter, func(fix db.Fix) error {
+		return out.write(fix)
+	})
+	if errors.Is(err, db.ErrInvalidSort) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		logRequestError(r, err)
+	}
+	out.flush()
+}
@@ -0,0 +1,46 @@
+//go:build sqlite
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kubeden/clopus-watcher/dashboard/db"
+)
+
+func TestAPIRunsJSONLLeavesOutLogs(t *testing.T) {
+	h, database := newTestHandler(t)
+	for i := 0; i < 2; i++ {
+		id, err := database.CreateRun("default", db.ModeAutonomous)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := database.CompleteRun(id, "ok", 1, 0, 0, "", "full run log"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	export := func(query string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.APIRunsJSONL(w, httptest.NewRequest(http.MethodGet, "/api/runs.jsonl"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: code = %d, body %s", query, w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+
+	body := export("")
+	if lines := strings.Count(body, "\n"); lines != 2 {
+		t.Errorf("exported %d lines, want 2", lines)
+	}
+	if strings.Contains(body, "full run log") {
+		t.Error("default export includes logs")
+	}
+	if body := export("?include_log=true"); strings.Count(body, "full run log") != 2 {
+		t.Errorf("include_log=true export = %s, want both logs", body)
+	}
+}
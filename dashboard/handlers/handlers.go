@@ -1,86 +1,260 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
 	"html/template"
+	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/kubeden/clopus-watcher/dashboard/db"
+	"github.com/kubeden/clopus-watcher/dashboard/logtail"
 )
 
 type Handler struct {
 	db       *db.DB
 	tmpl     *template.Template
 	logPath  string
+
+	staleThreshold   time.Duration // age after which a namespace's last run is stale
+	defaultNamespace string        // applied to pages when no ns is given
+	logDir           string        // per-namespace log files must resolve inside it
+	debug            bool          // adds X-Query-Duration to API responses
+	maxArtifactSize  int64         // largest artifact upload accepted, in bytes
+	maintenance      *atomic.Bool  // shows the maintenance banner; see SetMaintenance
+
+	ctx context.Context // stops background work such as log buffers; see SetContext
+
+	logBuffersMu sync.Mutex
+	logBuffers   map[string]*logBufferEntry // recent lines of each log file, by path
 }
 
 func New(database *db.DB, tmpl *template.Template, logPath string) *Handler {
 	return &Handler{
-		db:      database,
-		tmpl:    tmpl,
-		logPath: logPath,
+		db:              database,
+		tmpl:            tmpl,
+		logPath:         logPath,
+		staleThreshold:  time.Hour,
+		maxArtifactSize: defaultMaxArtifactSize,
+		maintenance:     new(atomic.Bool),
+		ctx:             context.Background(),
 	}
 }
 
+// SetContext ties background work started by the handler, such as the
+// buffers following log files, to ctx, typically the server's shutdown
+// context
+func (h *Handler) SetContext(ctx context.Context) {
+	h.ctx = ctx
+}
+
+// SetMaintenance shares the maintenance-mode flag, which pages show as a
+// banner and APIMaintenance toggles
+func (h *Handler) SetMaintenance(maintenance *atomic.Bool) {
+	h.maintenance = maintenance
+}
+
+// SetStaleThreshold sets how old a namespace's last completed run may be
+// before it is reported as stale
+func (h *Handler) SetStaleThreshold(d time.Duration) {
+	h.staleThreshold = d
+}
+
+// SetDebug toggles debug output such as the X-Query-Duration header
+func (h *Handler) SetDebug(debug bool) {
+	h.debug = debug
+}
+
+// SetLogDir confines per-namespace log files to dir. By default they are
+// confined to the directory of the log path's %s.
+func (h *Handler) SetLogDir(dir string) {
+	h.logDir = dir
+}
+
+// SetDefaultNamespace sets the namespace pages show when the request names
+// none. ?ns=all still shows every namespace.
+func (h *Handler) SetDefaultNamespace(namespace string) {
+	h.defaultNamespace = namespace
+}
+
+// pageNamespace resolves a page's namespace filter: an explicit ?ns= wins
+// ("all" meaning no filter), then the default namespace, then no filter.
+// selected reports whether either of the first two applied.
+func (h *Handler) pageNamespace(r *http.Request) (namespace string, selected bool) {
+	if ns := r.URL.Query().Get("ns"); ns != "" {
+		if ns == "all" {
+			return "", true
+		}
+		return ns, true
+	}
+	return h.defaultNamespace, h.defaultNamespace != ""
+}
+
 type PageData struct {
 	Namespaces      []db.NamespaceStats
 	CurrentNS       string
 	Runs            []db.Run
 	SelectedRun     *db.Run
-	SelectedFixes   []db.Fix
-	Stats           *db.NamespaceStats
+	SelectedFixes   RunFixesPage
+	Stats           *HeaderStats
 	Log             string
+	Maintenance     bool
+}
+
+// namespaceName matches valid Kubernetes namespace names, which also keeps
+// them safe to use in file paths
+var namespaceName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// logFile resolves the watcher log for namespace. A %s in the log path is
+// replaced by the namespace, for setups writing one log per namespace;
+// otherwise the namespace is ignored. The namespace must be a plain name and
+// the result must stay inside the log directory.
+func (h *Handler) logFile(namespace string) (string, error) {
+	i := strings.Index(h.logPath, "%s")
+	if i < 0 {
+		return h.logPath, nil
+	}
+	if namespace == "" {
+		return "", errors.New("namespace is required for per-namespace logs")
+	}
+	if strings.ContainsAny(namespace, `/\`) || strings.Contains(namespace, "..") || !namespaceName.MatchString(namespace) {
+		return "", fmt.Errorf("invalid namespace %q", namespace)
+	}
+
+	dir := h.logDir
+	if dir == "" {
+		dir = filepath.Dir(h.logPath[:i] + "x")
+	}
+	dir = filepath.Clean(dir)
+	path := filepath.Clean(strings.ReplaceAll(h.logPath, "%s", namespace))
+	if rel, err := filepath.Rel(dir, path); err != nil || rel == "." || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("log path for namespace %q is outside %s", namespace, dir)
+	}
+	return path, nil
+}
+
+// Log buffer limits: lines kept per log file, how many log files are
+// buffered before further ones are read from disk on each request, and how
+// long a buffer nobody reads or follows keeps running
+const (
+	logBufferLines = 500
+	maxLogBuffers  = 64
+	logBufferIdle  = 10 * time.Minute
+)
+
+// logBufferEntry is a running log buffer and what is needed to evict it
+type logBufferEntry struct {
+	*logtail.Buffer
+	stop     context.CancelFunc
+	lastUsed time.Time
+}
+
+// logBuffer returns the shared buffer following the log at path, starting
+// it on first use. It returns nil when the file doesn't exist yet or
+// maxLogBuffers are already running.
+func (h *Handler) logBuffer(path string) *logtail.Buffer {
+	h.logBuffersMu.Lock()
+	defer h.logBuffersMu.Unlock()
+
+	now := time.Now()
+	h.evictLogBuffers(now)
+	if e, ok := h.logBuffers[path]; ok {
+		e.lastUsed = now
+		return e.Buffer
+	}
+	if len(h.logBuffers) >= maxLogBuffers {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	if h.logBuffers == nil {
+		h.logBuffers = make(map[string]*logBufferEntry)
+	}
+	ctx, stop := context.WithCancel(h.ctx)
+	b := logtail.NewBuffer(path, logBufferLines)
+	h.logBuffers[path] = &logBufferEntry{b, stop, now}
+	b.Start(ctx, time.Second)
+	return b
 }
 
-func (h *Handler) readLog() string {
-	data, err := os.ReadFile(h.logPath)
+// evictLogBuffers stops the buffers that nobody follows and nobody read
+// within logBufferIdle of now. The caller holds logBuffersMu.
+func (h *Handler) evictLogBuffers(now time.Time) {
+	for path, e := range h.logBuffers {
+		if e.Subscribers() == 0 && now.Sub(e.lastUsed) > logBufferIdle {
+			e.stop()
+			delete(h.logBuffers, path)
+		}
+	}
+}
+
+func (h *Handler) readLog(namespace string) string {
+	path, err := h.logFile(namespace)
 	if err != nil {
-		return "No watcher log available yet. Waiting for first run..."
+		return "No watcher log available: " + err.Error()
 	}
-	lines := strings.Split(string(data), "\n")
-	if len(lines) > 200 {
-		lines = lines[len(lines)-200:]
+
+	var lines []string
+	if b := h.logBuffer(path); b != nil {
+		lines = b.Lines()
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "No watcher log available yet. Waiting for first run..."
+		}
+		lines = strings.Split(string(data), "\n")
+		if len(lines) > logBufferLines {
+			lines = lines[len(lines)-logBufferLines:]
+		}
 	}
 	return strings.Join(lines, "\n")
 }
 
 // Main page
 func (h *Handler) Index(w http.ResponseWriter, r *http.Request) {
-	namespace := r.URL.Query().Get("ns")
+	namespace, selected := h.pageNamespace(r)
 	runIDStr := r.URL.Query().Get("run")
 
 	namespaces, _ := h.db.GetNamespaces()
 
 	// If no namespace selected and we have namespaces, select first
-	if namespace == "" && len(namespaces) > 0 {
+	if !selected && len(namespaces) > 0 {
 		namespace = namespaces[0].Namespace
 	}
 
 	runs, _ := h.db.GetRuns(namespace, 50)
 
 	var selectedRun *db.Run
-	var selectedFixes []db.Fix
+	var selectedFixes RunFixesPage
 
 	// If run specified, get it; otherwise get latest
 	if runIDStr != "" {
 		runID, _ := strconv.Atoi(runIDStr)
-		selectedRun, _ = h.db.GetRun(runID)
+		selectedRun, _ = h.db.GetRunMeta(runID)
 		if selectedRun != nil {
-			selectedFixes, _ = h.db.GetFixesByRun(runID)
+			selectedFixes, _ = h.runFixesPage(runID, 0)
 		}
 	} else if len(runs) > 0 {
-		selectedRun, _ = h.db.GetRun(runs[0].ID)
+		selectedRun, _ = h.db.GetRunMeta(runs[0].ID)
 		if selectedRun != nil {
-			selectedFixes, _ = h.db.GetFixesByRun(runs[0].ID)
+			selectedFixes, _ = h.runFixesPage(runs[0].ID, 0)
 		}
 	}
 
-	var stats *db.NamespaceStats
+	var stats *HeaderStats
 	if namespace != "" {
-		stats, _ = h.db.GetNamespaceStats(namespace)
+		stats, _ = h.headerStats(namespace)
 	}
 
 	data := PageData{
@@ -90,18 +264,19 @@ func (h *Handler) Index(w http.ResponseWriter, r *http.Request) {
 		SelectedRun:   selectedRun,
 		SelectedFixes: selectedFixes,
 		Stats:         stats,
-		Log:           h.readLog(),
+		Log:           h.readLog(namespace),
+		Maintenance:   h.maintenance.Load(),
 	}
 
-	err := h.tmpl.ExecuteTemplate(w, "index.html", data)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+	h.render(w, r, "index.html", data)
 }
 
 // HTMX partials
+// RunsList renders the runs sidebar. It is polled, so it answers 304 when
+// the rendered list matches the client's If-None-Match.
 func (h *Handler) RunsList(w http.ResponseWriter, r *http.Request) {
-	namespace := r.URL.Query().Get("ns")
+	namespace, _ := h.pageNamespace(r)
+
 	runs, _ := h.db.GetRuns(namespace, 50)
 
 	data := struct {
@@ -109,7 +284,10 @@ func (h *Handler) RunsList(w http.ResponseWriter, r *http.Request) {
 		CurrentNS string
 	}{runs, namespace}
 
-	h.tmpl.ExecuteTemplate(w, "runs-list.html", data)
+	// no-cache makes browsers revalidate each poll instead of reusing the
+	// cached list
+	w.Header().Set("Cache-Control", "no-cache")
+	h.renderWithETag(w, r, "runs-list.html", data)
 }
 
 func (h *Handler) RunDetail(w http.ResponseWriter, r *http.Request) {
@@ -120,77 +298,307 @@ func (h *Handler) RunDetail(w http.ResponseWriter, r *http.Request) {
 	}
 
 	runID, _ := strconv.Atoi(runIDStr)
-	run, err := h.db.GetRun(runID)
+	run, err := h.db.GetRunMeta(runID)
 	if err != nil {
 		http.Error(w, "Run not found", http.StatusNotFound)
 		return
 	}
 
-	fixes, _ := h.db.GetFixesByRun(runID)
+	fixes, _ := h.runFixesPage(runID, 0)
 
 	data := struct {
 		Run   *db.Run
-		Fixes []db.Fix
+		Fixes RunFixesPage
 	}{run, fixes}
 
-	h.tmpl.ExecuteTemplate(w, "run-detail.html", data)
+	h.render(w, r, "run-detail.html", data)
+}
+
+// runFixesPageSize is the number of fixes the run detail shows at a time
+const runFixesPageSize = 50
+
+// RunFixesPage is a page of a run's fixes with the offset of the next one
+type RunFixesPage struct {
+	RunID      int
+	Fixes      []db.Fix
+	HasMore    bool
+	NextOffset int
+}
+
+func (h *Handler) runFixesPage(runID, offset int) (RunFixesPage, error) {
+	// One extra to tell whether there is more
+	fixes, err := h.db.GetFixesByRunPaged(runID, runFixesPageSize+1, offset)
+	page := RunFixesPage{RunID: runID, Fixes: fixes, NextOffset: offset + runFixesPageSize}
+	if len(fixes) > runFixesPageSize {
+		page.Fixes = fixes[:runFixesPageSize]
+		page.HasMore = true
+	}
+	return page, err
+}
+
+// RunFixes renders the next page of a run's fixes for the run detail's
+// "Load more" button
+func (h *Handler) RunFixes(w http.ResponseWriter, r *http.Request) {
+	runID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Missing run id", http.StatusBadRequest)
+		return
+	}
+	offset, err := queryIntStrict(r, "offset", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.runFixesPage(runID, offset)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+	h.render(w, r, "run-fixes.html", page)
+}
+
+// RunLog streams a run's full log as escaped HTML, loaded lazily by the
+// run detail view
+func (h *Handler) RunLog(w http.ResponseWriter, r *http.Request) {
+	runID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Missing run id", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.db.StreamRunLog(runID, htmlEscapeWriter{w}); err != nil {
+		if errors.Is(err, db.ErrRunNotFound) {
+			http.Error(w, "Run not found", http.StatusNotFound)
+			return
+		}
+		serverError(w, r, err)
+	}
+}
+
+// htmlEscapeWriter HTML-escapes everything written through it
+type htmlEscapeWriter struct {
+	w io.Writer
+}
+
+func (e htmlEscapeWriter) Write(p []byte) (int, error) {
+	template.HTMLEscape(e.w, p)
+	return len(p), nil
+}
+
+// fixesPageSize is the number of fixes per page of the fixes partial
+const fixesPageSize = 25
+
+// FixesList renders a page of fixes, filtered by ?ns= and ?status= and
+// ordered by ?sort=, starting at ?offset=
+func (h *Handler) FixesList(w http.ResponseWriter, r *http.Request) {
+	offset, err := queryIntStrict(r, "offset", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := db.FixFilter{
+		Namespace: r.URL.Query().Get("ns"),
+		Status:    r.URL.Query().Get("status"),
+		Sort:      r.URL.Query().Get("sort"),
+		Limit:     fixesPageSize + 1, // one extra to tell whether there is a next page
+		Offset:    offset,
+	}
+	fixes, err := h.db.GetFixesFiltered(filter)
+	if errors.Is(err, db.ErrInvalidSort) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	hasNext := len(fixes) > fixesPageSize
+	if hasNext {
+		fixes = fixes[:fixesPageSize]
+	}
+
+	data := struct {
+		Fixes      []db.Fix
+		Namespace  string
+		Status     string
+		Sort       string
+		Offset     int
+		HasPrev    bool
+		PrevOffset int
+		HasNext    bool
+		NextOffset int
+	}{
+		Fixes:      fixes,
+		Namespace:  filter.Namespace,
+		Status:     filter.Status,
+		Sort:       filter.Sort,
+		Offset:     offset,
+		HasPrev:    offset > 0,
+		PrevOffset: max(offset-fixesPageSize, 0),
+		HasNext:    hasNext,
+		NextOffset: offset + fixesPageSize,
+	}
+
+	h.render(w, r, "fixes-list.html", data)
+}
+
+// HeaderStats are the run totals in the page header
+type HeaderStats struct {
+	db.NamespaceStats
+	RunningCount int
+}
+
+// headerStats loads a namespace's header totals with a single query
+func (h *Handler) headerStats(namespace string) (*HeaderStats, error) {
+	counts, err := h.db.GetRunStatusCounts(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return &HeaderStats{
+		NamespaceStats: db.NamespaceStatsFromCounts(namespace, counts),
+		RunningCount:   counts["running"],
+	}, nil
 }
 
 func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
 	namespace := r.URL.Query().Get("ns")
-	stats, _ := h.db.GetNamespaceStats(namespace)
-	h.tmpl.ExecuteTemplate(w, "stats.html", stats)
+	stats, _ := h.headerStats(namespace)
+	h.render(w, r, "stats.html", stats)
 }
 
 func (h *Handler) LiveLog(w http.ResponseWriter, r *http.Request) {
-	log := h.readLog()
+	namespace := r.URL.Query().Get("namespace")
+	if _, err := h.logFile(namespace); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log := h.readLog(namespace)
 	w.Header().Set("Content-Type", "text/html")
 	escaped := template.HTMLEscapeString(log)
 	escaped = strings.ReplaceAll(escaped, "\n", "<br>")
 	w.Write([]byte(escaped))
 }
 
-// API endpoints (JSON)
-func (h *Handler) APINamespaces(w http.ResponseWriter, r *http.Request) {
-	namespaces, err := h.db.GetNamespaces()
+// LiveLogStream streams lines appended to the watcher log (of ?namespace=
+// with per-namespace logs) as server-sent events, following the file across
+// rotations. Streams of the same file share one tail of it.
+func (h *Handler) LiveLogStream(w http.ResponseWriter, r *http.Request) {
+	path, err := h.logFile(r.URL.Query().Get("namespace"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(namespaces)
-}
 
-func (h *Handler) APIRuns(w http.ResponseWriter, r *http.Request) {
-	namespace := r.URL.Query().Get("ns")
-	runs, err := h.db.GetRuns(namespace, 100)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(runs)
-}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
 
-func (h *Handler) APIRun(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
-	id, _ := strconv.Atoi(idStr)
+	send := func(line string) error {
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", template.HTMLEscapeString(line)); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
 
-	run, err := h.db.GetRun(id)
-	if err != nil {
-		http.Error(w, "Not found", http.StatusNotFound)
+	// Share the buffer's tail of the file; follow it directly only when the
+	// file doesn't exist yet or too many files are buffered
+	b := h.logBuffer(path)
+	if b == nil {
+		err = logtail.Follow(r.Context(), path, time.Second, send)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logRequestError(r, err)
+		}
 		return
 	}
 
-	fixes, _ := h.db.GetFixesByRun(id)
+	lines, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line, ok := <-lines:
+			if !ok {
+				// Dropped for falling behind; the client reconnects
+				return
+			}
+			if err := send(line); err != nil {
+				return
+			}
+		}
+	}
+}
 
-	result := struct {
-		Run   *db.Run  `json:"run"`
-		Fixes []db.Fix `json:"fixes"`
-	}{run, fixes}
+// queryList parses a comma-separated query parameter, dropping empty entries
+func queryList(r *http.Request, key string) []string {
+	var items []string
+	for _, item := range strings.Split(r.URL.Query().Get(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+// includes reports whether the comma-separated include parameter names item
+func includes(r *http.Request, item string) bool {
+	for _, v := range queryList(r, "include") {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
+// queryTime parses an RFC3339 timestamp or YYYY-MM-DD date query parameter.
+// A missing parameter yields the zero time.
+func queryTime(r *http.Request, key string) (time.Time, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: expected RFC3339 time or YYYY-MM-DD", key)
+	}
+	return t, nil
+}
+
+// queryIntStrict parses a non-negative integer query parameter, returning
+// def when it is missing and an error when it is malformed
+func queryIntStrict(r *http.Request, key string, def int) (int, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return v, nil
+}
+
+// queryInt parses an integer query parameter, returning def when it is
+// missing or not a positive number
+func queryInt(r *http.Request, key string, def int) int {
+	v, err := strconv.Atoi(r.URL.Query().Get(key))
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
 }
 
 func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
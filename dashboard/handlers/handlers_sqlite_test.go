@@ -0,0 +1,144 @@
+//go:build sqlite
+
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kubeden/clopus-watcher/dashboard/db"
+)
+
+func TestFixesListPaging(t *testing.T) {
+	h, database := newTestHandler(t)
+	h.tmpl = template.Must(template.New("fixes-list.html").Parse(
+		`{{len .Fixes}} prev={{.HasPrev}}/{{.PrevOffset}} next={{.HasNext}}/{{.NextOffset}}`))
+	run, err := database.CreateRun("default", db.ModeAutonomous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < fixesPageSize+5; i++ {
+		status := "success"
+		if i%5 == 0 {
+			status = "failed"
+		}
+		if _, _, err := database.CreateFix(db.Fix{RunID: int(run), Namespace: "default", PodName: "api", ErrorType: "OOMKilled", Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		code  int
+		want  string
+	}{
+		{"", http.StatusOK, "25 prev=false/0 next=true/25"},
+		{"?offset=25", http.StatusOK, "5 prev=true/0 next=false/50"},
+		{"?status=failed", http.StatusOK, "6 prev=false/0 next=false/25"},
+		{"?ns=other", http.StatusOK, "0 prev=false/0 next=false/25"},
+		{"?offset=-1", http.StatusBadRequest, ""},
+		{"?sort=error_message", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.FixesList(w, httptest.NewRequest(http.MethodGet, "/partials/fixes"+tt.query, nil))
+		if w.Code != tt.code {
+			t.Errorf("%q: code = %d, want %d", tt.query, w.Code, tt.code)
+			continue
+		}
+		if tt.want != "" && w.Body.String() != tt.want {
+			t.Errorf("%q: rendered %q, want %q", tt.query, w.Body, tt.want)
+		}
+	}
+}
+
+func TestRunFixesLoadMore(t *testing.T) {
+	h, database := newTestHandler(t)
+	h.tmpl = template.Must(template.New("run-fixes.html").Parse(`{{len .Fixes}} more={{.HasMore}}/{{.NextOffset}}`))
+	run, err := database.CreateRun("default", db.ModeAutonomous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < runFixesPageSize+5; i++ {
+		if _, _, err := database.CreateFix(db.Fix{RunID: int(run), Namespace: "default", PodName: fmt.Sprintf("api-%d", i), ErrorType: "OOMKilled", Status: "success"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		code  int
+		want  string
+	}{
+		{"?id=1", http.StatusOK, "50 more=true/50"},
+		{"?id=1&offset=50", http.StatusOK, "5 more=false/100"},
+		{"?id=2", http.StatusOK, "0 more=false/50"},
+		{"", http.StatusBadRequest, ""},
+		{"?id=1&offset=x", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.RunFixes(w, httptest.NewRequest(http.MethodGet, "/partials/run/fixes"+tt.query, nil))
+		if w.Code != tt.code {
+			t.Errorf("%q: code = %d, want %d", tt.query, w.Code, tt.code)
+			continue
+		}
+		if tt.want != "" && w.Body.String() != tt.want {
+			t.Errorf("%q: rendered %q, want %q", tt.query, w.Body, tt.want)
+		}
+	}
+}
+
+// TestRunsListNotModified checks the sidebar answers 304 until any change
+// to its runs, including ones that don't touch started_at or ended_at
+func TestRunsListNotModified(t *testing.T) {
+	h, database := newTestHandler(t)
+	h.tmpl = template.Must(template.New("runs-list.html").Parse(`{{range .Runs}}{{.ID}}:{{.Status}};{{end}}`))
+	id, err := database.CreateRun("default", db.ModeAutonomous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CompleteRun(id, "failed", 0, 0, 0, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/partials/runs?ns=default", nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		h.RunsList(w, r)
+		return w
+	}
+
+	w := get("")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first poll: code %d, ETag %q; want 200 with one", w.Code, etag)
+	}
+	if w := get(etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("unchanged: code = %d, want an empty 304", w.Code)
+	}
+
+	for _, change := range []struct {
+		name string
+		do   func() error
+	}{
+		{"soft delete", func() error { return database.SoftDeleteRun(int(id)) }},
+		{"restore", func() error { return database.RestoreRun(int(id)) }},
+		{"namespace delete", func() error { _, err := database.DeleteRunsByNamespace("default"); return err }},
+	} {
+		if err := change.do(); err != nil {
+			t.Fatalf("%s: %v", change.name, err)
+		}
+		w := get(etag)
+		if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+			t.Errorf("after %s: code %d, ETag %q; want 200 with a new ETag", change.name, w.Code, w.Header().Get("ETag"))
+		}
+		etag = w.Header().Get("ETag")
+	}
+}
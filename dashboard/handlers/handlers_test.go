@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPageNamespace(t *testing.T) {
+	tests := []struct {
+		def          string
+		query        string
+		want         string
+		wantSelected bool
+	}{
+		{"", "", "", false},
+		{"", "?ns=prod", "prod", true},
+		{"", "?ns=all", "", true},
+		{"staging", "", "staging", true},
+		{"staging", "?ns=prod", "prod", true},
+		{"staging", "?ns=all", "", true},
+	}
+	for _, tt := range tests {
+		h := &Handler{}
+		h.SetDefaultNamespace(tt.def)
+		got, selected := h.pageNamespace(httptest.NewRequest(http.MethodGet, "/"+tt.query, nil))
+		if got != tt.want || selected != tt.wantSelected {
+			t.Errorf("default %q, %q: pageNamespace = %q, %v; want %q, %v", tt.def, tt.query, got, selected, tt.want, tt.wantSelected)
+		}
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	tests := []struct {
+		logPath   string
+		namespace string
+		want      string
+		wantErr   bool
+	}{
+		{"/data/watcher.log", "", "/data/watcher.log", false},
+		{"/data/watcher.log", "prod", "/data/watcher.log", false},
+		{"/data/%s.log", "prod", "/data/prod.log", false},
+		{"/data/logs/%s/watcher.log", "kube-system", "/data/logs/kube-system/watcher.log", false},
+		{"/data/%s.log", "", "", true},
+	}
+	for _, tt := range tests {
+		h := &Handler{logPath: tt.logPath}
+		got, err := h.logFile(tt.namespace)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("logFile(%q) with %s = %q, %v; want %q, error %v", tt.namespace, tt.logPath, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLogFileTraversal(t *testing.T) {
+	for _, namespace := range []string{
+		"..", "../etc", "prod/../../etc", `prod\x`, "/etc/passwd", "Prod", "-prod", "prod.", strings.Repeat("a", 64),
+	} {
+		h := &Handler{logPath: "/data/%s.log"}
+		if path, err := h.logFile(namespace); err == nil {
+			t.Errorf("logFile(%q) = %q, want an error", namespace, path)
+		}
+	}
+}
+
+func TestLogFileConfinedToLogDir(t *testing.T) {
+	h := &Handler{logPath: "/data/logs/../%s.log"}
+	if path, err := h.logFile("prod"); err != nil || path != "/data/prod.log" {
+		t.Errorf("without LOG_DIR: logFile = %q, %v; want /data/prod.log", path, err)
+	}
+
+	h.SetLogDir("/data/logs")
+	if path, err := h.logFile("prod"); err == nil {
+		t.Errorf("outside LOG_DIR: logFile = %q, want an error", path)
+	}
+
+	h = &Handler{logPath: "/data/logs/%s.log"}
+	h.SetLogDir("/data/logs/")
+	if path, err := h.logFile("prod"); err != nil || path != "/data/logs/prod.log" {
+		t.Errorf("inside LOG_DIR: logFile = %q, %v", path, err)
+	}
+}
+
+// TestLogBufferEviction checks buffers are shared, kept while followed and
+// stopped once idle
+func TestLogBufferEviction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watcher.log")
+	if err := os.WriteFile(path, []byte("line\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h := New(nil, nil, path)
+	h.SetContext(ctx)
+
+	b := h.logBuffer(path)
+	if b == nil || h.logBuffer(path) != b {
+		t.Fatal("logBuffer didn't share one buffer per path")
+	}
+
+	_, unsubscribe := b.Subscribe()
+	later := time.Now().Add(2 * logBufferIdle)
+	h.logBuffersMu.Lock()
+	h.evictLogBuffers(later)
+	kept := len(h.logBuffers)
+	h.logBuffersMu.Unlock()
+	if kept != 1 {
+		t.Error("followed buffer was evicted")
+	}
+
+	unsubscribe()
+	h.logBuffersMu.Lock()
+	h.evictLogBuffers(later)
+	kept = len(h.logBuffers)
+	h.logBuffersMu.Unlock()
+	if kept != 0 {
+		t.Error("idle buffer was kept")
+	}
+	if h.logBuffer(path) == b {
+		t.Error("evicted buffer was reused")
+	}
+}
@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec documents the /api endpoints. Update it with the handlers.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// APIOpenAPI serves the OpenAPI 3 document for the JSON API
+func (h *Handler) APIOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// render executes template name into a buffer and only then writes it, so
+// a template failing halfway sends a clean error page instead of half a page
+func (h *Handler) render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	buf, ok := h.execute(w, r, name, data)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// renderWithETag is render for polled partials: the page is tagged with a
+// hash of its body, and a matching If-None-Match gets a 304 instead
+func (h *Handler) renderWithETag(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	buf, ok := h.execute(w, r, name, data)
+	if !ok {
+		return
+	}
+	etag := bodyETag(buf.Bytes())
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// execute runs template name into a buffer, writing the error page and
+// returning false when it fails
+func (h *Handler) execute(w http.ResponseWriter, r *http.Request, name string, data interface{}) (*bytes.Buffer, bool) {
+	var buf bytes.Buffer
+	if err := h.tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		logRequestError(r, fmt.Errorf("render %s: %w", name, err))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `<div class="p-6 text-sm text-red-400">Something went wrong rendering this page (request %s).</div>`,
+			template.HTMLEscapeString(RequestID(r.Context())))
+		return nil, false
+	}
+	return &buf, true
+}
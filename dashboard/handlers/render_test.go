@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var errTemplate = errors.New("bad data")
+
+func TestRender(t *testing.T) {
+	// The call fails after "before" has been executed, so a direct write
+	// would leave half a page
+	h := &Handler{tmpl: template.Must(template.New("page.html").Funcs(template.FuncMap{
+		"fail": func(fail bool) (string, error) {
+			if fail {
+				return "", errTemplate
+			}
+			return "after", nil
+		},
+	}).Parse(`before {{fail .}}`))}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(WithRequestID(r.Context(), "req-<1>"))
+	w := httptest.NewRecorder()
+	h.render(w, r, "page.html", true)
+	body := w.Body.String()
+	if w.Code != http.StatusInternalServerError || strings.Contains(body, "before") || !strings.Contains(body, "req-&lt;1&gt;") {
+		t.Errorf("failing template: code %d, body %q; want a 500 naming the escaped request id only", w.Code, body)
+	}
+
+	w = httptest.NewRecorder()
+	h.render(w, r, "page.html", false)
+	if w.Code != http.StatusOK || w.Body.String() != "before after" || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("template: code %d, body %q, content type %q", w.Code, w.Body, w.Header().Get("Content-Type"))
+	}
+
+	w = httptest.NewRecorder()
+	h.render(w, r, "missing.html", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("missing template: code = %d, want 500", w.Code)
+	}
+}
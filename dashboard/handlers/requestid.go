@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request id stored in ctx, or "" if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// serverError logs err with the request id so it can be correlated with the
+// access log, then responds with a generic 500 naming only the request id,
+// as database errors can reveal queries and schema
+func serverError(w http.ResponseWriter, r *http.Request, err error) {
+	logRequestError(r, err)
+	msg := "Internal server error"
+	if id := RequestID(r.Context()); id != "" {
+		msg += " (request " + id + ")"
+	}
+	http.Error(w, msg, http.StatusInternalServerError)
+}
+
+func logRequestError(r *http.Request, err error) {
+	slog.Error("request failed",
+		"request_id", RequestID(r.Context()),
+		"path", r.URL.Path,
+		"error", err,
+	)
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerErrorHidesError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/partials/runs", nil)
+	r = r.WithContext(WithRequestID(r.Context(), "req-123"))
+	w := httptest.NewRecorder()
+
+	serverError(w, r, errors.New(`pq: relation "clopus_watcher_runs" does not exist`))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("code = %d, want 500", w.Code)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "clopus_watcher_runs") {
+		t.Errorf("body %q leaks the error", body)
+	}
+	if !strings.Contains(body, "req-123") {
+		t.Errorf("body %q doesn't name the request id", body)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if id := RequestID(r.Context()); id != "" {
+		t.Errorf("RequestID without one = %q", id)
+	}
+	if id := RequestID(WithRequestID(r.Context(), "abc")); id != "abc" {
+		t.Errorf("RequestID = %q, want abc", id)
+	}
+}
@@ -0,0 +1,67 @@
+//go:build sqlite
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/kubeden/clopus-watcher/dashboard/db"
+)
+
+func TestHealthHandler(t *testing.T) {
+	database, err := db.Open(db.DriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := healthHandler(database)
+
+	check := func() (string, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("code = %d, want 200 even when the database is down", w.Code)
+		}
+		var body struct {
+			Status  string `json:"status"`
+			Version string `json:"version"`
+			DB      struct {
+				Status string `json:"status"`
+				Error  string `json:"error"`
+			} `json:"db"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Status != "ok" || body.Version != version {
+			t.Errorf("status %q, version %q", body.Status, body.Version)
+		}
+		return body.DB.Status, body.DB.Error
+	}
+
+	if status, _ := check(); status != "ok" {
+		t.Errorf("db status = %q, want ok", status)
+	}
+	database.Close()
+	if status, msg := check(); status != "error" || msg != "unavailable" {
+		t.Errorf("closed db status = %q (%q), want error without the driver's message", status, msg)
+	}
+}
+
+func TestReadyzHandler(t *testing.T) {
+	database, err := db.Open(db.DriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	w := httptest.NewRecorder()
+	readyzHandler(database)(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"status":"ok"}` {
+		t.Errorf("healthy: code %d, body %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/kubeden/clopus-watcher/dashboard/db"
+)
+
+// errMaintenance is returned by the import func while maintenance mode is on
+var errMaintenance = errors.New("maintenance mode")
+
+// pauseForMaintenance wraps importFn to return errMaintenance instead of
+// importing while maintenance is on
+func pauseForMaintenance(maintenance *atomic.Bool, importFn func() (*db.ImportResult, error)) func() (*db.ImportResult, error) {
+	return func() (*db.ImportResult, error) {
+		if maintenance.Load() {
+			return nil, errMaintenance
+		}
+		return importFn()
+	}
+}
+
+// runImporter calls importFn every interval until ctx is cancelled. Imports
+// run on the ticker goroutine, so a cycle that is still running when the next
+// tick fires causes that tick to be skipped rather than queued.
+func runImporter(ctx context.Context, interval time.Duration, importFn func() (*db.ImportResult, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			logImport(importFn())
+		}
+	}
+}
+
+func logImport(res *db.ImportResult, err error) {
+	if errors.Is(err, errMaintenance) {
+		slog.Info("import skipped for maintenance mode")
+		return
+	}
+	if err != nil {
+		slog.Warn("import failed", "error", err)
+		return
+	}
+	slog.Info("import complete",
+		"files", res.Files,
+		"imported", res.Imported,
+		"skipped", res.Skipped,
+		"errors", len(res.Errors),
+	)
+	for _, fileErr := range res.Errors {
+		var importErr *db.ImportError
+		if errors.As(fileErr, &importErr) {
+			slog.Warn("import error",
+				"file", importErr.File,
+				"line", importErr.Line,
+				"column", importErr.Column,
+				"field", importErr.Field,
+				"error", importErr.Err,
+			)
+			continue
+		}
+		slog.Warn("import error", "error", fileErr)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kubeden/clopus-watcher/dashboard/db"
+)
+
+func TestRunImporter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := make(chan struct{}, 10)
+	done := make(chan struct{})
+	go func() {
+		runImporter(ctx, time.Millisecond, func() (*db.ImportResult, error) {
+			calls <- struct{}{}
+			return &db.ImportResult{}, nil
+		})
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-calls:
+		case <-time.After(time.Second):
+			t.Fatalf("import %d never ran", i+1)
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("runImporter didn't return after cancel")
+	}
+}
+
+func TestPauseForMaintenance(t *testing.T) {
+	var maintenance atomic.Bool
+	calls := 0
+	importFn := pauseForMaintenance(&maintenance, func() (*db.ImportResult, error) {
+		calls++
+		return &db.ImportResult{Imported: 1}, nil
+	})
+
+	maintenance.Store(true)
+	if res, err := importFn(); res != nil || !errors.Is(err, errMaintenance) || calls != 0 {
+		t.Errorf("under maintenance: %+v, %v after %d imports; want errMaintenance without importing", res, err, calls)
+	}
+
+	maintenance.Store(false)
+	if res, err := importFn(); err != nil || res.Imported != 1 || calls != 1 {
+		t.Errorf("after maintenance: %+v, %v after %d imports; want one import", res, err, calls)
+	}
+}
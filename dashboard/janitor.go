@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// janitorTask is a periodic maintenance job returning how many rows it touched
+type janitorTask struct {
+	name string
+	run  func() (int, error)
+}
+
+// pauseTasksForMaintenance wraps each task to return errMaintenance instead
+// of writing while maintenance is on
+func pauseTasksForMaintenance(maintenance *atomic.Bool, tasks []janitorTask) []janitorTask {
+	paused := make([]janitorTask, len(tasks))
+	for i, task := range tasks {
+		run := task.run
+		paused[i] = janitorTask{task.name, func() (int, error) {
+			if maintenance.Load() {
+				return 0, errMaintenance
+			}
+			return run()
+		}}
+	}
+	return paused
+}
+
+// runJanitor runs every task once per interval until ctx is cancelled
+func runJanitor(ctx context.Context, interval time.Duration, tasks []janitorTask) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, task := range tasks {
+				n, err := task.run()
+				if errors.Is(err, errMaintenance) {
+					slog.Info("janitor task skipped for maintenance mode", "task", task.name)
+					continue
+				}
+				if err != nil {
+					slog.Warn("janitor task failed", "task", task.name, "error", err)
+					continue
+				}
+				slog.Info("janitor task complete", "task", task.name, "affected", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPauseTasksForMaintenance(t *testing.T) {
+	var maintenance atomic.Bool
+	calls := 0
+	tasks := pauseTasksForMaintenance(&maintenance, []janitorTask{{"count", func() (int, error) {
+		calls++
+		return 1, nil
+	}}})
+
+	maintenance.Store(true)
+	if n, err := tasks[0].run(); n != 0 || !errors.Is(err, errMaintenance) || calls != 0 {
+		t.Errorf("under maintenance: %d, %v after %d runs; want errMaintenance without running", n, err, calls)
+	}
+
+	maintenance.Store(false)
+	if n, err := tasks[0].run(); n != 1 || err != nil || calls != 1 || tasks[0].name != "count" {
+		t.Errorf("after maintenance: %d, %v after %d runs; want one run", n, err, calls)
+	}
+}
@@ -0,0 +1,238 @@
+// Package jwks fetches and caches the Platform's JSON Web Key Set, for
+// verifying Platform-issued JWTs without a network round trip per request.
+//
+// Keys are cached by kid and refreshed periodically. A lookup for an unknown
+// kid triggers an immediate refresh, so keys rotated in on the Platform are
+// picked up without waiting for the next interval. Every fetch is bounded by
+// a short timeout so a slow Platform can't stall auth checks.
+package jwks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrKeyNotFound is returned by Key when the kid isn't in the key set, even
+// after a refresh
+var ErrKeyNotFound = errors.New("jwks: key not found")
+
+// Defaults for the zero Options values
+const (
+	DefaultTimeout         = 5 * time.Second
+	DefaultRefreshInterval = time.Hour
+	DefaultMinRefresh      = 30 * time.Second
+)
+
+// Options tunes a KeySet; zero values use the defaults above
+type Options struct {
+	Timeout         time.Duration // bound on each fetch
+	RefreshInterval time.Duration // how often Run refreshes the keys
+	MinRefresh      time.Duration // minimum gap between unknown-kid refreshes
+}
+
+// KeySet is a cached JWKS. It is safe for concurrent use.
+type KeySet struct {
+	url    string
+	client *http.Client
+	opts   Options
+
+	mu      sync.RWMutex
+	keys    map[string]interface{} // *rsa.PublicKey or *ecdsa.PublicKey by kid
+	fetched time.Time              // last fetch attempt, for MinRefresh
+
+	refreshMu sync.Mutex // serializes fetches
+}
+
+// New returns a KeySet for the JWKS at url. No request is made until the
+// first Key or Refresh call.
+func New(url string, opts Options) *KeySet {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = DefaultRefreshInterval
+	}
+	if opts.MinRefresh <= 0 {
+		opts.MinRefresh = DefaultMinRefresh
+	}
+	return &KeySet{
+		url:    url,
+		client: &http.Client{Timeout: opts.Timeout},
+		opts:   opts,
+		keys:   map[string]interface{}{},
+	}
+}
+
+// Key returns the public key for kid, refreshing the set once if kid is
+// unknown and the last fetch is older than MinRefresh
+func (k *KeySet) Key(ctx context.Context, kid string) (interface{}, error) {
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+
+	k.mu.RLock()
+	stale := time.Since(k.fetched) >= k.opts.MinRefresh
+	k.mu.RUnlock()
+	if stale {
+		if err := k.Refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, kid)
+}
+
+func (k *KeySet) lookup(kid string) (interface{}, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// Refresh fetches the key set and replaces the cached keys. On failure the
+// previous keys are kept.
+func (k *KeySet) Refresh(ctx context.Context) error {
+	k.refreshMu.Lock()
+	defer k.refreshMu.Unlock()
+
+	k.mu.Lock()
+	k.fetched = time.Now()
+	k.mu.Unlock()
+
+	keys, err := k.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the keys every RefreshInterval until ctx is done. Failures
+// are logged and the cached keys stay in use.
+func (k *KeySet) Run(ctx context.Context) {
+	ticker := time.NewTicker(k.opts.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := k.Refresh(ctx); err != nil {
+			log.Printf("JWKS refresh from %s failed: %v", k.url, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// jsonKey is one entry of a JWKS document; only RSA and EC keys are used
+type jsonKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k *KeySet) fetch(ctx context.Context) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("jwks: fetch: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: fetch: status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Keys []jsonKey `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("jwks: decode: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(doc.Keys))
+	for _, jk := range doc.Keys {
+		key, err := jk.publicKey()
+		if err != nil {
+			// Skip keys we can't use rather than rejecting the whole set
+			log.Printf("JWKS key %q skipped: %v", jk.Kid, err)
+			continue
+		}
+		keys[jk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (jk jsonKey) publicKey() (interface{}, error) {
+	switch jk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jk.Crv)
+		}
+		x, err := decodeBigInt(jk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jk.Kty)
+}
+
+// decodeBigInt decodes a base64url (unpadded) big-endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,183 @@
+package jwks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jwksServer serves whatever keys it currently holds and counts fetches
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    []jsonKey
+	status  int
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keys ...jsonKey) *jwksServer {
+	s := &jwksServer{keys: keys, status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.status != http.StatusOK {
+			w.WriteHeader(s.status)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) set(status int, keys ...jsonKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	s.keys = keys
+}
+
+func encodeBigInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+func rsaKey(t *testing.T, kid string) (jsonKey, *rsa.PublicKey) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := &priv.PublicKey
+	return jsonKey{Kid: kid, Kty: "RSA", N: encodeBigInt(pub.N), E: encodeBigInt(big.NewInt(int64(pub.E)))}, pub
+}
+
+func ecKey(t *testing.T, kid string) (jsonKey, *ecdsa.PublicKey) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := &priv.PublicKey
+	return jsonKey{Kid: kid, Kty: "EC", Crv: "P-256", X: encodeBigInt(pub.X), Y: encodeBigInt(pub.Y)}, pub
+}
+
+func TestKey(t *testing.T) {
+	rsaJSON, rsaPub := rsaKey(t, "rsa-1")
+	ecJSON, ecPub := ecKey(t, "ec-1")
+	unusable := jsonKey{Kid: "oct-1", Kty: "oct"}
+	srv := newJWKSServer(t, rsaJSON, ecJSON, unusable)
+	keys := New(srv.URL, Options{})
+	if srv.fetches.Load() != 0 {
+		t.Fatal("New fetched the key set")
+	}
+
+	key, err := keys.Key(context.Background(), "rsa-1")
+	if got, ok := key.(*rsa.PublicKey); err != nil || !ok || !got.Equal(rsaPub) {
+		t.Errorf("Key(rsa-1) = %v, %v", key, err)
+	}
+	key, err = keys.Key(context.Background(), "ec-1")
+	if got, ok := key.(*ecdsa.PublicKey); err != nil || !ok || !got.Equal(ecPub) {
+		t.Errorf("Key(ec-1) = %v, %v", key, err)
+	}
+	if _, err := keys.Key(context.Background(), "oct-1"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Key(oct-1): err = %v, want ErrKeyNotFound for the skipped key", err)
+	}
+	if n := srv.fetches.Load(); n != 1 {
+		t.Errorf("%d fetches, want 1 within MinRefresh", n)
+	}
+}
+
+// TestKeyRotation rotates the served keys: an unknown kid refreshes the
+// set, but no more often than MinRefresh
+func TestKeyRotation(t *testing.T) {
+	oldJSON, _ := rsaKey(t, "old")
+	newJSON, newPub := rsaKey(t, "new")
+	srv := newJWKSServer(t, oldJSON)
+	keys := New(srv.URL, Options{MinRefresh: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	if _, err := keys.Key(ctx, "old"); err != nil {
+		t.Fatal(err)
+	}
+	srv.set(http.StatusOK, newJSON)
+
+	// Too soon after the first fetch to refresh
+	if _, err := keys.Key(ctx, "new"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Key(new) within MinRefresh: err = %v, want ErrKeyNotFound", err)
+	}
+	if n := srv.fetches.Load(); n != 1 {
+		t.Errorf("%d fetches within MinRefresh, want 1", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	key, err := keys.Key(ctx, "new")
+	if got, ok := key.(*rsa.PublicKey); err != nil || !ok || !got.Equal(newPub) {
+		t.Errorf("Key(new) after rotation = %v, %v", key, err)
+	}
+	if _, err := keys.Key(ctx, "old"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Key(old) after rotation: err = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestRefreshFailureKeepsKeys(t *testing.T) {
+	keyJSON, _ := rsaKey(t, "rsa-1")
+	srv := newJWKSServer(t, keyJSON)
+	keys := New(srv.URL, Options{})
+	ctx := context.Background()
+	if err := keys.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.set(http.StatusInternalServerError)
+	if err := keys.Refresh(ctx); err == nil {
+		t.Error("Refresh against a failing server succeeded")
+	}
+	if _, err := keys.Key(ctx, "rsa-1"); err != nil {
+		t.Errorf("Key after a failed refresh: %v, want the cached key", err)
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	keys := New(srv.URL, Options{Timeout: 20 * time.Millisecond})
+	start := time.Now()
+	if _, err := keys.Key(context.Background(), "rsa-1"); err == nil || errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Key against a hanging server: err = %v, want a fetch error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Key took %v, want it bounded by the timeout", elapsed)
+	}
+}
+
+func TestPublicKeyErrors(t *testing.T) {
+	for name, jk := range map[string]jsonKey{
+		"unknown type":   {Kty: "oct"},
+		"unknown curve":  {Kty: "EC", Crv: "P-192", X: "AQ", Y: "AQ"},
+		"bad modulus":    {Kty: "RSA", N: "!!", E: "AQAB"},
+		"large exponent": {Kty: "RSA", N: "AQ", E: "AQAAAAAA"},
+	} {
+		if _, err := jk.publicKey(); err == nil {
+			t.Errorf("%s: publicKey succeeded", name)
+		}
+	}
+}
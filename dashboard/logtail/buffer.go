@@ -0,0 +1,157 @@
+package logtail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// primeBytes is how far back from the end of the file a Buffer looks for
+// its initial lines
+const primeBytes = 256 << 10
+
+// subscriberBuffer is how many lines a subscriber may fall behind before it
+// is dropped
+const subscriberBuffer = 256
+
+// Buffer follows a log file in the background and keeps its last lines in a
+// Ring, so any number of readers get the recent log without reading the
+// file themselves. New lines are also broadcast to subscribers.
+type Buffer struct {
+	path string
+	ring *Ring
+
+	mu          sync.Mutex
+	subscribers map[chan string]struct{}
+}
+
+// NewBuffer returns a Buffer for path keeping the last size lines. Nothing
+// is read until Start is called.
+func NewBuffer(path string, size int) *Buffer {
+	return &Buffer{path: path, ring: NewRing(size), subscribers: make(map[chan string]struct{})}
+}
+
+// Subscribe returns a channel receiving each line appended to the file from
+// now on, and a func to unsubscribe. A subscriber that falls too far behind
+// is dropped, closing its channel, so one slow reader can't stall the rest.
+func (b *Buffer) Subscribe() (<-chan string, func()) {
+	ch := make(chan string, subscriberBuffer)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribers returns how many subscribers are currently following b
+func (b *Buffer) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// publish adds line to the ring and sends it to every subscriber
+func (b *Buffer) publish(line string) {
+	b.ring.Add(line)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- line:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Lines returns the buffered lines, oldest first
+func (b *Buffer) Lines() []string {
+	return b.ring.Lines()
+}
+
+// Start fills the ring with the file's current last lines, then follows the
+// file in a new goroutine until ctx is cancelled, checking for new lines
+// every poll. Read errors are logged and following restarts after a pause.
+func (b *Buffer) Start(ctx context.Context, poll time.Duration) {
+	lines, err := lastLines(b.path, len(b.ring.lines))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Reading %s: %v", b.path, err)
+	}
+	for _, line := range lines {
+		b.ring.Add(line)
+	}
+	go b.follow(ctx, poll)
+}
+
+func (b *Buffer) follow(ctx context.Context, poll time.Duration) {
+	for {
+		err := Follow(ctx, b.path, poll, func(line string) error {
+			b.publish(line)
+			return nil
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Following %s: %v", b.path, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * poll):
+		}
+	}
+}
+
+// lastLines returns up to n complete lines from the end of path, reading
+// at most primeBytes
+func lastLines(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	start := max(info.Size()-primeBytes, 0)
+	data, err := io.ReadAll(io.NewSectionReader(f, start, info.Size()-start))
+	if err != nil {
+		return nil, err
+	}
+	if start > 0 {
+		// Drop the line the window starts in the middle of
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+
+	data = bytes.TrimRight(data, "\r\n")
+	if len(data) == 0 {
+		return nil, nil
+	}
+	parts := bytes.Split(data, []byte("\n"))
+	if len(parts) > n {
+		parts = parts[len(parts)-n:]
+	}
+	lines := make([]string, len(parts))
+	for i, p := range parts {
+		lines[i] = string(bytes.TrimRight(p, "\r"))
+	}
+	return lines, nil
+}
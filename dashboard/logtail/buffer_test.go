@@ -0,0 +1,137 @@
+package logtail
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLastLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watcher.log")
+	if _, err := lastLines(path, 10); err == nil {
+		t.Error("lastLines of a missing file succeeded")
+	}
+
+	appendFile(t, path, "one\r\ntwo\nthree\n\n")
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{10, "one,two,three"},
+		{2, "two,three"},
+		{1, "three"},
+	}
+	for _, tt := range tests {
+		lines, err := lastLines(path, tt.n)
+		if err != nil || strings.Join(lines, ",") != tt.want {
+			t.Errorf("lastLines(%d) = %q, %v; want %s", tt.n, lines, err, tt.want)
+		}
+	}
+}
+
+func TestLastLinesLargeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watcher.log")
+	var b strings.Builder
+	for i := 0; b.Len() < primeBytes+1000; i++ {
+		fmt.Fprintf(&b, "line %d of a long log\n", i)
+	}
+	appendFile(t, path, b.String())
+
+	lines, err := lastLines(path, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(lines[0], "line ") || !strings.HasSuffix(lines[0], " of a long log") {
+		t.Errorf("first line = %q, want a whole line", lines[0])
+	}
+	all := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if last := lines[len(lines)-1]; last != all[len(all)-1] {
+		t.Errorf("last line = %q, want %q", last, all[len(all)-1])
+	}
+}
+
+// TestBufferBacklog checks a Buffer starts with the file's last lines and
+// then keeps up with lines appended to it
+func TestBufferBacklog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watcher.log")
+	appendFile(t, path, "old 1\nold 2\nold 3\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := NewBuffer(path, 3)
+	b.Start(ctx, testPoll)
+	if got := strings.Join(b.Lines(), ","); got != "old 1,old 2,old 3" {
+		t.Errorf("backlog = %s", got)
+	}
+
+	// Let the follower reach the end of the file
+	time.Sleep(5 * testPoll)
+	appendFile(t, path, "new 1\nnew 2\n")
+	deadline := time.Now().Add(2 * time.Second)
+	for strings.Join(b.Lines(), ",") != "old 3,new 1,new 2" {
+		if time.Now().After(deadline) {
+			t.Fatalf("lines = %q, want the new lines after the backlog", b.Lines())
+		}
+		time.Sleep(testPoll)
+	}
+}
+
+func TestBufferSubscribers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watcher.log")
+	appendFile(t, path, "before\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := NewBuffer(path, 10)
+	first, unsubscribeFirst := b.Subscribe()
+	second, unsubscribeSecond := b.Subscribe()
+	defer unsubscribeSecond()
+	b.Start(ctx, testPoll)
+
+	time.Sleep(5 * testPoll)
+	appendFile(t, path, "a\nb\n")
+	expect(t, first, "a", "b")
+	expect(t, second, "a", "b")
+
+	if n := b.Subscribers(); n != 2 {
+		t.Errorf("Subscribers() = %d, want 2", n)
+	}
+	unsubscribeFirst()
+	unsubscribeFirst()
+	if n := b.Subscribers(); n != 1 {
+		t.Errorf("Subscribers() after unsubscribing = %d, want 1", n)
+	}
+	if _, ok := <-first; ok {
+		t.Error("channel still open after unsubscribing")
+	}
+	appendFile(t, path, "c\n")
+	expect(t, second, "c")
+}
+
+func TestBufferDropsSlowSubscriber(t *testing.T) {
+	b := NewBuffer("", 10)
+	slow, unsubscribeSlow := b.Subscribe()
+	defer unsubscribeSlow()
+	fast, unsubscribeFast := b.Subscribe()
+	defer unsubscribeFast()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.publish(fmt.Sprint(i))
+		<-fast
+	}
+
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("slow subscriber got %d lines before being dropped, want %d", received, subscriberBuffer)
+	}
+	b.publish("after")
+	if got := <-fast; got != "after" {
+		t.Errorf("fast subscriber got %q, want it kept", got)
+	}
+}
@@ -0,0 +1,126 @@
+// Package logtail follows a log file like tail -F, surviving rotation by
+// rename-and-recreate or truncation.
+package logtail
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// Follow calls fn for each line appended to path after Follow starts, until
+// ctx is cancelled or fn returns an error. A missing file is waited for.
+// When the file is replaced (a different inode) or shrinks, Follow reopens
+// it and continues from the start of the new file. The file is polled every
+// poll interval once the end is reached.
+func Follow(ctx context.Context, path string, poll time.Duration, fn func(line string) error) error {
+	t := &tail{path: path}
+	defer t.close()
+
+	// Existing content is history; only stream what is written from now on
+	if err := t.open(true); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	var partial string
+	for {
+		if t.file != nil {
+			chunk, err := t.reader.ReadString('\n')
+			t.offset += int64(len(chunk))
+			if err == nil {
+				if err := fn(strings.TrimRight(partial+chunk, "\r\n")); err != nil {
+					return err
+				}
+				partial = ""
+				continue
+			}
+			if err != io.EOF {
+				return err
+			}
+			partial += chunk
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(poll):
+		}
+
+		rotated, err := t.rotated()
+		if err != nil {
+			return err
+		}
+		if rotated {
+			// A line cut off by the rotation is still worth showing
+			if partial != "" {
+				if err := fn(partial); err != nil {
+					return err
+				}
+				partial = ""
+			}
+			t.close()
+			if err := t.open(false); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+}
+
+type tail struct {
+	path   string
+	file   *os.File
+	info   os.FileInfo
+	reader *bufio.Reader
+	offset int64
+}
+
+// open opens the file, positioned at its end or its start
+func (t *tail) open(atEnd bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	t.offset = 0
+	if atEnd {
+		if t.offset, err = f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	t.file, t.info, t.reader = f, info, bufio.NewReader(f)
+	return nil
+}
+
+func (t *tail) close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+// rotated reports whether the open file should be reopened: it was never
+// opened and now exists, was replaced by another file, or was truncated
+func (t *tail) rotated() (bool, error) {
+	info, err := os.Stat(t.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil // mid-rotation; keep reading the old file for now
+	}
+	if err != nil {
+		return false, err
+	}
+	if t.file == nil {
+		return true, nil
+	}
+	return !os.SameFile(t.info, info) || info.Size() < t.offset, nil
+}
@@ -0,0 +1,109 @@
+package logtail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testPoll = 5 * time.Millisecond
+
+// follow runs Follow on path in the background, sending each line to the
+// returned channel
+func follow(t *testing.T, path string) <-chan string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := make(chan string, 100)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Follow(ctx, path, testPoll, func(line string) error {
+			lines <- line
+			return nil
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	// Let Follow open the file and seek to its end before the test writes
+	time.Sleep(5 * testPoll)
+	return lines
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expect reads len(want) lines from lines, failing on a mismatch or timeout
+func expect(t *testing.T, lines <-chan string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case got := <-lines:
+			if got != w {
+				t.Fatalf("line = %q, want %q", got, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", w)
+		}
+	}
+}
+
+func TestFollowSkipsExistingContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watcher.log")
+	appendFile(t, path, "old line\n")
+	lines := follow(t, path)
+
+	appendFile(t, path, "new line\r\nsplit ")
+	time.Sleep(5 * testPoll)
+	appendFile(t, path, "line\n")
+	expect(t, lines, "new line", "split line")
+}
+
+func TestFollowRename(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watcher.log")
+	appendFile(t, path, "")
+	lines := follow(t, path)
+
+	appendFile(t, path, "before\ncut off")
+	expect(t, lines, "before")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "after\n")
+	expect(t, lines, "cut off", "after")
+}
+
+func TestFollowTruncate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watcher.log")
+	appendFile(t, path, "")
+	lines := follow(t, path)
+
+	appendFile(t, path, "a fairly long line before truncation\n")
+	expect(t, lines, "a fairly long line before truncation")
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * testPoll)
+	appendFile(t, path, "short\n")
+	expect(t, lines, "short")
+}
+
+func TestFollowWaitsForFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watcher.log")
+	lines := follow(t, path)
+
+	appendFile(t, path, "first\n")
+	expect(t, lines, "first")
+}
@@ -0,0 +1,57 @@
+package logtail
+
+import "sync"
+
+// maxLineBytes caps each line a Ring keeps, so one runaway line can't hold
+// megabytes in memory
+const maxLineBytes = 8 << 10
+
+// Ring keeps the last lines added to it, up to a fixed count. It is safe for
+// concurrent use.
+type Ring struct {
+	mu    sync.Mutex
+	lines []string
+	next  int  // index the next line is written to
+	full  bool // lines has wrapped around
+}
+
+// NewRing returns a Ring holding at most size lines
+func NewRing(size int) *Ring {
+	return &Ring{lines: make([]string, max(size, 1))}
+}
+
+// Add appends line, dropping the oldest line once the ring is full. Lines
+// longer than maxLineBytes are truncated.
+func (r *Ring) Add(line string) {
+	if len(line) > maxLineBytes {
+		line = line[:maxLineBytes]
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.add(line)
+}
+
+func (r *Ring) add(line string) {
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Lines returns a copy of the buffered lines, oldest first
+func (r *Ring) Lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.snapshot()
+}
+
+func (r *Ring) snapshot() []string {
+	if !r.full {
+		return append([]string(nil), r.lines[:r.next]...)
+	}
+	lines := make([]string, 0, len(r.lines))
+	lines = append(lines, r.lines[r.next:]...)
+	return append(lines, r.lines[:r.next]...)
+}
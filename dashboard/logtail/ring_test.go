@@ -0,0 +1,73 @@
+package logtail
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing(3)
+	if lines := r.Lines(); len(lines) != 0 {
+		t.Errorf("empty ring = %q", lines)
+	}
+
+	tests := []struct {
+		add  string
+		want string
+	}{
+		{"a", "a"},
+		{"b", "a,b"},
+		{"c", "a,b,c"},
+		{"d", "b,c,d"},
+		{"e", "c,d,e"},
+		{"f", "d,e,f"},
+		{"g", "e,f,g"},
+	}
+	for _, tt := range tests {
+		r.Add(tt.add)
+		if got := strings.Join(r.Lines(), ","); got != tt.want {
+			t.Errorf("after %s: lines = %s, want %s", tt.add, got, tt.want)
+		}
+	}
+
+	lines := r.Lines()
+	lines[0] = "changed"
+	if r.Lines()[0] != "e" {
+		t.Error("Lines shares its slice with the ring")
+	}
+}
+
+func TestRingLimits(t *testing.T) {
+	r := NewRing(0)
+	r.Add("a")
+	r.Add("b")
+	if got := r.Lines(); len(got) != 1 || got[0] != "b" {
+		t.Errorf("size 0 ring = %q, want the last line", got)
+	}
+
+	r.Add(strings.Repeat("x", maxLineBytes+100))
+	if got := r.Lines(); len(got[0]) != maxLineBytes {
+		t.Errorf("long line kept %d bytes, want %d", len(got[0]), maxLineBytes)
+	}
+}
+
+func TestRingConcurrent(t *testing.T) {
+	r := NewRing(50)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				r.Add(fmt.Sprintf("%d-%d", w, i))
+				r.Lines()
+			}
+		}(w)
+	}
+	wg.Wait()
+	if n := len(r.Lines()); n != 50 {
+		t.Errorf("%d lines, want 50", n)
+	}
+}
@@ -1,28 +1,83 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/kubeden/clopus-watcher/dashboard/alerts"
 	"github.com/kubeden/clopus-watcher/dashboard/db"
 	"github.com/kubeden/clopus-watcher/dashboard/handlers"
 )
 
+// pathList matches request paths exactly, or by prefix for entries ending
+// in "/"
+type pathList []string
+
+func (l pathList) match(path string) bool {
+	for _, p := range l {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicPaths skip the session check (PUBLIC_PATHS), unless they are also
+// in protectedPaths (PROTECTED_PATHS). Set from the environment in main.
+var (
+	publicPaths    = pathList{"/health", "/readyz", "/login", "/api/"}
+	protectedPaths pathList
+)
+
+// basicAuthPublicPaths replace the default publicPaths when BASIC_AUTH_USERS
+// is set, so basic auth covers the API too unless PUBLIC_PATHS opens it
+var basicAuthPublicPaths = pathList{"/health", "/readyz", "/login"}
+
+// basicAuth, when set from BASIC_AUTH_USERS, lets SessionMiddleware accept
+// HTTP Basic credentials as well as the NextAuth cookie, for deployments
+// without the Platform
+var basicAuth *basicAuthUsers
+
 // SessionMiddleware validates NextAuth session from Platform
 // On localhost, we just check for session cookie presence and basic format
 func SessionMiddleware(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Skip auth for health checks and login routes
-		if r.URL.Path == "/health" || r.URL.Path == "/login" || strings.HasPrefix(r.URL.Path, "/api/") {
+		// Skip auth for health checks, login routes and other public paths
+		if publicPaths.match(r.URL.Path) && !protectedPaths.match(r.URL.Path) {
 			handler(w, r)
 			return
 		}
 
+		if basicAuth.enabled() {
+			if user, password, ok := r.BasicAuth(); ok {
+				if !basicAuth.valid(user, password) {
+					log.Printf("Invalid basic auth credentials from %s", r.RemoteAddr)
+					requestBasicAuth(w)
+					return
+				}
+				handler(w, r)
+				return
+			}
+		}
+
 		// Check for NextAuth session cookie (try both secure and non-secure names)
 		sessionExists := false
 
@@ -38,6 +93,12 @@ func SessionMiddleware(handler http.HandlerFunc) http.HandlerFunc {
 			}
 		}
 
+		// Without the Platform, ask the browser for basic auth credentials
+		if !sessionExists && basicAuth.enabled() {
+			requestBasicAuth(w)
+			return
+		}
+
 		// If no session found, redirect to Platform login
 		if !sessionExists {
 			log.Printf("No session cookie found for %s - redirecting to Platform login", r.RemoteAddr)
@@ -50,6 +111,52 @@ func SessionMiddleware(handler http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// requestBasicAuth answers 401 with a Basic challenge
+func requestBasicAuth(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="clopus-watcher", charset="UTF-8"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// AdminMiddleware guards destructive endpoints with a bearer token from
+// ADMIN_TOKEN. When ADMIN_TOKEN is unset the endpoints are disabled.
+func AdminMiddleware(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := os.Getenv("ADMIN_TOKEN")
+		if token == "" {
+			http.Error(w, "Admin endpoints are disabled", http.StatusForbidden)
+			return
+		}
+
+		if !adminAuthorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="clopus-watcher-admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// adminAuthorized reports whether r carries ADMIN_TOKEN as its bearer token
+func adminAuthorized(r *http.Request) bool {
+	token := os.Getenv("ADMIN_TOKEN")
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// AdminMethods applies AdminMiddleware to the given methods only, for
+// endpoints that are public to read but guarded to change
+func AdminMethods(handler http.HandlerFunc, methods ...string) http.HandlerFunc {
+	admin := AdminMiddleware(handler)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(methods, r.Method) {
+			admin(w, r)
+			return
+		}
+		handler(w, r)
+	}
+}
+
 // redirectToPlatformLogin builds the login URL and redirects
 func redirectToPlatformLogin(w http.ResponseWriter, r *http.Request) {
 	platformURL := os.Getenv("PLATFORM_URL")
@@ -71,7 +178,9 @@ func redirectToPlatformLogin(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, loginURLObj.String(), http.StatusFound)
 }
 
-// buildFullURL constructs the full URL from the request
+// buildFullURL constructs the full URL from the request. r.Host comes from
+// the client, so an untrusted host is swapped for the canonical dashboard
+// URL rather than echoed into the login redirect.
 func buildFullURL(r *http.Request) string {
 	scheme := "http"
 	if r.TLS != nil {
@@ -82,9 +191,78 @@ func buildFullURL(r *http.Request) string {
 	host := r.Host
 	path := r.RequestURI
 
+	if !trustedHost(host) {
+		log.Printf("Untrusted Host %q in login redirect, using DASHBOARD_URL", host)
+		return strings.TrimSuffix(dashboardURL(), "/") + path
+	}
+
 	return fmt.Sprintf("%s://%s%s", scheme, host, path)
 }
 
+// dashboardURL is the canonical dashboard base URL from DASHBOARD_URL
+func dashboardURL() string {
+	if u := os.Getenv("DASHBOARD_URL"); u != "" {
+		return u
+	}
+	return "http://localhost:3003/"
+}
+
+// trustedHost reports whether host is DASHBOARD_URL's host or listed in
+// TRUSTED_HOSTS. Entries without a port match the host on any port.
+func trustedHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	trusted := splitList(os.Getenv("TRUSTED_HOSTS"))
+	if u, err := url.Parse(dashboardURL()); err == nil && u.Host != "" {
+		trusted = append(trusted, u.Host)
+	}
+
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	for _, t := range trusted {
+		if strings.EqualFold(t, host) || strings.EqualFold(t, hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeRedirect returns raw if it points back at the dashboard: a local
+// path, or an http(s) URL on a trusted host. Anything else, including
+// scheme-relative "//host" paths and javascript: URLs, falls back to the
+// dashboard root.
+func sanitizeRedirect(raw string) string {
+	root := dashboardURL()
+	if raw == "" || strings.ContainsAny(raw, "\\\r\n") {
+		return root
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return root
+	}
+
+	// Relative paths are resolved against DASHBOARD_URL so the Platform
+	// gets an absolute return address
+	if u.Scheme == "" && u.Host == "" && strings.HasPrefix(raw, "/") && !strings.HasPrefix(raw, "//") {
+		base, err := url.Parse(root)
+		if err != nil {
+			return root
+		}
+		return base.ResolveReference(u).String()
+	}
+
+	if (u.Scheme == "http" || u.Scheme == "https") && u.User == nil && trustedHost(u.Host) {
+		return u.String()
+	}
+
+	log.Printf("Rejected login redirect %q", raw)
+	return root
+}
+
 // LoginHandler redirects to Platform login
 // If called directly at /login, it redirects to Platform with a redirect param
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
@@ -93,12 +271,8 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		platformURL = "http://localhost:3000"
 	}
 
-	// Get the redirect parameter if provided
-	redirectParam := r.URL.Query().Get("redirect")
-	if redirectParam == "" {
-		// Default to dashboard root if no redirect specified
-		redirectParam = "http://localhost:3003/"
-	}
+	// Only forward redirects back to this dashboard, defaulting to its root
+	redirectParam := sanitizeRedirect(r.URL.Query().Get("redirect"))
 
 	// Build login URL
 	loginURLObj, _ := url.Parse(platformURL)
@@ -111,19 +285,95 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, loginURLObj.String(), http.StatusFound)
 }
 
+// Build info, injected at build time via
+// -ldflags "-X main.version=... -X main.commit=..."
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
+// readyzHandler answers 503 while the health loop finds the database
+// unreachable. The loop logs the failure, so the public response carries no
+// error details.
+func readyzHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if ok, _ := database.Healthy(); !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, `{"status":"unavailable"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"status":"ok"}`)
+	}
+}
+
+// healthHandler reports build info and database connectivity. It always
+// answers 200 so a database blip doesn't restart the pod via the liveness
+// probe; the DB state is in the body. The endpoint is public, so ping errors
+// are logged rather than returned, as they can name hosts and drivers.
+func healthHandler(database *db.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+		defer cancel()
+
+		dbStatus := "ok"
+		dbError := ""
+		if err := database.Ping(ctx); err != nil {
+			log.Printf("Health check database ping failed: %v", err)
+			dbStatus = "error"
+			dbError = "unavailable"
+		}
+
+		stats := database.Stats()
+		result := map[string]interface{}{
+			"status":  "ok",
+			"version": version,
+			"commit":  commit,
+			"db": map[string]interface{}{
+				"status":           dbStatus,
+				"error":            dbError,
+				"open_connections": stats.OpenConnections,
+				"in_use":           stats.InUse,
+				"idle":             stats.Idle,
+			},
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
 func main() {
-	// Use PostgreSQL via DATABASE_URL (from shared secrets)
+	// Structured JSON logs; the standard log package is routed through this too
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	// Use PostgreSQL via DATABASE_URL (from shared secrets), or sqlite for
+	// local development
 	databaseURL := os.Getenv("DATABASE_URL")
 	if databaseURL == "" {
 		log.Fatalf("DATABASE_URL environment variable not set - required for PostgreSQL connection")
 	}
+	dbDriver, _ := db.ParseDriver(os.Getenv("DB_DRIVER"), databaseURL)
 
-	// Add SSL mode for local development (disable SSL for Docker/local postgres)
-	if !strings.Contains(databaseURL, "sslmode") {
-		if strings.Contains(databaseURL, "?") {
-			databaseURL += "&sslmode=disable"
-		} else {
-			databaseURL += "?sslmode=disable"
+	if dbDriver == db.DriverPostgres {
+		databaseURL = withSSLMode(databaseURL)
+	}
+
+	if paths := splitList(os.Getenv("PUBLIC_PATHS")); len(paths) > 0 {
+		publicPaths = paths
+	} else if os.Getenv("BASIC_AUTH_USERS") != "" {
+		publicPaths = basicAuthPublicPaths
+	}
+	protectedPaths = splitList(os.Getenv("PROTECTED_PATHS"))
+	proxies, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	trustedProxies = proxies
+	if users := os.Getenv("BASIC_AUTH_USERS"); users != "" {
+		if basicAuth, err = parseBasicAuthUsers(users); err != nil {
+			log.Fatalf("Invalid BASIC_AUTH_USERS: %v", err)
 		}
 	}
 
@@ -132,20 +382,141 @@ func main() {
 		port = "8080"
 	}
 
-	database, err := db.New(databaseURL)
+	database, err := db.Open(dbDriver, databaseURL)
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
 	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+	if os.Getenv("ENSURE_INDEXES") == "true" {
+		if err := database.EnsureIndexes(); err != nil {
+			log.Fatalf("Failed to create indexes: %v", err)
+		}
+	}
+	if ms := envInt("SLOW_QUERY_MS", 0); ms > 0 {
+		if err := database.SetSlowQueryThreshold(time.Duration(ms) * time.Millisecond); err != nil {
+			log.Fatalf("Failed to enable slow query logging: %v", err)
+		}
+	}
+	if replicaURL := os.Getenv("DATABASE_REPLICA_URL"); replicaURL != "" && dbDriver == db.DriverPostgres {
+		if err := database.SetReplica(withSSLMode(replicaURL)); err != nil {
+			log.Fatalf("Failed to open read replica: %v", err)
+		}
+	}
+	database.SetRetryAttempts(envInt("DB_RETRY_ATTEMPTS", 3))
+	if ttl, err := time.ParseDuration(os.Getenv("NAMESPACES_CACHE_TTL")); err == nil {
+		database.SetNamespacesCacheTTL(ttl)
+	}
+	if window, err := time.ParseDuration(os.Getenv("FIX_DEDUP_WINDOW")); err == nil {
+		database.SetFixDedupWindow(window)
+	}
+	if target := envFloat("SLO_TARGET", 0); target > 0 && target < 1 {
+		database.SetSLOTarget(target)
+	}
+
+	// Completed runs go to the NOTIFIERS channels and, when configured, the
+	// alert engine
+	notifiers, err := newNotifierSet(splitList(os.Getenv("NOTIFIERS")))
+	if err != nil {
+		log.Fatalf("Invalid NOTIFIERS: %v", err)
+	}
+	var alertsQueue *alertQueue
+
+	// Optional alerting on per-namespace thresholds, evaluated as runs complete
+	if rulesJSON := os.Getenv("ALERT_RULES"); rulesJSON != "" {
+		rules, err := alerts.ParseRules(rulesJSON)
+		if err != nil {
+			log.Fatalf("Invalid ALERT_RULES: %v", err)
+		}
+		webhookURL := os.Getenv("ALERT_WEBHOOK_URL")
+		if webhookURL == "" {
+			log.Fatalf("ALERT_RULES is set but ALERT_WEBHOOK_URL is not")
+		}
+		notifier := newWebhookNotifier(webhookURL, os.Getenv("WEBHOOK_SECRET"))
+		engine := alerts.New(rules, database.GetNamespaceWindowCounts, func(a alerts.Alert) error {
+			return notifier.Notify(a)
+		})
+		alertsQueue = newAlertQueue(engine.Evaluate)
+	}
+	database.OnRunComplete(func(run db.Run) {
+		go notifiers.Dispatch(run)
+		if alertsQueue != nil {
+			alertsQueue.Enqueue(run.Namespace)
+		}
+	})
+
+	// Stop background work and the server on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if alertsQueue != nil {
+		go alertsQueue.Run(ctx)
+	}
+
+	// Recreate the DB pool if Postgres restarts; state is served at /readyz
+	go database.StartHealthLoop(ctx, 10*time.Second)
 
 	// Import any JSON results from watcher script into the database
-	resultsDir := "/tmp/clopus-watcher-runs"
-	if err := database.ImportJSONResults(resultsDir); err != nil {
-		log.Printf("Warning: Failed to import JSON results: %v", err)
+	resultsDir := os.Getenv("RESULTS_DIR")
+	if resultsDir == "" {
+		resultsDir = "/tmp/clopus-watcher-runs"
+	}
+	database.SetImportRenumber(os.Getenv("IMPORT_RENUMBER") == "true")
+	if pattern := os.Getenv("RESULTS_GLOB"); pattern != "" {
+		if err := database.SetResultsGlob(pattern); err != nil {
+			log.Fatalf("Invalid RESULTS_GLOB: %v", err)
+		}
+	}
+
+	// Maintenance mode pauses imports, janitor tasks and API writes, e.g.
+	// during migrations.
+	// It can also be toggled at runtime via /api/maintenance.
+	var maintenance atomic.Bool
+	maintenance.Store(os.Getenv("MAINTENANCE_MODE") == "true")
+
+	importResults := pauseForMaintenance(&maintenance, func() (*db.ImportResult, error) {
+		return database.ImportJSONResults(resultsDir)
+	})
+	logImport(importResults())
+
+	// Optionally keep importing on an interval
+	if os.Getenv("IMPORT_ENABLED") == "true" {
+		interval, err := time.ParseDuration(os.Getenv("IMPORT_INTERVAL"))
+		if err != nil || interval <= 0 {
+			interval = 30 * time.Second
+		}
+		log.Printf("Importing results from %s every %s", resultsDir, interval)
+		go runImporter(ctx, interval, importResults)
+	}
+
+	// Optional periodic maintenance
+	var janitorTasks []janitorTask
+	if os.Getenv("RECONCILE_FIX_COUNTS") == "true" {
+		janitorTasks = append(janitorTasks, janitorTask{"reconcile_fix_counts", database.ReconcileFixCounts})
+	}
+	if len(janitorTasks) > 0 {
+		interval, err := time.ParseDuration(os.Getenv("JANITOR_INTERVAL"))
+		if err != nil || interval <= 0 {
+			interval = time.Hour
+		}
+		go runJanitor(ctx, interval, pauseTasksForMaintenance(&maintenance, janitorTasks))
+	}
+
+	// Static assets, embedded in the binary
+	staticSub, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		log.Fatalf("Failed to load static assets: %v", err)
+	}
+	assets, err := newStaticAssets(staticSub)
+	if err != nil {
+		log.Fatalf("Failed to load static assets: %v", err)
 	}
 
 	// Template functions
 	funcMap := template.FuncMap{
+		// asset returns the cacheable URL of a file under static/
+		"asset": assets.Path,
 		"dict": func(values ...interface{}) map[string]interface{} {
 			m := make(map[string]interface{})
 			for i := 0; i < len(values); i += 2 {
@@ -155,6 +526,17 @@ func main() {
 			}
 			return m
 		},
+		// pretty renders report section values: strings as is, anything else as indented JSON
+		"pretty": func(v interface{}) string {
+			if s, ok := v.(string); ok {
+				return s
+			}
+			b, err := json.MarshalIndent(v, "", "  ")
+			if err != nil {
+				return fmt.Sprint(v)
+			}
+			return string(b)
+		},
 	}
 
 	// Parse all templates together
@@ -174,37 +556,179 @@ func main() {
 	}
 
 	h := handlers.New(database, tmpl, logPath)
+	if threshold, err := time.ParseDuration(os.Getenv("STALE_THRESHOLD")); err == nil && threshold > 0 {
+		h.SetStaleThreshold(threshold)
+	}
+	h.SetDefaultNamespace(os.Getenv("DEFAULT_NAMESPACE"))
+	h.SetLogDir(os.Getenv("LOG_DIR"))
+	h.SetDebug(os.Getenv("DEBUG") == "true")
+	h.SetMaintenance(&maintenance)
+	h.SetContext(ctx)
+	if n := envInt("ARTIFACT_MAX_BYTES", 0); n > 0 {
+		h.SetMaxArtifactSize(int64(n))
+	}
 
 	// Login route (no auth required)
 	http.HandleFunc("/login", LoginHandler)
 
-	// Health check (no auth required) - simple endpoint for readiness probe
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ok"}`)
-	})
+	// Health check (no auth required) - build info and DB status for diagnosing deploys
+	http.HandleFunc("/health", healthHandler(database))
 
-	// Page routes (with auth)
-	http.HandleFunc("/", SessionMiddleware(h.Index))
+	// Readiness (no auth required) - fails while the DB is unreachable
+	http.HandleFunc("/readyz", readyzHandler(database))
 
-	// HTMX partial routes (with auth)
-	http.HandleFunc("/partials/runs", SessionMiddleware(h.RunsList))
-	http.HandleFunc("/partials/run", SessionMiddleware(h.RunDetail))
-	http.HandleFunc("/partials/stats", SessionMiddleware(h.Stats))
-	http.HandleFunc("/partials/log", SessionMiddleware(h.LiveLog))
+	// Page and API requests are cut off after REQUEST_TIMEOUT; streaming
+	// endpoints (the live log, run logs and JSONL exports) are exempt
+	requestTimeout := 30 * time.Second
+	if d, err := time.ParseDuration(os.Getenv("REQUEST_TIMEOUT")); err == nil {
+		requestTimeout = d
+	}
+	timeout := TimeoutMiddleware(requestTimeout)
+
+	// Static assets (no auth, gzip)
+	http.Handle("/static/", GzipMiddleware(assets.ServeHTTP))
+
+	// Page routes (with auth, gzip)
+	http.HandleFunc("/", timeout(GzipMiddleware(SessionMiddleware(h.Index))))
+
+	// HTMX partial routes (with auth, gzip)
+	http.HandleFunc("/partials/runs", timeout(GzipMiddleware(SessionMiddleware(h.RunsList))))
+	http.HandleFunc("/partials/run", timeout(GzipMiddleware(SessionMiddleware(h.RunDetail))))
+	http.HandleFunc("/partials/run/fixes", timeout(GzipMiddleware(SessionMiddleware(h.RunFixes))))
+	http.HandleFunc("/partials/run/log", GzipMiddleware(SessionMiddleware(h.RunLog)))
+	http.HandleFunc("/partials/stats", timeout(GzipMiddleware(SessionMiddleware(h.Stats))))
+	http.HandleFunc("/partials/fixes", timeout(GzipMiddleware(SessionMiddleware(h.FixesList))))
+	http.HandleFunc("/partials/log", timeout(GzipMiddleware(SessionMiddleware(h.LiveLog))))
+	http.HandleFunc("/partials/log/stream", SessionMiddleware(h.LiveLogStream))
+
+	// API middleware chain (CORS for the admin SPA, per-client rate limit)
+	cors := CORSMiddleware(splitList(os.Getenv("CORS_ALLOWED_ORIGINS")))
+	limiter := NewRateLimiter(envFloat("RATE_LIMIT_RPS", 10), envInt("RATE_LIMIT_BURST", 20), 10000)
+	apiStream := func(handler http.HandlerFunc) http.HandlerFunc {
+		return cors(limiter.Middleware(handler))
+	}
+	maintenanceGuard := MaintenanceMiddleware(&maintenance)
+	api := func(handler http.HandlerFunc) http.HandlerFunc {
+		return apiStream(timeout(maintenanceGuard(handler)))
+	}
 
 	// API routes (no auth for local dev, add if needed)
-	http.HandleFunc("/api/namespaces", h.APINamespaces)
-	http.HandleFunc("/api/runs", h.APIRuns)
-	http.HandleFunc("/api/run", h.APIRun)
+	http.HandleFunc("/api/namespaces", api(h.APINamespaces))
+	http.HandleFunc("/api/namespaces/compare", api(h.APINamespacesCompare))
+	http.HandleFunc("/api/namespaces/search", api(h.APINamespacesSearch))
+	http.HandleFunc("/api/namespaces/sparklines", api(h.APINamespacesSparklines))
+	http.HandleFunc("/api/runs", api(h.APIRuns))
+	http.HandleFunc("/api/runs/by-mode", api(h.APIRunsByMode))
+	http.HandleFunc("/api/runs/query", api(h.APIRunsQuery))
+	http.HandleFunc("/api/runs/status-counts", api(h.APIRunsStatusCounts))
+	http.HandleFunc("/api/run", api(AdminMethods(h.APIRun, http.MethodPatch)))
+	http.HandleFunc("/api/runs.jsonl", apiStream(h.APIRunsJSONL))
+	http.HandleFunc("/api/runs/heatmap", api(h.APIRunsHeatmap))
+	http.HandleFunc("/api/fixes.jsonl", apiStream(h.APIFixesJSONL))
+	http.HandleFunc("/api/run/report", api(h.APIRunReport))
+	http.HandleFunc("/api/run/progress", api(h.APIRunProgress))
+	http.HandleFunc("/api/run/lineage", api(h.APIRunLineage))
+	http.HandleFunc("/api/run/events", api(h.APIRunEvents))
+	http.HandleFunc("/api/run/summary", api(h.APIRunSummary))
+	http.HandleFunc("/api/run/artifacts", api(AdminMiddleware(h.APIRunArtifacts)))
+	http.HandleFunc("/api/artifact", api(AdminMiddleware(h.APIArtifact)))
+	http.HandleFunc("/api/run/retry", api(AdminMiddleware(h.APIRunRetry)))
+	http.HandleFunc("/api/fixes/status", api(AdminMiddleware(h.APIFixesStatus)))
+	http.HandleFunc("/api/db/stats", api(AdminMiddleware(h.APIDBStats)))
+	// Not behind the maintenance guard, so maintenance can be turned off
+	http.HandleFunc("/api/maintenance", apiStream(timeout(AdminMiddleware(h.APIMaintenance))))
+	http.HandleFunc("/api/fixes", api(h.APIFixes))
+	http.HandleFunc("/api/fixes/mttf", api(h.APIFixesMTTF))
+	http.HandleFunc("/api/fixes/success-rate", api(h.APIFixesSuccessRate))
+	http.HandleFunc("/api/fixes/top-pods", api(h.APIFixesTopPods))
+	http.HandleFunc("/api/fixes/by-pod", api(h.APIFixesByPod))
+	http.HandleFunc("/api/fixes/recent", api(h.APIFixesRecent))
+	http.HandleFunc("/api/fixes/clusters", api(h.APIFixesClusters))
+	http.HandleFunc("/api/stats", api(h.APIStats))
+	http.HandleFunc("/api/summary", api(h.APISummary))
+	http.HandleFunc("/api/storage", api(h.APIStorage))
+	http.HandleFunc("/api/openapi.json", api(h.APIOpenAPI))
+
+	// Admin API routes (bearer token from ADMIN_TOKEN)
+	http.HandleFunc("/api/namespace", api(AdminMethods(h.APINamespace, http.MethodDelete)))
+	http.HandleFunc("/api/namespace/archive", api(AdminMiddleware(h.APIArchiveNamespace)))
+	http.HandleFunc("/api/namespace/last-run", api(h.APINamespaceLastRun))
+	http.HandleFunc("/api/namespace/slo", api(h.APINamespaceSLO))
 
 	addr := ":" + port
 	log.Printf("Dashboard starting on port %s with session validation", port)
 	log.Printf("Listening on %s", addr)
 	server := &http.Server{
 		Addr:    addr,
-		Handler: http.DefaultServeMux,
+		Handler: RequestLogMiddleware(http.DefaultServeMux),
+	}
+
+	go func() {
+		<-ctx.Done()
+		log.Printf("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	// Terminate TLS in-process when a certificate is configured
+	certFile := os.Getenv("TLS_CERT_FILE")
+	keyFile := os.Getenv("TLS_KEY_FILE")
+	if certFile != "" && keyFile != "" {
+		server.TLSConfig = tlsConfig()
+		log.Printf("Serving HTTPS with certificate %s", certFile)
+		err = server.ListenAndServeTLS(certFile, keyFile)
+	} else {
+		log.Printf("Serving plain HTTP (set TLS_CERT_FILE and TLS_KEY_FILE to enable TLS)")
+		err = server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// tlsConfig requires TLS 1.2+ and restricts TLS 1.2 to forward-secret AEAD
+// cipher suites (TLS 1.3 suites are not configurable)
+func tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	}
+}
+
+// withSSLMode disables SSL for Postgres URLs that don't choose a mode, for
+// local development (Docker/local postgres)
+func withSSLMode(databaseURL string) string {
+	if strings.Contains(databaseURL, "sslmode") {
+		return databaseURL
+	}
+	if strings.Contains(databaseURL, "?") {
+		return databaseURL + "&sslmode=disable"
+	}
+	return databaseURL + "?sslmode=disable"
+}
+
+// envInt reads an integer env var, falling back to def when unset or invalid
+func envInt(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// envFloat reads a float env var, falling back to def when unset or invalid
+func envFloat(key string, def float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return def
 	}
-	log.Fatal(server.ListenAndServe())
+	return v
 }
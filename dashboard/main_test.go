@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/kubeden/clopus-watcher/dashboard/db"
+)
+
+func TestTLSConfig(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = tlsConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name    string
+		version uint16
+		wantErr bool
+	}{
+		{"TLS 1.1", tls.VersionTLS11, true},
+		{"TLS 1.2", tls.VersionTLS12, false},
+		{"TLS 1.3", tls.VersionTLS13, false},
+	} {
+		client := server.Client()
+		transport := client.Transport.(*http.Transport)
+		transport.TLSClientConfig.MinVersion = tt.version
+		transport.TLSClientConfig.MaxVersion = tt.version
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		transport.CloseIdleConnections()
+	}
+}
+
+func TestWithSSLMode(t *testing.T) {
+	tests := map[string]string{
+		"postgres://db/clopus":                   "postgres://db/clopus?sslmode=disable",
+		"postgres://db/clopus?connect_timeout=5": "postgres://db/clopus?connect_timeout=5&sslmode=disable",
+		"postgres://db/clopus?sslmode=require":   "postgres://db/clopus?sslmode=require",
+	}
+	for in, want := range tests {
+		if got := withSSLMode(in); got != want {
+			t.Errorf("withSSLMode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+var apiRoute = regexp.MustCompile(`http\.HandleFunc\("(/api[^"]*)"`)
+
+// TestOpenAPICoversRoutes checks every /api route registered in main has a
+// path in the OpenAPI document, and the document has no stale paths
+func TestOpenAPICoversRoutes(t *testing.T) {
+	source, err := os.ReadFile("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := map[string]bool{}
+	for _, m := range apiRoute.FindAllStringSubmatch(string(source), -1) {
+		routes[m[1]] = true
+	}
+	if len(routes) == 0 {
+		t.Fatal("no /api routes found in main.go")
+	}
+
+	data, err := os.ReadFile("handlers/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec struct {
+		Paths map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	for route := range routes {
+		if spec.Paths[route] == nil {
+			t.Errorf("%s is registered but missing from openapi.json", route)
+		}
+	}
+	for path := range spec.Paths {
+		if !routes[path] {
+			t.Errorf("%s is in openapi.json but not registered", path)
+		}
+	}
+}
+
+func TestTrustedHost(t *testing.T) {
+	t.Setenv("DASHBOARD_URL", "https://dash.example.com/")
+	t.Setenv("TRUSTED_HOSTS", "internal.example.com, localhost:3003")
+
+	tests := map[string]bool{
+		"dash.example.com":          true,
+		"DASH.example.com":          true,
+		"dash.example.com:8443":     true,
+		"internal.example.com:3003": true,
+		"localhost:3003":            true,
+		"localhost:4000":            false,
+		"evil.example.com":          false,
+		"dash.example.com.evil.com": false,
+		"":                          false,
+	}
+	for host, want := range tests {
+		if got := trustedHost(host); got != want {
+			t.Errorf("trustedHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestBuildFullURL(t *testing.T) {
+	t.Setenv("DASHBOARD_URL", "https://dash.example.com/")
+	t.Setenv("TRUSTED_HOSTS", "")
+
+	r := httptest.NewRequest(http.MethodGet, "/runs?ns=prod", nil)
+	r.Host = "dash.example.com"
+	if got := buildFullURL(r); got != "http://dash.example.com/runs?ns=prod" {
+		t.Errorf("trusted host: buildFullURL = %q", got)
+	}
+
+	r.Host = "evil.example.com"
+	if got := buildFullURL(r); got != "https://dash.example.com/runs?ns=prod" {
+		t.Errorf("untrusted host: buildFullURL = %q, want DASHBOARD_URL", got)
+	}
+}
+
+func TestSanitizeRedirect(t *testing.T) {
+	t.Setenv("DASHBOARD_URL", "https://dash.example.com/")
+	t.Setenv("TRUSTED_HOSTS", "internal.example.com")
+	const root = "https://dash.example.com/"
+
+	tests := map[string]string{
+		"":                                      root,
+		"/runs?ns=prod":                         "https://dash.example.com/runs?ns=prod",
+		"https://dash.example.com/fixes":        "https://dash.example.com/fixes",
+		"http://internal.example.com:3003/":     "http://internal.example.com:3003/",
+		"//evil.example.com/":                   root,
+		"/\\evil.example.com":                   root,
+		"https://evil.example.com/":             root,
+		"https://dash.example.com@evil.com/":    root,
+		"https://user@dash.example.com/":        root,
+		"javascript:alert(1)":                   root,
+		"runs":                                  root,
+		"/runs\r\nSet-Cookie: session=attacker": root,
+	}
+	for raw, want := range tests {
+		if got := sanitizeRedirect(raw); got != want {
+			t.Errorf("sanitizeRedirect(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestPathListMatch(t *testing.T) {
+	l := pathList{"/health", "/api/", "/static/"}
+	tests := map[string]bool{
+		"/health":       true,
+		"/health/deep":  false,
+		"/healthz":      false,
+		"/api/":         true,
+		"/api/runs":     true,
+		"/api":          false,
+		"/static/x.css": true,
+		"/":             false,
+	}
+	for path, want := range tests {
+		if got := l.match(path); got != want {
+			t.Errorf("match(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestSessionMiddlewarePublicPaths(t *testing.T) {
+	defer func(public, protected pathList) { publicPaths, protectedPaths = public, protected }(publicPaths, protectedPaths)
+	publicPaths = pathList{"/health", "/api/"}
+	protectedPaths = pathList{"/api/db/"}
+
+	handler := SessionMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+	tests := map[string]int{
+		"/health":       http.StatusOK,
+		"/api/runs":     http.StatusOK,
+		"/api/db/stats": http.StatusFound,
+		"/":             http.StatusFound,
+	}
+	for path, want := range tests {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Errorf("%s without a session: code = %d, want %d", path, w.Code, want)
+		}
+	}
+}
+
+func TestReadyzHandlerUnavailable(t *testing.T) {
+	// A DB that never passed a health check
+	w := httptest.NewRecorder()
+	readyzHandler(&db.DB{})(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != `{"status":"unavailable"}` {
+		t.Errorf("code %d, body %s; want a 503 without error details", w.Code, w.Body)
+	}
+}
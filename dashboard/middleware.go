@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/kubeden/clopus-watcher/dashboard/handlers"
+)
+
+// gzipMinSize is the smallest response worth compressing
+const gzipMinSize = 1024
+
+// GzipMiddleware compresses responses for clients that accept gzip.
+// Responses smaller than gzipMinSize, responses the handler already encoded
+// and event streams are passed through untouched.
+func GzipMiddleware(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			handler(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+		handler(gw, r)
+	}
+}
+
+// gzipResponseWriter buffers the start of a response until it knows whether
+// compressing it is worthwhile
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	buf         bytes.Buffer
+	gz          *gzip.Writer
+	passthrough bool
+	wroteHeader bool
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.status == 0 {
+		g.status = status
+	}
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if g.passthrough {
+		return g.ResponseWriter.Write(p)
+	}
+	if g.gz != nil {
+		return g.gz.Write(p)
+	}
+
+	if g.skipCompression() {
+		g.startPassthrough()
+		return g.ResponseWriter.Write(p)
+	}
+
+	g.buf.Write(p)
+	if g.buf.Len() >= gzipMinSize {
+		if err := g.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends whatever has been buffered so far, committing to the current
+// encoding decision
+func (g *gzipResponseWriter) Flush() {
+	if g.gz == nil && !g.passthrough {
+		if g.skipCompression() || g.buf.Len() < gzipMinSize {
+			g.startPassthrough()
+			g.ResponseWriter.Write(g.buf.Bytes())
+			g.buf.Reset()
+		} else {
+			g.startGzip()
+		}
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close finishes the response, writing small bodies uncompressed
+func (g *gzipResponseWriter) Close() error {
+	if g.gz != nil {
+		return g.gz.Close()
+	}
+	if !g.passthrough {
+		g.startPassthrough()
+		_, err := g.ResponseWriter.Write(g.buf.Bytes())
+		return err
+	}
+	return nil
+}
+
+func (g *gzipResponseWriter) skipCompression() bool {
+	h := g.Header()
+	if h.Get("Content-Encoding") != "" {
+		return true
+	}
+	return strings.HasPrefix(h.Get("Content-Type"), "text/event-stream")
+}
+
+func (g *gzipResponseWriter) startPassthrough() {
+	g.passthrough = true
+	g.writeHeader()
+}
+
+func (g *gzipResponseWriter) startGzip() error {
+	h := g.Header()
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(g.buf.Bytes()))
+	}
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	g.writeHeader()
+
+	g.gz = gzip.NewWriter(g.ResponseWriter)
+	_, err := g.gz.Write(g.buf.Bytes())
+	g.buf.Reset()
+	return err
+}
+
+func (g *gzipResponseWriter) writeHeader() {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	if g.status != 0 {
+		g.ResponseWriter.WriteHeader(g.status)
+	}
+}
+
+// RequestLogMiddleware tags every request with an X-Request-ID (reusing the
+// caller's when present) and logs one structured line per request
+func RequestLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		r = r.WithContext(handlers.WithRequestID(r.Context(), requestID))
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		slog.Info("request",
+			"request_id", requestID,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder remembers the status code written by the wrapped handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// TimeoutMiddleware returns a middleware answering 503 with a JSON error
+// when a handler runs longer than timeout. Responses are buffered until the
+// handler returns, so it is not meant for streaming endpoints. A timeout of
+// zero disables it.
+func TimeoutMiddleware(timeout time.Duration) func(http.HandlerFunc) http.HandlerFunc {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		if timeout <= 0 {
+			return handler
+		}
+		th := http.TimeoutHandler(handler, timeout, `{"error":"request timed out"}`+"\n")
+		return func(w http.ResponseWriter, r *http.Request) {
+			th.ServeHTTP(&timeoutResponseWriter{ResponseWriter: w}, r)
+		}
+	}
+}
+
+// timeoutResponseWriter labels http.TimeoutHandler's timeout body as JSON.
+// Completed responses already carry the handler's headers when their
+// status is written, so only the timeout response lacks a Content-Type.
+type timeoutResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (t *timeoutResponseWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable && t.Header().Get("Content-Type") == "" {
+		t.Header().Set("Content-Type", "application/json")
+	}
+	t.ResponseWriter.WriteHeader(status)
+}
+
+// readOnlyPosts are POST routes that only read, taking their query in the
+// body, so maintenance mode leaves them open
+var readOnlyPosts = map[string]bool{
+	"/api/runs/query": true,
+}
+
+// MaintenanceMiddleware returns a middleware answering 503 with a JSON
+// error to requests that may write (anything but GET, HEAD, OPTIONS and
+// readOnlyPosts) while maintenance reports true. Reads are served as usual.
+func MaintenanceMiddleware(maintenance *atomic.Bool) func(http.HandlerFunc) http.HandlerFunc {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !readsOnly(r) && maintenance.Load() {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Retry-After", "60")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"error":"down for maintenance"}` + "\n"))
+				return
+			}
+			handler(w, r)
+		}
+	}
+}
+
+// readsOnly reports whether r can't write, judged by its method and route
+func readsOnly(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		return readOnlyPosts[r.URL.Path]
+	}
+	return false
+}
+
+// CORSMiddleware returns a middleware allowing cross-origin calls from the
+// given origins ("*" allows any). Requests from other origins are rejected,
+// except same-origin requests which browsers also tag with an Origin header.
+func CORSMiddleware(allowedOrigins []string) func(http.HandlerFunc) http.HandlerFunc {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, o := range allowedOrigins {
+		allowed[strings.TrimRight(o, "/")] = true
+	}
+
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || isSameOrigin(origin, r.Host) {
+				handler(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			if !allowed["*"] && !allowed[origin] {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+
+			// Preflight
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID")
+			handler(w, r)
+		}
+	}
+}
+
+func isSameOrigin(origin, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == host
+}
+
+// splitList parses a comma-separated env value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kubeden/clopus-watcher/dashboard/handlers"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	large := strings.Repeat("clopus ", gzipMinSize)
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		body        string
+		wantGzip    bool
+	}{
+		{"large body", "gzip, deflate", "application/json", large, true},
+		{"small body", "gzip", "application/json", "{}", false},
+		{"client without gzip", "", "application/json", large, false},
+		{"event stream", "gzip", "text/event-stream", large, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := GzipMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, tt.body)
+			})
+			r := httptest.NewRequest(http.MethodGet, "/api/runs", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept-Encoding", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != http.StatusCreated {
+				t.Errorf("code = %d, want the handler's 201", w.Code)
+			}
+			gzipped := w.Header().Get("Content-Encoding") == "gzip"
+			if gzipped != tt.wantGzip {
+				t.Fatalf("gzipped = %v, want %v", gzipped, tt.wantGzip)
+			}
+
+			body := w.Body.String()
+			if gzipped {
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = string(b)
+			}
+			if body != tt.body {
+				t.Errorf("body has %d bytes, want %d", len(body), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestGzipMiddlewareFlushSmallBody(t *testing.T) {
+	handler := GzipMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "data: hello\n\n")
+		w.(http.Flusher).Flush()
+	})
+	r := httptest.NewRequest(http.MethodGet, "/api/logs/stream", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "data: hello\n\n" {
+		t.Errorf("flushed small body = %q (encoding %q), want it sent as is", w.Body, w.Header().Get("Content-Encoding"))
+	}
+	if !w.Flushed {
+		t.Error("Flush was not passed on")
+	}
+}
+
+func TestRequestLogMiddleware(t *testing.T) {
+	var seen string
+	handler := RequestLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = handlers.RequestID(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/runs", nil))
+	generated := w.Header().Get("X-Request-ID")
+	if generated == "" || seen != generated {
+		t.Errorf("generated id: header %q, context %q", generated, seen)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/runs", nil)
+	r.Header.Set("X-Request-ID", "from-proxy")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Header().Get("X-Request-ID") != "from-proxy" || seen != "from-proxy" {
+		t.Errorf("caller's id: header %q, context %q, want from-proxy", w.Header().Get("X-Request-ID"), seen)
+	}
+
+	if a, b := newRequestID(), newRequestID(); a == b {
+		t.Errorf("newRequestID repeated %q", a)
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	slow := TimeoutMiddleware(10 * time.Millisecond)(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	w := httptest.NewRecorder()
+	slow(w, httptest.NewRequest(http.MethodGet, "/api/runs", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Content-Type") != "application/json" ||
+		!strings.Contains(w.Body.String(), "request timed out") {
+		t.Errorf("slow handler: code %d, content type %q, body %q; want a 503 JSON error", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+
+	fast := TimeoutMiddleware(time.Second)(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("ok"))
+	})
+	w = httptest.NewRecorder()
+	fast(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/html" || w.Body.String() != "ok" {
+		t.Errorf("fast handler: code %d, content type %q, body %q", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+
+	called := false
+	handler := func(w http.ResponseWriter, r *http.Request) { called = true }
+	TimeoutMiddleware(0)(handler)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !called {
+		t.Error("zero timeout didn't call the handler")
+	}
+}
+
+func TestMaintenanceMiddleware(t *testing.T) {
+	var maintenance atomic.Bool
+	maintenance.Store(true)
+	handler := MaintenanceMiddleware(&maintenance)(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	for _, method := range []string{http.MethodPost, http.MethodPatch, http.MethodDelete} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, "/api/run", nil))
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" ||
+			!strings.Contains(w.Body.String(), "down for maintenance") {
+			t.Errorf("%s under maintenance: code %d, Retry-After %q, body %q; want a 503", method, w.Code, w.Header().Get("Retry-After"), w.Body)
+		}
+	}
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodOptions} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, "/api/runs", nil))
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s under maintenance: code = %d, want it served", method, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/api/runs/query", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("read-only POST under maintenance: code = %d, want it served", w.Code)
+	}
+
+	maintenance.Store(false)
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/api/run", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("POST after maintenance: code = %d, want it served", w.Code)
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowed    []string
+		origin     string
+		method     string
+		preflight  bool
+		wantCode   int
+		wantOrigin string
+	}{
+		{"no origin", nil, "", http.MethodGet, false, http.StatusOK, ""},
+		{"same origin", nil, "http://dashboard.example", http.MethodGet, false, http.StatusOK, ""},
+		{"none allowed", nil, "https://evil.example", http.MethodGet, false, http.StatusForbidden, ""},
+		{"listed origin", []string{"https://app.example/"}, "https://app.example", http.MethodGet, false, http.StatusOK, "https://app.example"},
+		{"unlisted origin", []string{"https://app.example"}, "https://evil.example", http.MethodGet, false, http.StatusForbidden, ""},
+		{"wildcard", []string{"*"}, "https://any.example", http.MethodGet, false, http.StatusOK, "https://any.example"},
+		{"preflight", []string{"https://app.example"}, "https://app.example", http.MethodOptions, true, http.StatusNoContent, "https://app.example"},
+		{"rejected preflight", []string{"https://app.example"}, "https://evil.example", http.MethodOptions, true, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := CORSMiddleware(tt.allowed)(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			})
+			r := httptest.NewRequest(tt.method, "http://dashboard.example/api/runs", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				r.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if wantCalled := tt.wantCode == http.StatusOK; called != wantCalled {
+				t.Errorf("handler called = %v, want %v", called, wantCalled)
+			}
+			if tt.preflight && tt.wantCode == http.StatusNoContent && w.Header().Get("Access-Control-Allow-Methods") == "" {
+				t.Error("preflight without Access-Control-Allow-Methods")
+			}
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	got := splitList(" https://a.example, ,https://b.example ,")
+	if len(got) != 2 || got[0] != "https://a.example" || got[1] != "https://b.example" {
+		t.Errorf("splitList = %q", got)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kubeden/clopus-watcher/dashboard/db"
+	"github.com/kubeden/clopus-watcher/dashboard/webhook"
+)
+
+// webhookNotifier POSTs JSON payloads to a URL, signed with the shared
+// secret as described in package webhook
+type webhookNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func newWebhookNotifier(url, secret string) *webhookNotifier {
+	return &webhookNotifier{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *webhookNotifier) Notify(payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		req.Header.Set(webhook.SignatureHeader, webhook.Sign(body, n.secret))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Notifier is told about every completed run. Implementations are
+// registered in notifierFactories and enabled through NOTIFIERS.
+type Notifier interface {
+	NotifyRunComplete(run db.Run) error
+}
+
+// notifierFactories builds the notifiers NOTIFIERS can name. Adding a
+// channel means adding an entry here.
+var notifierFactories = map[string]func() (Notifier, error){
+	"none": func() (Notifier, error) { return nopNotifier{}, nil },
+	"log":  func() (Notifier, error) { return logNotifier{}, nil },
+	"webhook": func() (Notifier, error) {
+		url := os.Getenv("RUN_WEBHOOK_URL")
+		if url == "" {
+			return nil, fmt.Errorf("RUN_WEBHOOK_URL is not set")
+		}
+		return newWebhookNotifier(url, os.Getenv("WEBHOOK_SECRET")), nil
+	},
+}
+
+// nopNotifier is the default when NOTIFIERS is unset
+type nopNotifier struct{}
+
+func (nopNotifier) NotifyRunComplete(db.Run) error { return nil }
+
+// logNotifier writes a line per completed run to the structured log
+type logNotifier struct{}
+
+func (logNotifier) NotifyRunComplete(run db.Run) error {
+	slog.Info("run completed", "run_id", run.ID, "namespace", run.Namespace, "status", run.Status,
+		"errors", run.ErrorCount, "fixes", run.FixCount)
+	return nil
+}
+
+// NotifyRunComplete POSTs {"event": "run.completed", "run": ...}
+func (n *webhookNotifier) NotifyRunComplete(run db.Run) error {
+	return n.Notify(map[string]interface{}{"event": "run.completed", "run": run})
+}
+
+// namedNotifier keeps a notifier's NOTIFIERS name for logging
+type namedNotifier struct {
+	name string
+	Notifier
+}
+
+// notifierSet dispatches completed runs to several notifiers
+type notifierSet []namedNotifier
+
+// newNotifierSet builds the notifiers named in names, failing on unknown
+// names or misconfigured notifiers. No names means the no-op notifier.
+func newNotifierSet(names []string) (notifierSet, error) {
+	if len(names) == 0 {
+		names = []string{"none"}
+	}
+	var set notifierSet
+	for _, name := range names {
+		factory, ok := notifierFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown notifier %q", name)
+		}
+		n, err := factory()
+		if err != nil {
+			return nil, fmt.Errorf("notifier %s: %w", name, err)
+		}
+		set = append(set, namedNotifier{name, n})
+	}
+	return set, nil
+}
+
+// Dispatch notifies every notifier in parallel and waits for them. A
+// notifier failing or panicking is logged without affecting the others.
+func (s notifierSet) Dispatch(run db.Run) {
+	var wg sync.WaitGroup
+	for _, n := range s {
+		wg.Add(1)
+		go func(n namedNotifier) {
+			defer wg.Done()
+			defer func() {
+				if p := recover(); p != nil {
+					slog.Error("notifier panicked", "notifier", n.name, "run_id", run.ID, "panic", p)
+				}
+			}()
+			if err := n.NotifyRunComplete(run); err != nil {
+				slog.Warn("notifier failed", "notifier", n.name, "run_id", run.ID, "error", err)
+			}
+		}(n)
+	}
+	wg.Wait()
+}
+
+// alertQueue evaluates alert rules off the run completion path. Completions
+// for a namespace that is already waiting coalesce into one evaluation, so
+// the queue never holds more than one entry per namespace.
+type alertQueue struct {
+	evaluate func(namespace string)
+	wake     chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]struct{}
+}
+
+func newAlertQueue(evaluate func(namespace string)) *alertQueue {
+	return &alertQueue{
+		evaluate: evaluate,
+		wake:     make(chan struct{}, 1),
+		pending:  make(map[string]struct{}),
+	}
+}
+
+// Enqueue schedules namespace for evaluation without blocking
+func (q *alertQueue) Enqueue(namespace string) {
+	q.mu.Lock()
+	q.pending[namespace] = struct{}{}
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run evaluates queued namespaces one at a time until ctx is cancelled
+func (q *alertQueue) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		}
+
+		q.mu.Lock()
+		namespaces := q.pending
+		q.pending = make(map[string]struct{})
+		q.mu.Unlock()
+		for namespace := range namespaces {
+			if ctx.Err() != nil {
+				return
+			}
+			q.evaluateOne(namespace)
+		}
+	}
+}
+
+func (q *alertQueue) evaluateOne(namespace string) {
+	defer func() {
+		if p := recover(); p != nil {
+			slog.Error("alert evaluation panicked", "namespace", namespace, "panic", p)
+		}
+	}()
+	q.evaluate(namespace)
+}
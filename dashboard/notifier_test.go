@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kubeden/clopus-watcher/dashboard/db"
+	"github.com/kubeden/clopus-watcher/dashboard/webhook"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var payload struct {
+		Event string `json:"event"`
+		Run   db.Run `json:"run"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !webhook.VerifyWebhookSignature(body, r.Header.Get(webhook.SignatureHeader), "s3cret") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.Unmarshal(body, &payload)
+	}))
+	defer server.Close()
+
+	if err := newWebhookNotifier(server.URL, "s3cret").NotifyRunComplete(db.Run{ID: 7, Status: "fixed"}); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != "run.completed" || payload.Run.ID != 7 || payload.Run.Status != "fixed" {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	if err := newWebhookNotifier(server.URL, "wrong").NotifyRunComplete(db.Run{ID: 7}); err == nil {
+		t.Error("rejected webhook: want an error")
+	}
+}
+
+func TestNewNotifierSet(t *testing.T) {
+	set, err := newNotifierSet(nil)
+	if err != nil || len(set) != 1 || set[0].name != "none" {
+		t.Errorf("no names = %+v, %v; want the no-op notifier", set, err)
+	}
+
+	if _, err := newNotifierSet([]string{"log", "pager"}); err == nil {
+		t.Error("unknown notifier: want an error")
+	}
+
+	t.Setenv("RUN_WEBHOOK_URL", "")
+	if _, err := newNotifierSet([]string{"webhook"}); err == nil {
+		t.Error("webhook without RUN_WEBHOOK_URL: want an error")
+	}
+	t.Setenv("RUN_WEBHOOK_URL", "http://hooks.example.com/")
+	if set, err := newNotifierSet([]string{"log", "webhook"}); err != nil || len(set) != 2 {
+		t.Errorf("log,webhook = %+v, %v", set, err)
+	}
+}
+
+type funcNotifier func(db.Run) error
+
+func (f funcNotifier) NotifyRunComplete(run db.Run) error { return f(run) }
+
+// TestDispatchIsolatesFailures checks a failing or panicking notifier
+// doesn't keep the others from running
+func TestDispatchIsolatesFailures(t *testing.T) {
+	var calls atomic.Int32
+	ok := funcNotifier(func(db.Run) error { calls.Add(1); return nil })
+	set := notifierSet{
+		{"panics", funcNotifier(func(db.Run) error { panic("boom") })},
+		{"fails", funcNotifier(func(db.Run) error { return errors.New("down") })},
+		{"first", ok},
+		{"second", ok},
+	}
+
+	set.Dispatch(db.Run{ID: 1})
+	if n := calls.Load(); n != 2 {
+		t.Errorf("%d working notifiers called, want 2", n)
+	}
+}
+
+// TestAlertQueue checks Enqueue doesn't wait on a slow evaluation, repeated
+// completions coalesce and a panicking evaluation doesn't stop the worker
+func TestAlertQueue(t *testing.T) {
+	release := make(chan struct{})
+	evaluated := make(chan string, 10)
+	q := newAlertQueue(func(namespace string) {
+		evaluated <- namespace
+		switch namespace {
+		case "slow":
+			<-release
+		case "bad":
+			panic("boom")
+		}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	next := func() string {
+		t.Helper()
+		select {
+		case ns := <-evaluated:
+			return ns
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for an evaluation")
+			return ""
+		}
+	}
+
+	q.Enqueue("slow")
+	if ns := next(); ns != "slow" {
+		t.Fatalf("evaluated %q, want slow", ns)
+	}
+	for i := 0; i < 3; i++ {
+		q.Enqueue("default")
+	}
+	q.Enqueue("bad")
+	close(release)
+
+	got := map[string]int{}
+	for i := 0; i < 2; i++ {
+		got[next()]++
+	}
+	q.Enqueue("after")
+	if ns := next(); ns != "after" {
+		t.Errorf("evaluated %q, want after once the panic was recovered", ns)
+	}
+	if got["default"] != 1 || got["bad"] != 1 {
+		t.Errorf("evaluations = %v, want default and bad once each", got)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimiter hands out a token bucket per client, keyed by remote IP, or
+// shared by requests carrying the admin token. The number of tracked clients
+// is capped; when full, the least recently seen client is evicted, along with
+// any idle ones behind it.
+type RateLimiter struct {
+	rps        rate.Limit
+	burst      int
+	maxClients int
+	idleTTL    time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*list.Element // of *clientLimiter
+	recent  *list.List               // most recently seen first
+}
+
+type clientLimiter struct {
+	key      string
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func NewRateLimiter(rps float64, burst, maxClients int) *RateLimiter {
+	return &RateLimiter{
+		rps:        rate.Limit(rps),
+		burst:      burst,
+		maxClients: maxClients,
+		idleTTL:    10 * time.Minute,
+		clients:    make(map[string]*list.Element),
+		recent:     list.New(),
+	}
+}
+
+// Middleware rejects requests over the client's rate with a 429 and a
+// Retry-After header
+func (rl *RateLimiter) Middleware(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reservation := rl.limiter(clientKey(r)).Reserve()
+		if !reservation.OK() {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (rl *RateLimiter) limiter(key string) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if e, ok := rl.clients[key]; ok {
+		c := e.Value.(*clientLimiter)
+		c.lastSeen = now
+		rl.recent.MoveToFront(e)
+		return c.limiter
+	}
+
+	if len(rl.clients) >= rl.maxClients {
+		rl.evict(now)
+	}
+
+	c := &clientLimiter{key: key, limiter: rate.NewLimiter(rl.rps, rl.burst), lastSeen: now}
+	rl.clients[key] = rl.recent.PushFront(c)
+	return c.limiter
+}
+
+// evict drops the least recently seen client and any idle clients after it.
+// Each client is dropped at most once, so the cost is amortized constant.
+// Callers must hold rl.mu.
+func (rl *RateLimiter) evict(now time.Time) {
+	for e := rl.recent.Back(); e != nil; e = rl.recent.Back() {
+		c := e.Value.(*clientLimiter)
+		if len(rl.clients) < rl.maxClients && now.Sub(c.lastSeen) <= rl.idleTTL {
+			return
+		}
+		rl.recent.Remove(e)
+		delete(rl.clients, c.key)
+	}
+}
+
+// clientKey identifies the caller by client IP. Requests authenticated with
+// the admin token share one bucket instead; other bearer tokens and API keys
+// are not checked here, so they can't be used to mint fresh buckets.
+func clientKey(r *http.Request) string {
+	if adminAuthorized(r) {
+		return "admin"
+	}
+	return "ip:" + clientIP(r)
+}
+
+// trustedProxies are the networks, from TRUSTED_PROXIES, whose
+// X-Forwarded-For header is believed
+var trustedProxies []netip.Prefix
+
+// parseTrustedProxies parses a comma-separated list of CIDRs or single IPs
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range splitList(value) {
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proxy %q: %w", item, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %w", item, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the remote address, or when that is a trusted proxy, the
+// rightmost X-Forwarded-For entry that isn't one. Entries left of the first
+// untrusted hop are client-supplied and ignored.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0 && trustedProxy(addr); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+	}
+	return addr.String()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+)
+
+func TestClientKey(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   string
+	}{
+		{"no credentials", "", "", "ip:192.0.2.1"},
+		{"unchecked API key", "X-API-Key", "made-up", "ip:192.0.2.1"},
+		{"wrong bearer token", "Authorization", "Bearer made-up", "ip:192.0.2.1"},
+		{"admin token", "Authorization", "Bearer secret", "admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/runs", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			if got := clientKey(r); got != tt.want {
+				t.Errorf("clientKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPTrustedProxies(t *testing.T) {
+	defer func(proxies []netip.Prefix) { trustedProxies = proxies }(trustedProxies)
+	var err error
+	if trustedProxies, err = parseTrustedProxies("10.0.0.0/8, 192.0.2.7"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"direct client", "198.51.100.1:1234", nil, "198.51.100.1"},
+		{"untrusted remote ignores header", "198.51.100.1:1234", []string{"203.0.113.9"}, "198.51.100.1"},
+		{"via ingress", "10.1.2.3:1234", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"spoofed entries left of the client", "10.1.2.3:1234", []string{"1.1.1.1, 203.0.113.9"}, "203.0.113.9"},
+		{"chain of trusted proxies", "10.1.2.3:1234", []string{"203.0.113.9, 192.0.2.7", "10.9.9.9"}, "203.0.113.9"},
+		{"all hops trusted", "10.1.2.3:1234", []string{"10.0.0.1"}, "10.0.0.1"},
+		{"garbage entry", "10.1.2.3:1234", []string{"not-an-ip"}, "10.1.2.3"},
+		{"ingress without header", "10.1.2.3:1234", nil, "10.1.2.3"},
+		{"mapped IPv6 remote", "[::ffff:10.1.2.3]:1234", []string{"203.0.113.9"}, "203.0.113.9"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/runs", nil)
+		r.RemoteAddr = tt.remote
+		for _, v := range tt.xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := clientIP(r); got != tt.want {
+			t.Errorf("%s: clientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"10.0.0.0/33", "ingress", "10.0.0.1/8/8"} {
+		if _, err := parseTrustedProxies(value); err == nil {
+			t.Errorf("parseTrustedProxies(%q) succeeded", value)
+		}
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	rl := NewRateLimiter(1, 2, 10)
+	handler := rl.Middleware(func(w http.ResponseWriter, r *http.Request) {})
+
+	codes := make([]int, 3)
+	for i := range codes {
+		r := httptest.NewRequest(http.MethodGet, "/api/runs", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		handler(w, r)
+		codes[i] = w.Code
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Error("429 without Retry-After")
+		}
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("codes = %v, want the burst of 2 allowed then a 429", codes)
+	}
+
+	// Another client has its own bucket
+	r := httptest.NewRequest(http.MethodGet, "/api/runs", nil)
+	r.RemoteAddr = "192.0.2.2:1234"
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("second client: code = %d, want 200", w.Code)
+	}
+}
+
+func TestRateLimiterEvictsLeastRecentlySeen(t *testing.T) {
+	rl := NewRateLimiter(1, 1, 2)
+	a := rl.limiter("a")
+	rl.limiter("b")
+	rl.limiter("a") // b is now the least recently seen
+	rl.limiter("c")
+
+	if len(rl.clients) != 2 || rl.recent.Len() != 2 {
+		t.Fatalf("tracking %d clients, want 2", len(rl.clients))
+	}
+	if _, ok := rl.clients["b"]; ok {
+		t.Error("b was kept, want it evicted")
+	}
+	if rl.limiter("a") != a {
+		t.Error("a was evicted, want it kept")
+	}
+}
+
+func BenchmarkRateLimiterFull(b *testing.B) {
+	rl := NewRateLimiter(1, 1, 10000)
+	keys := make([]string, 20000)
+	for i := range keys {
+		keys[i] = "ip:" + strconv.Itoa(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rl.limiter(keys[i%len(keys)])
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+//go:embed static
+var staticFS embed.FS
+
+// staticAssets serves the embedded static/ files under /static/. Each file
+// is also reachable by a content-hashed name (css/app.<hash>.css), which
+// templates get from Path and which can be cached forever since a new build
+// with a changed file yields a new name.
+type staticAssets struct {
+	fsys   fs.FS
+	hashed map[string]string // name -> hashed name
+	names  map[string]string // hashed name -> name
+}
+
+func newStaticAssets(fsys fs.FS) (*staticAssets, error) {
+	a := &staticAssets{fsys: fsys, hashed: map[string]string{}, names: map[string]string{}}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:4]) + ext
+		a.hashed[name] = hashed
+		a.names[hashed] = name
+		return nil
+	})
+	return a, err
+}
+
+// Path returns the URL of a static file, by its content-hashed name when
+// the file exists
+func (a *staticAssets) Path(name string) string {
+	if hashed, ok := a.hashed[name]; ok {
+		return "/static/" + hashed
+	}
+	return "/static/" + name
+}
+
+func (a *staticAssets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/static/")
+	if original, ok := a.names[name]; ok {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		name = original
+	} else if _, ok := a.hashed[name]; ok {
+		// Unhashed names may change content between deploys
+		w.Header().Set("Cache-Control", "public, max-age=300")
+	} else {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFileFS(w, r, a.fsys, name)
+}
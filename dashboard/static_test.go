@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStaticAssets(t *testing.T) {
+	assets, err := newStaticAssets(fstest.MapFS{"css/app.css": {Data: []byte("body { margin: 0 }")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed := assets.Path("css/app.css")
+	if !regexp.MustCompile(`^/static/css/app\.[0-9a-f]{8}\.css$`).MatchString(hashed) {
+		t.Fatalf("Path(css/app.css) = %q, want a content-hashed name", hashed)
+	}
+	if got := assets.Path("js/missing.js"); got != "/static/js/missing.js" {
+		t.Errorf("Path(js/missing.js) = %q", got)
+	}
+
+	tests := []struct {
+		path      string
+		wantCode  int
+		wantCache string
+	}{
+		{hashed, http.StatusOK, "public, max-age=31536000, immutable"},
+		{"/static/css/app.css", http.StatusOK, "public, max-age=300"},
+		{"/static/css/app.00000000.css", http.StatusNotFound, ""},
+		{"/static/js/missing.js", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		assets.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.wantCode || w.Header().Get("Cache-Control") != tt.wantCache {
+			t.Errorf("%s: code %d, Cache-Control %q; want %d, %q", tt.path, w.Code, w.Header().Get("Cache-Control"), tt.wantCode, tt.wantCache)
+		}
+		if tt.wantCode == http.StatusOK && w.Body.String() != "body { margin: 0 }" {
+			t.Errorf("%s: body = %q", tt.path, w.Body)
+		}
+	}
+}
+
+// TestEmbeddedStaticAssets checks the files bundled into the binary are served
+func TestEmbeddedStaticAssets(t *testing.T) {
+	sub, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assets, err := newStaticAssets(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	assets.ServeHTTP(w, httptest.NewRequest(http.MethodGet, assets.Path("css/app.css"), nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/css; charset=utf-8" {
+		t.Errorf("app.css: code %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+}
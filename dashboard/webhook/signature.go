@@ -0,0 +1,45 @@
+// Package webhook holds helpers for consumers of the dashboard's outgoing
+// webhooks.
+//
+// Every webhook request carries a signature header:
+//
+//	X-Clopus-Signature: sha256=<hex>
+//
+// where <hex> is the lowercase hex HMAC-SHA256 of the raw request body keyed
+// with the shared webhook secret.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// SignatureHeader is the HTTP header carrying the payload signature
+const SignatureHeader = "X-Clopus-Signature"
+
+const signaturePrefix = "sha256="
+
+// Sign returns the SignatureHeader value for body
+func Sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature reports whether header is a valid signature of body
+// for secret. The comparison is constant-time.
+func VerifyWebhookSignature(body []byte, header, secret string) bool {
+	if secret == "" || !strings.HasPrefix(header, signaturePrefix) {
+		return false
+	}
+	given, err := hex.DecodeString(strings.TrimPrefix(header, signaturePrefix))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(given, mac.Sum(nil))
+}
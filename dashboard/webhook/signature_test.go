@@ -0,0 +1,40 @@
+package webhook
+
+import "testing"
+
+// Test case 2 of RFC 4231 (HMAC-SHA256)
+var (
+	knownBody      = []byte("what do ya want for nothing?")
+	knownSecret    = "Jefe"
+	knownSignature = "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+)
+
+func TestSign(t *testing.T) {
+	if got := Sign(knownBody, knownSecret); got != knownSignature {
+		t.Errorf("Sign = %q, want %q", got, knownSignature)
+	}
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   []byte
+		header string
+		secret string
+		want   bool
+	}{
+		{"valid", knownBody, knownSignature, knownSecret, true},
+		{"uppercase hex", knownBody, "sha256=5BDCC146BF60754E6A042426089575C75A003F089D2739839DEC58B964EC3843", knownSecret, true},
+		{"wrong secret", knownBody, knownSignature, "jefe", false},
+		{"tampered body", []byte("what do ya want for nothing!"), knownSignature, knownSecret, false},
+		{"empty secret", knownBody, Sign(knownBody, ""), "", false},
+		{"missing prefix", knownBody, knownSignature[len("sha256="):], knownSecret, false},
+		{"not hex", knownBody, "sha256=zz", knownSecret, false},
+		{"truncated", knownBody, knownSignature[:len(knownSignature)-2], knownSecret, false},
+	}
+	for _, tt := range tests {
+		if got := VerifyWebhookSignature(tt.body, tt.header, tt.secret); got != tt.want {
+			t.Errorf("%s: VerifyWebhookSignature = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -16,7 +16,11 @@ docker build -t "$REGISTRY/clopus-watcher:$TAG" -f Dockerfile.watcher .
 # Build dashboard image
 echo ""
 echo "=== Building dashboard image ==="
-docker build -t "$REGISTRY/clopus-watcher-dashboard:$TAG" -f Dockerfile.dashboard .
+COMMIT="${COMMIT:-$(git rev-parse --short HEAD 2>/dev/null || echo unknown)}"
+docker build -t "$REGISTRY/clopus-watcher-dashboard:$TAG" \
+  --build-arg VERSION="$TAG" \
+  --build-arg COMMIT="$COMMIT" \
+  -f Dockerfile.dashboard .
 
 echo ""
 echo "=== Build complete ==="